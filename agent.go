@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gotha/bitca/backend"
+	"github.com/gotha/bitca/mcp"
+)
+
+// turnResult is the outcome of a single request to the backend
+type turnResult struct {
+	content   string
+	toolCalls []backend.ToolCall
+	usage     *backend.Usage
+}
+
+// chatTurn sends messages to the backend and collects the response. Text is
+// passed to onText as it streams in. On error the partial result is returned
+// too, with ctx.Err() taking precedence so cancellation is recognizable.
+func chatTurn(ctx context.Context, llmBackend backend.Backend, modelName string, messages []backend.Message,
+	tools []backend.Tool, onText func(string)) (turnResult, error) {
+	// Streaming is enabled by default, but can be disabled via --no-streaming flag
+	// Some models don't return tool calls with streaming enabled
+	stream := !config.NoStreaming
+
+	// Debug: log the request
+	debugLog.Printf("=== Sending request to %s ===", llmBackend.Name())
+	debugLog.Printf("Model: %s", modelName)
+	debugLog.Printf("Streaming: %v", stream)
+	debugLog.Printf("Number of tools: %d", len(tools))
+	for i, tool := range tools {
+		debugLog.Printf("  Tool %d: %s", i, tool.Name)
+	}
+	debugLog.Printf("Number of messages: %d", len(messages))
+
+	var fullContent strings.Builder
+	var result turnResult
+
+	messages = dropOldImages(messages)
+	err := llmBackend.Chat(ctx, modelName, messages, tools, stream, func(chunk backend.StreamChunk) error {
+		debugLog.Printf("Response callback - Content len: %d, Done: %v, ToolCalls: %d",
+			len(chunk.Content), chunk.Done, len(chunk.ToolCalls))
+
+		if chunk.Content != "" {
+			fullContent.WriteString(chunk.Content)
+			if onText != nil {
+				onText(chunk.Content)
+			}
+		}
+
+		// Capture tool calls from the response
+		if len(chunk.ToolCalls) > 0 {
+			debugLog.Printf("Received tool calls: %d", len(chunk.ToolCalls))
+			for _, tc := range chunk.ToolCalls {
+				debugLog.Printf("  Tool call: %s with args: %v", tc.Name, tc.Arguments)
+			}
+			result.toolCalls = chunk.ToolCalls
+		}
+
+		if chunk.Usage != nil {
+			debugLog.Printf("Usage: %d prompt, %d completion tokens",
+				chunk.Usage.PromptTokens, chunk.Usage.CompletionTokens)
+			result.usage = chunk.Usage
+		}
+
+		return nil
+	})
+
+	result.content = fullContent.String()
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		result.toolCalls = nil
+		return result, err
+	}
+	return result, nil
+}
+
+// callsToRun returns the tool calls to execute for a response: the ones the
+// API reported, or JSON tool calls written into the text by models without
+// native tool support
+func callsToRun(result turnResult) []backend.ToolCall {
+	if len(result.toolCalls) == 0 && result.content != "" {
+		return parseJSONToolCalls(result.content)
+	}
+	return result.toolCalls
+}
+
+// Tool outcome statuses
+const (
+	toolSucceeded = "ok"
+	toolFailed    = "error"
+	toolDenied    = "denied"
+	toolCancelled = "cancelled"
+)
+
+// latestTurn returns the index of the first message after the last
+// assistant message: the tool results the model hasn't seen yet
+func latestTurn(messages []backend.Message) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "assistant" {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// dropOldImages returns messages without the images of tool results the
+// model has already answered, so each image is sent once rather than with
+// every later request
+func dropOldImages(messages []backend.Message) []backend.Message {
+	latest := latestTurn(messages)
+	var result []backend.Message
+	for i, msg := range messages[:latest] {
+		if len(msg.Images) == 0 {
+			continue
+		}
+		if result == nil {
+			result = append([]backend.Message(nil), messages...)
+		}
+		result[i].Images = nil
+	}
+	if result == nil {
+		return messages
+	}
+	return result
+}
+
+// toolOutcome is the result of one tool call
+type toolOutcome struct {
+	message  backend.Message // the tool result sent back to the model
+	status   string
+	duration time.Duration
+}
+
+// outcomeMessages returns the tool result messages of outcomes
+func outcomeMessages(outcomes []toolOutcome) []backend.Message {
+	messages := make([]backend.Message, len(outcomes))
+	for i, outcome := range outcomes {
+		messages[i] = outcome.message
+	}
+	return messages
+}
+
+// runTools executes tool calls and returns one outcome per call. Calls
+// listed in denials, or left over after ctx is cancelled, are not run but
+// still get a result so the history stays valid. Long results are
+// truncated to the tool output budget of the turn.
+func runTools(ctx context.Context, mcpManager *mcp.Manager, toolCalls []backend.ToolCall, denials map[int]string) []toolOutcome {
+	var outcomes []toolOutcome
+	budget := newOutputBudget(config.MaxToolOutput)
+
+	for i, toolCall := range toolCalls {
+		args := toolCall.Arguments
+		toolName := toolCall.Name
+
+		// Every tool call needs a result, even when the turn was cancelled
+		if ctx.Err() != nil {
+			outcomes = append(outcomes, toolOutcome{
+				message: backend.Message{
+					Role:       "tool",
+					Content:    fmt.Sprintf("Tool %s was not run: cancelled by user", toolName),
+					ToolCallID: toolCall.ID,
+				},
+				status: toolCancelled,
+			})
+			continue
+		}
+
+		// Denied calls are reported to the model instead of run
+		if reason, denied := denials[i]; denied {
+			outcomes = append(outcomes, toolOutcome{
+				message: backend.Message{
+					Role:       "tool",
+					Content:    fmt.Sprintf("Tool %s was not run: %s", toolName, reason),
+					ToolCallID: toolCall.ID,
+				},
+				status: toolDenied,
+			})
+			continue
+		}
+
+		// Log tool execution for debugging
+		toolInfo := fmt.Sprintf("Executing tool: %s with args: %v", toolName, args)
+
+		var result string
+		var images []backend.Image
+		var err error
+		start := time.Now()
+
+		// Check if this is an MCP tool
+		if mcpManager != nil && mcpManager.HasTool(toolName) {
+			result, err = mcpManager.ExecuteTool(toolName, args)
+		} else {
+			// Execute built-in tool
+			result, images, err = executeToolContent(ctx, toolName, args)
+		}
+		duration := time.Since(start)
+
+		if err != nil {
+			// Create tool response message with error
+			outcomes = append(outcomes, toolOutcome{
+				message: backend.Message{
+					Role:       "tool",
+					Content:    fmt.Sprintf("Error executing %s: %v\nDebug: %s", toolName, err, toolInfo),
+					ToolCallID: toolCall.ID, // Link back to the tool call
+				},
+				status:   toolFailed,
+				duration: duration,
+			})
+			continue
+		}
+
+		// Add successful result with tool call ID
+		outcomes = append(outcomes, toolOutcome{
+			message: backend.Message{
+				Role:       "tool",
+				Content:    budget.fit(toolName, result),
+				ToolCallID: toolCall.ID, // Link back to the tool call
+				Images:     images,
+			},
+			status:   toolSucceeded,
+			duration: duration,
+		})
+	}
+
+	return outcomes
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gotha/bitca/patch"
+)
+
+// patchedFile is what an apply_patch call does to one file of the patch
+type patchedFile struct {
+	name    string             // the path as written in the patch
+	changes []fileChange       // none if no hunk applies
+	results []patch.HunkResult // one per hunk
+	problem string             // why the file can't be patched at all
+}
+
+// applied returns the number of hunks that apply
+func (f patchedFile) applied() int {
+	n := 0
+	for _, r := range f.results {
+		if r.Applied {
+			n++
+		}
+	}
+	return n
+}
+
+// planPatch works out the changes an apply_patch call makes without making
+// them. A patch that can't be parsed is an editProblem; files and hunks
+// that can't be applied are reported in the result.
+func planPatch(args map[string]interface{}) ([]patchedFile, error) {
+	text, ok := args["patch"].(string)
+	if !ok {
+		return nil, fmt.Errorf("patch must be a string")
+	}
+
+	patches, err := patch.Parse(text)
+	if err != nil {
+		return nil, editProblem(err.Error())
+	}
+
+	files := make([]patchedFile, 0, len(patches))
+	for _, p := range patches {
+		file := patchedFile{name: p.Path()}
+		file.changes, file.results, err = planFilePatch(p)
+		if err != nil {
+			file.problem = err.Error()
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func planFilePatch(p patch.FilePatch) ([]fileChange, []patch.HunkResult, error) {
+	target, err := resolvePath(p.Path())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if p.IsDelete() {
+		data, err := os.ReadFile(target)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []fileChange{{path: target, old: string(data), deleted: true}}, nil, nil
+	}
+
+	source := target
+	if !p.IsNew() && p.OldPath != p.NewPath {
+		// A rename: the hunks apply to the old file
+		if source, err = resolvePath(p.OldPath); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	old := ""
+	if p.IsNew() {
+		if _, err := os.Stat(target); err == nil {
+			return nil, nil, fmt.Errorf("%s already exists", p.Path())
+		}
+	} else {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return nil, nil, err
+		}
+		old = string(data)
+	}
+
+	content, results := patch.Apply(old, p.Hunks)
+	applied := false
+	for _, r := range results {
+		applied = applied || r.Applied
+	}
+	if !applied {
+		return nil, results, nil
+	}
+
+	if source == target {
+		return []fileChange{{path: target, old: old, new: content, created: p.IsNew()}}, results, nil
+	}
+	return []fileChange{
+		{path: target, new: content, created: true},
+		{path: source, old: old, deleted: true},
+	}, results, nil
+}
+
+func toolApplyPatch(args map[string]interface{}) (string, error) {
+	files, err := planPatch(args)
+	var problem editProblem
+	if errors.As(err, &problem) {
+		return "error: " + string(problem), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	applied, total, changed := 0, 0, false
+	for _, f := range files {
+		applied += f.applied()
+		total += len(f.results)
+		changed = changed || len(f.changes) > 0
+	}
+
+	var report []string
+	for _, f := range files {
+		for _, c := range f.changes {
+			if err := c.apply(); err != nil {
+				return "", err
+			}
+			debugLog.Printf("Patched file %s", c.path)
+		}
+
+		var lines []string
+		if f.problem != "" {
+			lines = append(lines, fmt.Sprintf("%s: error: %s", f.name, f.problem))
+		} else if len(f.changes) == 0 {
+			lines = append(lines, fmt.Sprintf("%s: not changed", f.name))
+		}
+		for _, c := range f.changes {
+			lines = append(lines, c.summary())
+		}
+		for i, r := range f.results {
+			lines = append(lines, hunkReport(i, r))
+		}
+		report = append(report, strings.Join(lines, "\n"))
+	}
+
+	header := fmt.Sprintf("Applied %d of %d hunks to %d files", applied, total, len(files))
+	switch {
+	case !changed:
+		header = "error: nothing was changed"
+	case applied < total:
+		header += "; resend only the failed hunks, with the file's current text as context"
+	}
+	return header + "\n\n" + strings.Join(report, "\n\n"), nil
+}
+
+// hunkReport describes how one hunk went
+func hunkReport(i int, r patch.HunkResult) string {
+	if !r.Applied {
+		return fmt.Sprintf("hunk %d: failed: %s", i+1, r.Note)
+	}
+	s := fmt.Sprintf("hunk %d: applied at line %d", i+1, r.Line)
+	if r.Note != "" {
+		s += " (" + r.Note + ")"
+	}
+	return s
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "main.go")
+	old := filepath.Join(dir, "old.txt")
+	created := filepath.Join(dir, "sub", "new.txt")
+	if err := os.WriteFile(source, []byte("package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(old, []byte("gone\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	text := "--- a/" + source + "\n+++ b/" + source + "\n" +
+		"@@ -3,3 +3,3 @@\n func main() {\n-  println(\"hi\")\n+\tprintln(\"hello\")\n }\n" +
+		"@@ -9,1 +9,1 @@\n-missing\n+whatever\n" +
+		"--- /dev/null\n+++ b/" + created + "\n@@ -0,0 +1 @@\n+new\n" +
+		"--- a/" + old + "\n+++ /dev/null\n@@ -1 +0,0 @@\n-gone\n"
+	args := map[string]interface{}{"patch": text}
+
+	if preview := previewChange("apply_patch", args); !strings.Contains(preview, "+\tprintln(\"hello\")") || !strings.Contains(preview, "+new") {
+		t.Errorf("preview is missing changes:\n%s", preview)
+	}
+
+	result, err := toolApplyPatch(args)
+	if err != nil {
+		t.Fatalf("toolApplyPatch: %v", err)
+	}
+	for _, want := range []string{
+		"Applied 2 of 3 hunks to 3 files; resend only the failed hunks",
+		"hunk 1: applied at line 3 (ignoring whitespace)",
+		"hunk 2: failed: could not find",
+		"Created ",
+		"Deleted ",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("result is missing %q:\n%s", want, result)
+		}
+	}
+
+	data, _ := os.ReadFile(source)
+	if !strings.Contains(string(data), "\tprintln(\"hello\")") {
+		t.Errorf("main.go = %q", data)
+	}
+	if data, _ := os.ReadFile(created); string(data) != "new\n" {
+		t.Errorf("new.txt = %q", data)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("old.txt should be deleted, stat err = %v", err)
+	}
+
+	if result, _ := toolApplyPatch(map[string]interface{}{"patch": "nonsense"}); !strings.HasPrefix(result, "error: ") {
+		t.Errorf("result = %q, want a parse error", result)
+	}
+}
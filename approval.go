@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/gotha/bitca/backend"
+	"github.com/gotha/bitca/patch"
+	"github.com/gotha/bitca/permission"
+)
+
+// readOnlyTools are the built-in tools that can't change anything
+var readOnlyTools = map[string]bool{
+	"read":        true,
+	"glob":        true,
+	"grep":        true,
+	"bash_output": true,
+}
+
+// approvalPrompt is a tool call waiting for the user to approve or deny it
+type approvalPrompt struct {
+	index      int // index into model.pendingCalls
+	call       backend.ToolCall
+	suggestion permission.Rule // rule added by "always allow"
+	preview    string          // colored diff of the change for write and edit
+}
+
+// approvalPreviewLines caps the diff shown with an approval prompt
+const approvalPreviewLines = 12
+
+// subcommandPattern matches subcommands such as "test" in "go test"
+var subcommandPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// shellSeparator splits compound shell commands into the commands they run
+var shellSeparator = regexp.MustCompile(`&&|\|\||[;|&\n]`)
+
+// toolSubject returns the argument permission rules match against: the
+// command for bash, the path for file tools, the pattern for searches and
+// the JSON arguments for anything else
+func toolSubject(name string, args map[string]interface{}) string {
+	key := ""
+	switch name {
+	case "bash":
+		key = "cmd"
+	case "read", "write", "edit":
+		key = "path"
+	case "glob", "grep":
+		key = "pat"
+	}
+	if key != "" {
+		s, _ := args[key].(string)
+		return s
+	}
+
+	data, _ := json.Marshal(args)
+	return string(data)
+}
+
+// checkToolCall decides whether a tool call may run under the policy.
+// Compound bash commands are checked command by command so that an allow
+// rule like bash(go test *) can't approve "go test && rm -rf ~".
+func checkToolCall(policy *permission.Policy, call backend.ToolCall) (permission.Decision, string) {
+	if policy == nil {
+		return permission.Allow, ""
+	}
+
+	if call.Name == "apply_patch" {
+		return checkPatchPaths(policy, call.Arguments)
+	}
+
+	subject := toolSubject(call.Name, call.Arguments)
+	if call.Name != "bash" {
+		decision, rule := policy.Check(call.Name, subject, readOnlyTools[call.Name])
+		return decision, denyReason(decision, rule)
+	}
+
+	// Command and process substitution could run anything and a redirection
+	// can overwrite any file, so only the mode can allow them
+	substitution := strings.Contains(subject, "$(") || strings.Contains(subject, "`") ||
+		strings.Contains(subject, "<(") || strings.Contains(subject, ">(") || writesFile(subject)
+
+	// Redirections like 2>&1 are not separators
+	subject = strings.NewReplacer(">&", ">", "&>", ">").Replace(subject)
+
+	result := permission.Allow
+	checked := false
+	for _, part := range shellSeparator.Split(subject, -1) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		checked = true
+		decision, rule := policy.Check(call.Name, part, false)
+		if decision == permission.Deny {
+			return decision, denyReason(decision, rule)
+		}
+		if decision == permission.Ask || (substitution && rule != nil) {
+			result = permission.Ask
+		}
+	}
+	// A call without a command, such as a restart, is still up to the policy
+	if !checked {
+		decision, rule := policy.Check(call.Name, strings.TrimSpace(subject), false)
+		return decision, denyReason(decision, rule)
+	}
+	return result, ""
+}
+
+// writesFile reports whether a command redirects output to a file. Copying
+// descriptors (2>&1, >&2, >&-) and discarding output (>/dev/null) don't count.
+func writesFile(cmd string) bool {
+	for i := 0; i < len(cmd); i++ {
+		if cmd[i] != '>' {
+			continue
+		}
+		// >> and >| write just the same
+		rest := strings.TrimPrefix(strings.TrimPrefix(cmd[i+1:], ">"), "|")
+		if target, ok := strings.CutPrefix(rest, "&"); ok {
+			if target != "" && (target[0] == '-' || (target[0] >= '0' && target[0] <= '9')) {
+				continue
+			}
+			// >&name is the same as &>name
+			rest = target
+		}
+		target := strings.TrimLeft(rest, " \t")
+		if after, ok := strings.CutPrefix(target, "/dev/null"); ok && (after == "" || strings.ContainsAny(after[:1], " \t;&|)")) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// checkPatchPaths checks every file an apply_patch call touches, so that
+// rules like apply_patch(src/**) cover multi-file patches. A patch that
+// can't be parsed changes nothing; the tool reports the problem.
+func checkPatchPaths(policy *permission.Policy, args map[string]interface{}) (permission.Decision, string) {
+	text, _ := args["patch"].(string)
+	patches, err := patch.Parse(text)
+	if err != nil {
+		decision, rule := policy.Check("apply_patch", "", false)
+		return decision, denyReason(decision, rule)
+	}
+
+	result := permission.Allow
+	for _, p := range patches {
+		paths := []string{p.Path()}
+		if p.OldPath != p.NewPath && !p.IsNew() && !p.IsDelete() {
+			paths = append(paths, p.OldPath)
+		}
+		for _, path := range paths {
+			decision, rule := policy.Check("apply_patch", path, false)
+			if decision == permission.Deny {
+				return decision, denyReason(decision, rule)
+			}
+			if decision == permission.Ask {
+				result = permission.Ask
+			}
+		}
+	}
+	return result, ""
+}
+
+func denyReason(decision permission.Decision, rule *permission.Rule) string {
+	if decision != permission.Deny || rule == nil {
+		return ""
+	}
+	return fmt.Sprintf("denied by permission rule %s", rule)
+}
+
+// suggestRule returns the rule "always allow" adds for a call: the command
+// prefix for bash, the directory for file tools, or the whole tool otherwise
+func suggestRule(call backend.ToolCall) permission.Rule {
+	subject := toolSubject(call.Name, call.Arguments)
+
+	switch call.Name {
+	case "bash":
+		fields := strings.Fields(subject)
+		if len(fields) == 0 {
+			break
+		}
+		prefix := fields[0]
+		// Keep a subcommand such as "go test" or "git status"
+		if len(fields) > 1 && subcommandPattern.MatchString(fields[1]) {
+			prefix += " " + fields[1]
+		}
+		return permission.Rule{Tool: call.Name, Pattern: prefix + " *"}
+	case "write", "edit":
+		if dir := filepath.Dir(subject); subject != "" && dir != "." {
+			return permission.Rule{Tool: call.Name, Pattern: filepath.Join(dir, "*")}
+		}
+	}
+	return permission.Rule{Tool: call.Name}
+}
+
+// reviewToolCalls checks the pending tool calls from index start on. It
+// stops at the first call that needs the user's approval and otherwise
+// starts executing them.
+func (m *model) reviewToolCalls(start int) tea.Cmd {
+	for i := start; i < len(m.pendingCalls); i++ {
+		call := m.pendingCalls[i]
+		decision, reason := checkToolCall(m.permissions, call)
+		switch decision {
+		case permission.Deny:
+			m.denials[i] = reason
+		case permission.Ask:
+			m.approval = &approvalPrompt{index: i, call: call, suggestion: suggestRule(call)}
+			if diff := previewChange(call.Name, call.Arguments); diff != "" {
+				preview, hidden := previewLines(strings.TrimRight(diff, "\n"), approvalPreviewLines, m.width-8)
+				if hidden > 0 {
+					preview += fmt.Sprintf("\n… %d more lines", hidden)
+				}
+				m.approval.preview = colorDiff(preview)
+			}
+			m.layout()
+			m.updateViewportContent()
+			return nil
+		}
+	}
+
+	calls, denials := m.pendingCalls, m.denials
+	m.pendingCalls = nil
+	m.denials = nil
+	m.approval = nil
+	m.layout()
+	m.updateViewportContent()
+	return m.executeTools(m.turnCtx, calls, denials)
+}
+
+// answerApproval handles a key press while a tool call waits for approval
+func (m *model) answerApproval(key string) tea.Cmd {
+	prompt := m.approval
+	switch key {
+	case "y", "Y", "enter":
+	case "n", "N":
+		m.denials[prompt.index] = "denied by the user"
+		m.addEntry(entrySystem, fmt.Sprintf("Denied %s", prompt.call.Name))
+	case "a", "A":
+		if err := m.permissions.AddAllow(prompt.suggestion); err != nil {
+			m.addEntry(entryError, err.Error())
+		} else {
+			m.addEntry(entrySystem, fmt.Sprintf("Always allowing %s (saved to %s)",
+				prompt.suggestion, m.permissions.Path()))
+		}
+	default:
+		return nil
+	}
+
+	m.approval = nil
+	return m.reviewToolCalls(prompt.index + 1)
+}
+
+// approvalText describes the pending approval for the status area
+func (p approvalPrompt) approvalText() string {
+	subject := toolSubject(p.call.Name, p.call.Arguments)
+	if len(subject) > 200 {
+		subject = subject[:200] + "..."
+	}
+	return fmt.Sprintf("Allow %s: %s?\n[y] yes  [n] no  [a] always allow %s  [Esc] cancel",
+		p.call.Name, subject, p.suggestion)
+}
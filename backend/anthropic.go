@@ -0,0 +1,536 @@
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// anthropicAPIVersion is the Messages API version sent with every request
+const anthropicAPIVersion = "2023-06-01"
+
+// anthropicDefaultMaxTokens is used because the Messages API requires max_tokens
+const anthropicDefaultMaxTokens = 8192
+
+// AnthropicBackend implements the Backend interface for the Anthropic Messages API
+type AnthropicBackend struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// NewAnthropicBackend creates a new Anthropic backend
+func NewAnthropicBackend(apiKey, baseURL string) (*AnthropicBackend, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("Anthropic API key is required")
+	}
+	if baseURL == "" {
+		baseURL = "https://api.anthropic.com/v1"
+	}
+	return &AnthropicBackend{
+		apiKey:  apiKey,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{},
+	}, nil
+}
+
+// Name returns the backend name
+func (a *AnthropicBackend) Name() string {
+	return "anthropic"
+}
+
+// Anthropic API request/response types
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	MaxTokens int                `json:"max_tokens"`
+	System    string             `json:"system,omitempty"`
+	Messages  []anthropicMessage `json:"messages"`
+	Tools     []anthropicTool    `json:"tools,omitempty"`
+	Stream    bool               `json:"stream"`
+}
+
+type anthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
+
+type anthropicContentBlock struct {
+	Type string `json:"type"`
+
+	// text blocks
+	Text string `json:"text,omitempty"`
+
+	// tool_use blocks
+	ID    string      `json:"id,omitempty"`
+	Name  string      `json:"name,omitempty"`
+	Input interface{} `json:"input,omitempty"`
+
+	// tool_result blocks; the content is a string, or blocks when the
+	// result has images
+	ToolUseID string      `json:"tool_use_id,omitempty"`
+	Content   interface{} `json:"content,omitempty"`
+
+	// image blocks
+	Source *anthropicImageSource `json:"source,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"` // always base64
+	MediaType string `json:"media_type"`
+	Data      []byte `json:"data"` // encoded as base64 by encoding/json
+}
+
+type anthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+type anthropicResponse struct {
+	ID         string                  `json:"id"`
+	Content    []anthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      *anthropicUsage         `json:"usage,omitempty"`
+	Error      *anthropicError         `json:"error,omitempty"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// toUsage converts Anthropic usage; cached input still occupies the context
+func (u *anthropicUsage) toUsage() *Usage {
+	if u == nil {
+		return nil
+	}
+	return &Usage{
+		PromptTokens:     u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+		CompletionTokens: u.OutputTokens,
+	}
+}
+
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// anthropicStreamEvent covers every SSE event type; unused fields stay zero
+type anthropicStreamEvent struct {
+	Type         string                `json:"type"`
+	Index        int                   `json:"index"`
+	ContentBlock anthropicContentBlock `json:"content_block"`
+	Delta        anthropicStreamDelta  `json:"delta"`
+	Message      *anthropicResponse    `json:"message,omitempty"`
+	Usage        *anthropicUsage       `json:"usage,omitempty"`
+	Error        *anthropicError       `json:"error,omitempty"`
+}
+
+type anthropicStreamDelta struct {
+	Type        string `json:"type"`
+	Text        string `json:"text,omitempty"`
+	PartialJSON string `json:"partial_json,omitempty"`
+	StopReason  string `json:"stop_reason,omitempty"`
+}
+
+// Chat sends a chat request to the Anthropic Messages API
+func (a *AnthropicBackend) Chat(ctx context.Context, model string, messages []Message, tools []Tool, stream bool,
+	callback func(StreamChunk) error) error {
+
+	system, anthropicMessages := convertMessagesToAnthropic(messages)
+
+	req := anthropicRequest{
+		Model:     model,
+		MaxTokens: anthropicDefaultMaxTokens,
+		System:    system,
+		Messages:  anthropicMessages,
+		Stream:    stream,
+	}
+
+	for _, tool := range tools {
+		schema := tool.Parameters
+		if schema == nil {
+			schema = map[string]interface{}{"type": "object"}
+		}
+		req.Tools = append(req.Tools, anthropicTool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: schema,
+		})
+	}
+
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", a.baseURL+"/messages", bytes.NewReader(reqBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", a.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicAPIVersion)
+
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	if stream {
+		return a.handleStreamingResponse(resp.Body, callback)
+	}
+	return a.handleNonStreamingResponse(resp.Body, callback)
+}
+
+// convertMessagesToAnthropic splits out the system prompt and converts the
+// remaining messages into Anthropic content blocks. Tool results become
+// tool_result blocks inside a user turn, and consecutive messages with the
+// same role are merged because the API expects alternating turns.
+func convertMessagesToAnthropic(messages []Message) (string, []anthropicMessage) {
+	var systemParts []string
+	var result []anthropicMessage
+
+	// Tool calls without an ID (e.g. from Ollama) get a synthetic one, and the
+	// following tool results are matched to them in order
+	var pendingIDs []string
+	renamed := make(map[string]string)
+	generated := 0
+
+	appendBlocks := func(role string, blocks ...anthropicContentBlock) {
+		if len(blocks) == 0 {
+			return
+		}
+		if n := len(result); n > 0 && result[n-1].Role == role {
+			result[n-1].Content = append(result[n-1].Content, blocks...)
+			return
+		}
+		result = append(result, anthropicMessage{Role: role, Content: blocks})
+	}
+
+	for _, msg := range messages {
+		switch msg.Role {
+		case "system":
+			if msg.Content != "" {
+				systemParts = append(systemParts, msg.Content)
+			}
+
+		case "assistant":
+			var blocks []anthropicContentBlock
+			if msg.Content != "" {
+				blocks = append(blocks, anthropicContentBlock{Type: "text", Text: msg.Content})
+			}
+			pendingIDs = pendingIDs[:0]
+			for _, tc := range msg.ToolCalls {
+				id := tc.ID
+				if !isValidAnthropicToolID(id) {
+					generated++
+					id = fmt.Sprintf("toolu_bitca_%d", generated)
+					if tc.ID != "" {
+						renamed[tc.ID] = id
+					}
+				}
+				pendingIDs = append(pendingIDs, id)
+				input := tc.Arguments
+				if input == nil {
+					input = map[string]interface{}{}
+				}
+				blocks = append(blocks, anthropicContentBlock{
+					Type:  "tool_use",
+					ID:    id,
+					Name:  tc.Name,
+					Input: input,
+				})
+			}
+			appendBlocks("assistant", blocks...)
+
+		case "tool":
+			id := msg.ToolCallID
+			if mapped, ok := renamed[id]; ok {
+				id = mapped
+			}
+			if !containsString(pendingIDs, id) && len(pendingIDs) > 0 {
+				id = pendingIDs[0]
+			}
+			pendingIDs = removeString(pendingIDs, id)
+			var content interface{} = msg.Content
+			if len(msg.Images) > 0 {
+				// The API rejects text blocks without text
+				var blocks []anthropicContentBlock
+				if msg.Content != "" {
+					blocks = append(blocks, anthropicContentBlock{Type: "text", Text: msg.Content})
+				}
+				for _, image := range msg.Images {
+					blocks = append(blocks, anthropicContentBlock{
+						Type:   "image",
+						Source: &anthropicImageSource{Type: "base64", MediaType: image.MediaType, Data: image.Data},
+					})
+				}
+				content = blocks
+			}
+			appendBlocks("user", anthropicContentBlock{
+				Type:      "tool_result",
+				ToolUseID: id,
+				Content:   content,
+			})
+
+		default:
+			if msg.Content != "" {
+				appendBlocks("user", anthropicContentBlock{Type: "text", Text: msg.Content})
+			}
+		}
+	}
+
+	return strings.Join(systemParts, "\n\n"), result
+}
+
+// isValidAnthropicToolID reports whether id matches the API's tool_use ID format
+func isValidAnthropicToolID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// handleNonStreamingResponse processes a non-streaming response
+func (a *AnthropicBackend) handleNonStreamingResponse(body io.Reader, callback func(StreamChunk) error) error {
+	var resp anthropicResponse
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if resp.Error != nil {
+		return fmt.Errorf("API error: %s", resp.Error.Message)
+	}
+
+	chunk := StreamChunk{Done: true, Usage: resp.Usage.toUsage()}
+	var text strings.Builder
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			args, _ := block.Input.(map[string]interface{})
+			if args == nil {
+				args = map[string]interface{}{}
+			}
+			chunk.ToolCalls = append(chunk.ToolCalls, ToolCall{
+				ID:        block.ID,
+				Name:      block.Name,
+				Arguments: args,
+			})
+		}
+	}
+	chunk.Content = text.String()
+
+	return callback(chunk)
+}
+
+// handleStreamingResponse processes an SSE streaming response
+func (a *AnthropicBackend) handleStreamingResponse(body io.Reader, callback func(StreamChunk) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	// Tool use blocks are keyed by content block index; their input arrives
+	// as partial JSON fragments that are only valid once the block stops
+	toolBlocks := make(map[int]*ToolCall)
+	toolInput := make(map[int]*strings.Builder)
+	var order []int
+
+	// Input tokens arrive with message_start, output tokens with message_delta
+	var usage *Usage
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Event names are repeated in the data payload, so only data lines matter
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+			continue // Skip malformed chunks
+		}
+
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil {
+				usage = event.Message.Usage.toUsage()
+			}
+
+		case "message_delta":
+			if event.Usage != nil {
+				if usage == nil {
+					usage = &Usage{}
+				}
+				usage.CompletionTokens = event.Usage.OutputTokens
+			}
+
+		case "content_block_start":
+			if event.ContentBlock.Type == "tool_use" {
+				toolBlocks[event.Index] = &ToolCall{
+					ID:   event.ContentBlock.ID,
+					Name: event.ContentBlock.Name,
+				}
+				toolInput[event.Index] = &strings.Builder{}
+				order = append(order, event.Index)
+			}
+
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				if event.Delta.Text != "" {
+					if err := callback(StreamChunk{Content: event.Delta.Text}); err != nil {
+						return err
+					}
+				}
+			case "input_json_delta":
+				if b, ok := toolInput[event.Index]; ok {
+					b.WriteString(event.Delta.PartialJSON)
+				}
+			}
+
+		case "content_block_stop":
+			if tc, ok := toolBlocks[event.Index]; ok {
+				args := make(map[string]interface{})
+				if raw := toolInput[event.Index].String(); raw != "" {
+					if err := json.Unmarshal([]byte(raw), &args); err != nil {
+						args = map[string]interface{}{"_raw": raw}
+					}
+				}
+				tc.Arguments = args
+			}
+
+		case "message_stop":
+			return callback(StreamChunk{Done: true, ToolCalls: collectToolCalls(toolBlocks, order), Usage: usage})
+
+		case "error":
+			if event.Error != nil {
+				return fmt.Errorf("API error: %s", event.Error.Message)
+			}
+			return fmt.Errorf("API error: unknown streaming error")
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// Stream ended without message_stop; still surface what we have
+	return callback(StreamChunk{Done: true, ToolCalls: collectToolCalls(toolBlocks, order), Usage: usage})
+}
+
+// collectToolCalls returns the accumulated tool calls in block order
+func collectToolCalls(blocks map[int]*ToolCall, order []int) []ToolCall {
+	var toolCalls []ToolCall
+	for _, idx := range order {
+		tc := blocks[idx]
+		if tc.Arguments == nil {
+			tc.Arguments = map[string]interface{}{}
+		}
+		toolCalls = append(toolCalls, *tc)
+	}
+	return toolCalls
+}
+
+// anthropicModelList is the response of GET /models
+type anthropicModelList struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+	HasMore bool   `json:"has_more"`
+	LastID  string `json:"last_id"`
+}
+
+// ListModels returns the models available to the API key (/v1/models)
+func (a *AnthropicBackend) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	var models []ModelInfo
+	afterID := ""
+
+	for {
+		query := url.Values{"limit": {"1000"}}
+		if afterID != "" {
+			query.Set("after_id", afterID)
+		}
+
+		httpReq, err := http.NewRequestWithContext(ctx, "GET", a.baseURL+"/models?"+query.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		httpReq.Header.Set("x-api-key", a.apiKey)
+		httpReq.Header.Set("anthropic-version", anthropicAPIVersion)
+
+		resp, err := a.client.Do(httpReq)
+		if err != nil {
+			return nil, fmt.Errorf("request failed: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		}
+
+		var list anthropicModelList
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+
+		for _, m := range list.Data {
+			models = append(models, ModelInfo{Name: m.ID})
+		}
+
+		if !list.HasMore || list.LastID == "" {
+			return models, nil
+		}
+		afterID = list.LastID
+	}
+}
+
+// containsString reports whether s is in list
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// removeString returns list without the first occurrence of s
+func removeString(list []string, s string) []string {
+	for i, v := range list {
+		if v == s {
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+// Close cleans up resources
+func (a *AnthropicBackend) Close() error {
+	return nil
+}
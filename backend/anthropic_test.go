@@ -0,0 +1,160 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConvertMessagesToAnthropic(t *testing.T) {
+	messages := []Message{
+		{Role: "system", Content: "be helpful"},
+		{Role: "user", Content: "list files"},
+		{Role: "assistant", ToolCalls: []ToolCall{
+			{Name: "glob", Arguments: map[string]interface{}{"pat": "*.go"}},
+			{Name: "bash", Arguments: map[string]interface{}{"cmd": "ls"}},
+		}},
+		{Role: "tool", Content: "main.go"},
+		{Role: "tool", Content: "README.md"},
+	}
+
+	system, converted := convertMessagesToAnthropic(messages)
+	if system != "be helpful" {
+		t.Errorf("system = %q, want %q", system, "be helpful")
+	}
+	if len(converted) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(converted))
+	}
+
+	assistant := converted[1]
+	if assistant.Role != "assistant" || len(assistant.Content) != 2 {
+		t.Fatalf("unexpected assistant message: %+v", assistant)
+	}
+
+	// Both tool results must be merged into one user turn and linked in order
+	results := converted[2]
+	if results.Role != "user" || len(results.Content) != 2 {
+		t.Fatalf("expected merged user turn with 2 tool results, got %+v", results)
+	}
+	for i, block := range results.Content {
+		if block.Type != "tool_result" {
+			t.Errorf("block %d type = %q, want tool_result", i, block.Type)
+		}
+		if block.ToolUseID != assistant.Content[i].ID {
+			t.Errorf("block %d tool_use_id = %q, want %q", i, block.ToolUseID, assistant.Content[i].ID)
+		}
+	}
+}
+
+func TestConvertToolResultImagesToAnthropic(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "what is in cat.png?"},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "toolu_01", Name: "read"}}},
+		{Role: "tool", ToolCallID: "toolu_01", Content: "Image cat.png", Images: []Image{{MediaType: "image/png", Data: []byte("png")}}},
+	}
+
+	_, converted := convertMessagesToAnthropic(messages)
+	data, err := json.Marshal(converted[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_01","content":[` +
+		`{"type":"text","text":"Image cat.png"},` +
+		`{"type":"image","source":{"type":"base64","media_type":"image/png","data":"cG5n"}}]}]}`
+	if string(data) != want {
+		t.Errorf("got  %s\nwant %s", data, want)
+	}
+
+	// Without text only the image is sent
+	messages[2].Content = ""
+	_, converted = convertMessagesToAnthropic(messages)
+	data, _ = json.Marshal(converted[2])
+	if strings.Contains(string(data), `"type":"text"`) {
+		t.Errorf("empty text block sent: %s", data)
+	}
+}
+
+func TestAnthropicStreamingToolUse(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":40,"cache_read_input_tokens":10,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me "}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"check."}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_01","name":"read"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"path\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"go.mod\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":25}}`,
+		`{"type":"message_stop"}`,
+	}
+
+	var gotReq anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/messages" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "test-key" {
+			t.Errorf("missing x-api-key header")
+		}
+		if err := json.NewDecoder(r.Body).Decode(&gotReq); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range events {
+			var typ struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal([]byte(e), &typ)
+			w.Write([]byte("event: " + typ.Type + "\ndata: " + e + "\n\n"))
+		}
+	}))
+	defer server.Close()
+
+	b, err := NewAnthropicBackend("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("NewAnthropicBackend: %v", err)
+	}
+
+	messages := []Message{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "read go.mod"},
+	}
+	tools := []Tool{{Name: "read", Description: "Read file", Parameters: map[string]interface{}{"type": "object"}}}
+
+	var content strings.Builder
+	var toolCalls []ToolCall
+	var usage *Usage
+	err = b.Chat(context.Background(), "claude-test", messages, tools, true, func(chunk StreamChunk) error {
+		content.WriteString(chunk.Content)
+		if len(chunk.ToolCalls) > 0 {
+			toolCalls = chunk.ToolCalls
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+
+	if gotReq.System != "sys" || len(gotReq.Messages) != 1 || gotReq.MaxTokens == 0 {
+		t.Errorf("unexpected request: %+v", gotReq)
+	}
+	if content.String() != "Let me check." {
+		t.Errorf("content = %q, want %q", content.String(), "Let me check.")
+	}
+	if len(toolCalls) != 1 {
+		t.Fatalf("expected 1 tool call, got %d", len(toolCalls))
+	}
+	if toolCalls[0].ID != "toolu_01" || toolCalls[0].Name != "read" || toolCalls[0].Arguments["path"] != "go.mod" {
+		t.Errorf("unexpected tool call: %+v", toolCalls[0])
+	}
+	if usage == nil || usage.PromptTokens != 50 || usage.CompletionTokens != 25 {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+}
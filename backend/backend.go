@@ -1,20 +1,31 @@
 package backend
 
-import "context"
+import (
+	"context"
+	"fmt"
+)
 
 // Message represents a chat message
 type Message struct {
-	Role       string
-	Content    string
-	ToolCalls  []ToolCall
-	ToolCallID string // For tool response messages (required by OpenAI)
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"` // For tool response messages (required by OpenAI)
+	Images     []Image    `json:"-"`                      // For models that can see images; not saved with the session
+}
+
+// Image is an image attached to a message
+type Image struct {
+	MediaType string `json:"media_type"` // e.g. image/png
+	Data      []byte `json:"data"`
 }
 
 // ToolCall represents a tool invocation request
 type ToolCall struct {
-	ID        string
-	Name      string
-	Arguments map[string]interface{}
+	ID        string                 `json:"id,omitempty"`
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Signature string                 `json:"signature,omitempty"` // Opaque data the backend needs back with the call (Gemini's thought signature)
 }
 
 // Tool represents a tool definition
@@ -24,11 +35,24 @@ type Tool struct {
 	Parameters  map[string]interface{} // JSON Schema
 }
 
+// Usage reports token counts for a single request
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
 // StreamChunk represents a streaming response chunk
 type StreamChunk struct {
 	Content   string
 	ToolCalls []ToolCall
 	Done      bool
+	Usage     *Usage // Set on the final chunk when the backend reports usage
+}
+
+// ModelInfo describes a model available on a backend
+type ModelInfo struct {
+	Name string
+	Size int64 // Size in bytes, 0 if unknown (only local backends report it)
 }
 
 // Backend defines the interface for LLM backends
@@ -41,7 +65,44 @@ type Backend interface {
 	Chat(ctx context.Context, model string, messages []Message, tools []Tool, stream bool,
 		callback func(StreamChunk) error) error
 
+	// ListModels returns the models installed on or offered by the backend
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+
 	// Close cleans up any resources
 	Close() error
 }
 
+// NormalizeToolCallIDs returns a copy of messages in which every tool call has
+// an ID and every tool result references one. Backends such as Ollama leave
+// IDs empty, while OpenAI rejects tool results without a matching ID, so a
+// history must be normalized before it is moved between backends. Results
+// without a known ID are linked to the outstanding calls in order.
+func NormalizeToolCallIDs(messages []Message) []Message {
+	result := make([]Message, len(messages))
+	var pending []string
+	generated := 0
+
+	for i, msg := range messages {
+		switch {
+		case len(msg.ToolCalls) > 0:
+			msg.ToolCalls = append([]ToolCall(nil), msg.ToolCalls...)
+			pending = pending[:0]
+			for j := range msg.ToolCalls {
+				if msg.ToolCalls[j].ID == "" {
+					generated++
+					msg.ToolCalls[j].ID = fmt.Sprintf("call_bitca_%d", generated)
+				}
+				pending = append(pending, msg.ToolCalls[j].ID)
+			}
+
+		case msg.Role == "tool":
+			if !containsString(pending, msg.ToolCallID) && len(pending) > 0 {
+				msg.ToolCallID = pending[0]
+			}
+			pending = removeString(pending, msg.ToolCallID)
+		}
+		result[i] = msg
+	}
+
+	return result
+}
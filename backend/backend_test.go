@@ -0,0 +1,33 @@
+package backend
+
+import "testing"
+
+func TestNormalizeToolCallIDs(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", ToolCalls: []ToolCall{{Name: "read"}, {ID: "keep", Name: "bash"}}},
+		{Role: "tool", ToolCallID: "keep", Content: "bash output"},
+		{Role: "tool", Content: "read output"},
+	}
+
+	normalized := NormalizeToolCallIDs(messages)
+
+	calls := normalized[1].ToolCalls
+	if calls[0].ID == "" {
+		t.Fatal("expected generated ID for tool call without one")
+	}
+	if calls[1].ID != "keep" {
+		t.Errorf("existing ID changed to %q", calls[1].ID)
+	}
+	if normalized[2].ToolCallID != "keep" {
+		t.Errorf("tool result ID = %q, want keep", normalized[2].ToolCallID)
+	}
+	if normalized[3].ToolCallID != calls[0].ID {
+		t.Errorf("tool result ID = %q, want %q", normalized[3].ToolCallID, calls[0].ID)
+	}
+
+	// The input history must not be modified
+	if messages[1].ToolCalls[0].ID != "" || messages[3].ToolCallID != "" {
+		t.Error("NormalizeToolCallIDs modified its input")
+	}
+}
@@ -0,0 +1,508 @@
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GeminiBackend implements the Backend interface for the Gemini generateContent API
+type GeminiBackend struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// NewGeminiBackend creates a new Gemini backend
+func NewGeminiBackend(apiKey, baseURL string) (*GeminiBackend, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("Gemini API key is required")
+	}
+	if baseURL == "" {
+		baseURL = "https://generativelanguage.googleapis.com/v1beta"
+	}
+	return &GeminiBackend{
+		apiKey:  apiKey,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{},
+	}, nil
+}
+
+// Name returns the backend name
+func (g *GeminiBackend) Name() string {
+	return "gemini"
+}
+
+// Gemini API request/response types
+type geminiRequest struct {
+	SystemInstruction *geminiContent  `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent `json:"contents"`
+	Tools             []geminiTool    `json:"tools,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+
+	// Thinking models sign their function calls and need the signature
+	// back with the call in later requests
+	ThoughtSignature string `json:"thoughtSignature,omitempty"`
+}
+
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     []byte `json:"data"` // encoded as base64 by encoding/json
+}
+
+type geminiFunctionCall struct {
+	ID   string                 `json:"id,omitempty"`
+	Name string                 `json:"name"`
+	Args map[string]interface{} `json:"args"`
+}
+
+type geminiFunctionResponse struct {
+	ID       string                 `json:"id,omitempty"`
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type geminiResponse struct {
+	Candidates    []geminiCandidate    `json:"candidates"`
+	UsageMetadata *geminiUsageMetadata `json:"usageMetadata,omitempty"`
+	Error         *geminiError         `json:"error,omitempty"`
+}
+
+type geminiUsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+}
+
+// toUsage converts Gemini usage metadata
+func (u *geminiUsageMetadata) toUsage() *Usage {
+	if u == nil {
+		return nil
+	}
+	return &Usage{PromptTokens: u.PromptTokenCount, CompletionTokens: u.CandidatesTokenCount}
+}
+
+type geminiCandidate struct {
+	Content      geminiContent `json:"content"`
+	FinishReason string        `json:"finishReason"`
+}
+
+type geminiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+// Chat sends a chat request to Gemini
+func (g *GeminiBackend) Chat(ctx context.Context, model string, messages []Message, tools []Tool, stream bool,
+	callback func(StreamChunk) error) error {
+
+	system, contents := convertMessagesToGemini(messages)
+
+	req := geminiRequest{
+		SystemInstruction: system,
+		Contents:          contents,
+	}
+
+	if len(tools) > 0 {
+		decls := make([]geminiFunctionDeclaration, len(tools))
+		for i, tool := range tools {
+			decls[i] = geminiFunctionDeclaration{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  convertSchemaToGemini(tool.Parameters),
+			}
+		}
+		req.Tools = []geminiTool{{FunctionDeclarations: decls}}
+	}
+
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/models/%s:generateContent", g.baseURL, model)
+	if stream {
+		endpoint = fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse", g.baseURL, model)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(reqBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-goog-api-key", g.apiKey)
+
+	resp, err := g.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	if stream {
+		return g.handleStreamingResponse(resp.Body, callback)
+	}
+	return g.handleNonStreamingResponse(resp.Body, callback)
+}
+
+// convertMessagesToGemini converts messages into Gemini contents. Gemini has
+// no tool call IDs, so each tool result is matched to a call from the
+// preceding assistant turn: by ID when it matches, otherwise in order. The
+// matched call supplies the function name Gemini needs in functionResponse.
+func convertMessagesToGemini(messages []Message) (*geminiContent, []geminiContent) {
+	var systemParts []geminiPart
+	var contents []geminiContent
+	var pending []ToolCall
+
+	appendParts := func(role string, parts ...geminiPart) {
+		if len(parts) == 0 {
+			return
+		}
+		if n := len(contents); n > 0 && contents[n-1].Role == role {
+			contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+			return
+		}
+		contents = append(contents, geminiContent{Role: role, Parts: parts})
+	}
+
+	for _, msg := range messages {
+		switch msg.Role {
+		case "system":
+			if msg.Content != "" {
+				systemParts = append(systemParts, geminiPart{Text: msg.Content})
+			}
+
+		case "assistant":
+			var parts []geminiPart
+			if msg.Content != "" {
+				parts = append(parts, geminiPart{Text: msg.Content})
+			}
+			pending = append(pending[:0], msg.ToolCalls...)
+			for _, tc := range msg.ToolCalls {
+				args := tc.Arguments
+				if args == nil {
+					args = map[string]interface{}{}
+				}
+				parts = append(parts, geminiPart{
+					FunctionCall:     &geminiFunctionCall{Name: tc.Name, Args: args},
+					ThoughtSignature: tc.Signature,
+				})
+			}
+			appendParts("model", parts...)
+
+		case "tool":
+			name := "unknown"
+			idx := -1
+			for i, tc := range pending {
+				if tc.ID != "" && tc.ID == msg.ToolCallID {
+					idx = i
+					break
+				}
+			}
+			if idx < 0 && len(pending) > 0 {
+				idx = 0
+			}
+			if idx >= 0 {
+				name = pending[idx].Name
+				pending = append(pending[:idx:idx], pending[idx+1:]...)
+			}
+			appendParts("user", geminiPart{FunctionResponse: &geminiFunctionResponse{
+				Name:     name,
+				Response: map[string]interface{}{"content": msg.Content},
+			}})
+			// Images go next to the response, which only holds JSON
+			for _, image := range msg.Images {
+				appendParts("user", geminiPart{InlineData: &geminiBlob{MimeType: image.MediaType, Data: image.Data}})
+			}
+
+		default:
+			if msg.Content != "" {
+				appendParts("user", geminiPart{Text: msg.Content})
+			}
+		}
+	}
+
+	if len(systemParts) == 0 {
+		return nil, contents
+	}
+	return &geminiContent{Parts: systemParts}, contents
+}
+
+// geminiSchemaKeys lists the JSON Schema keywords the Gemini Schema object accepts
+var geminiSchemaKeys = map[string]bool{
+	"type": true, "format": true, "description": true, "nullable": true,
+	"enum": true, "properties": true, "required": true, "items": true,
+	"minItems": true, "maxItems": true, "minimum": true, "maximum": true,
+}
+
+// convertSchemaToGemini maps a JSON Schema onto Gemini's OpenAPI subset:
+// unsupported keywords are dropped, types are upper-cased and a ["x", "null"]
+// type union becomes a nullable x
+func convertSchemaToGemini(schema map[string]interface{}) map[string]interface{} {
+	if schema == nil {
+		return nil
+	}
+
+	// Round-trip through JSON so typed values (e.g. Ollama property types)
+	// become plain maps, slices and strings
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil
+	}
+	var generic map[string]interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil
+	}
+
+	result := sanitizeGeminiSchema(generic)
+
+	// Gemini rejects object schemas with an empty properties map
+	if props, ok := result["properties"].(map[string]interface{}); ok && len(props) == 0 {
+		return nil
+	}
+	return result
+}
+
+func sanitizeGeminiSchema(schema map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for key, value := range schema {
+		if !geminiSchemaKeys[key] {
+			continue
+		}
+		switch key {
+		case "type":
+			switch t := value.(type) {
+			case string:
+				result["type"] = strings.ToUpper(t)
+			case []interface{}:
+				for _, v := range t {
+					s, _ := v.(string)
+					if s == "null" {
+						result["nullable"] = true
+					} else if s != "" && result["type"] == nil {
+						result["type"] = strings.ToUpper(s)
+					}
+				}
+			}
+		case "properties":
+			props, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			converted := make(map[string]interface{})
+			for name, prop := range props {
+				if propMap, ok := prop.(map[string]interface{}); ok {
+					converted[name] = sanitizeGeminiSchema(propMap)
+				}
+			}
+			result["properties"] = converted
+		case "items":
+			if itemMap, ok := value.(map[string]interface{}); ok {
+				result["items"] = sanitizeGeminiSchema(itemMap)
+			}
+		case "required":
+			// A nil required list round-trips as null, which Gemini rejects
+			if list, ok := value.([]interface{}); ok && len(list) > 0 {
+				result["required"] = list
+			}
+		default:
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// handleNonStreamingResponse processes a non-streaming response
+func (g *GeminiBackend) handleNonStreamingResponse(body io.Reader, callback func(StreamChunk) error) error {
+	var resp geminiResponse
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if resp.Error != nil {
+		return fmt.Errorf("API error: %s", resp.Error.Message)
+	}
+
+	if len(resp.Candidates) == 0 {
+		return fmt.Errorf("no candidates in response")
+	}
+
+	chunk := StreamChunk{Done: true, Usage: resp.UsageMetadata.toUsage()}
+	var text strings.Builder
+	for i, part := range resp.Candidates[0].Content.Parts {
+		text.WriteString(part.Text)
+		if part.FunctionCall != nil {
+			chunk.ToolCalls = append(chunk.ToolCalls, geminiToolCall(part, i))
+		}
+	}
+	chunk.Content = text.String()
+
+	return callback(chunk)
+}
+
+// handleStreamingResponse processes an SSE streaming response. Each event is a
+// complete GenerateContentResponse carrying the next parts of the candidate;
+// function calls always arrive whole.
+func (g *GeminiBackend) handleStreamingResponse(body io.Reader, callback func(StreamChunk) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var toolCalls []ToolCall
+
+	// Every event repeats the cumulative usage, so the last one wins
+	var usage *Usage
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		var resp geminiResponse
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &resp); err != nil {
+			continue // Skip malformed chunks
+		}
+
+		if resp.Error != nil {
+			return fmt.Errorf("API error: %s", resp.Error.Message)
+		}
+
+		if resp.UsageMetadata != nil {
+			usage = resp.UsageMetadata.toUsage()
+		}
+
+		if len(resp.Candidates) == 0 {
+			continue
+		}
+
+		var text strings.Builder
+		for _, part := range resp.Candidates[0].Content.Parts {
+			text.WriteString(part.Text)
+			if part.FunctionCall != nil {
+				toolCalls = append(toolCalls, geminiToolCall(part, len(toolCalls)))
+			}
+		}
+
+		if text.Len() > 0 {
+			if err := callback(StreamChunk{Content: text.String()}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return callback(StreamChunk{Done: true, ToolCalls: toolCalls, Usage: usage})
+}
+
+// geminiToolCall converts a part holding a Gemini function call,
+// synthesizing an ID when the API didn't provide one so the chat loop can
+// still link the result
+func geminiToolCall(part geminiPart, index int) ToolCall {
+	fc := part.FunctionCall
+	id := fc.ID
+	if id == "" {
+		id = fmt.Sprintf("gemini_call_%d", index)
+	}
+	args := fc.Args
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	return ToolCall{ID: id, Name: fc.Name, Arguments: args, Signature: part.ThoughtSignature}
+}
+
+// geminiModelList is the response of GET /models
+type geminiModelList struct {
+	Models []struct {
+		Name                       string   `json:"name"`
+		SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+	} `json:"models"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+// ListModels returns the models that support generateContent
+func (g *GeminiBackend) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	var models []ModelInfo
+	pageToken := ""
+
+	for {
+		endpoint := g.baseURL + "/models?pageSize=1000"
+		if pageToken != "" {
+			endpoint += "&pageToken=" + url.QueryEscape(pageToken)
+		}
+
+		httpReq, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		httpReq.Header.Set("x-goog-api-key", g.apiKey)
+
+		resp, err := g.client.Do(httpReq)
+		if err != nil {
+			return nil, fmt.Errorf("request failed: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		}
+
+		var list geminiModelList
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+
+		for _, m := range list.Models {
+			if containsString(m.SupportedGenerationMethods, "generateContent") {
+				models = append(models, ModelInfo{Name: strings.TrimPrefix(m.Name, "models/")})
+			}
+		}
+
+		if list.NextPageToken == "" {
+			return models, nil
+		}
+		pageToken = list.NextPageToken
+	}
+}
+
+// Close cleans up resources
+func (g *GeminiBackend) Close() error {
+	return nil
+}
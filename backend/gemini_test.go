@@ -0,0 +1,149 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConvertMessagesToGemini(t *testing.T) {
+	messages := []Message{
+		{Role: "system", Content: "be helpful"},
+		{Role: "user", Content: "look around"},
+		{Role: "assistant", Content: "Sure.", ToolCalls: []ToolCall{
+			{ID: "a", Name: "glob", Arguments: map[string]interface{}{"pat": "*.go"}},
+			{ID: "b", Name: "bash", Arguments: map[string]interface{}{"cmd": "pwd"}},
+		}},
+		// Results arrive out of order; "b" is linked by ID, the other by order
+		{Role: "tool", ToolCallID: "b", Content: "/tmp"},
+		{Role: "tool", Content: "main.go"},
+	}
+
+	system, contents := convertMessagesToGemini(messages)
+	if system == nil || len(system.Parts) != 1 || system.Parts[0].Text != "be helpful" {
+		t.Fatalf("unexpected system instruction: %+v", system)
+	}
+	if len(contents) != 3 {
+		t.Fatalf("expected 3 contents, got %d", len(contents))
+	}
+	if contents[1].Role != "model" || len(contents[1].Parts) != 3 {
+		t.Fatalf("unexpected model turn: %+v", contents[1])
+	}
+
+	responses := contents[2].Parts
+	if len(responses) != 2 {
+		t.Fatalf("expected 2 function responses, got %d", len(responses))
+	}
+	if responses[0].FunctionResponse.Name != "bash" || responses[1].FunctionResponse.Name != "glob" {
+		t.Errorf("responses linked to %q and %q, want bash and glob",
+			responses[0].FunctionResponse.Name, responses[1].FunctionResponse.Name)
+	}
+}
+
+func TestConvertSchemaToGemini(t *testing.T) {
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{"type": "string", "default": "."},
+			"n":    map[string]interface{}{"type": []string{"integer", "null"}},
+		},
+		"required": []string{"path"},
+	}
+
+	got := convertSchemaToGemini(schema)
+	if got["type"] != "OBJECT" {
+		t.Errorf("type = %v, want OBJECT", got["type"])
+	}
+	if _, ok := got["additionalProperties"]; ok {
+		t.Error("additionalProperties should be dropped")
+	}
+	props := got["properties"].(map[string]interface{})
+	path := props["path"].(map[string]interface{})
+	if _, ok := path["default"]; ok {
+		t.Error("default should be dropped")
+	}
+	n := props["n"].(map[string]interface{})
+	if n["type"] != "INTEGER" || n["nullable"] != true {
+		t.Errorf("unexpected nullable conversion: %v", n)
+	}
+
+	empty := map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	if convertSchemaToGemini(empty) != nil {
+		t.Error("expected nil parameters for an empty object schema")
+	}
+}
+
+func TestGeminiStreamingFunctionCall(t *testing.T) {
+	events := []string{
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"Reading "}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"now."},{"functionCall":{"name":"read","args":{"path":"go.mod"}},"thoughtSignature":"c2ln"}]},"finishReason":"STOP"}]}`,
+	}
+
+	var gotReq geminiRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models/gemini-test:streamGenerateContent" || r.URL.Query().Get("alt") != "sse" {
+			t.Errorf("unexpected URL %s", r.URL)
+		}
+		if r.Header.Get("x-goog-api-key") != "test-key" {
+			t.Errorf("missing x-goog-api-key header")
+		}
+		if err := json.NewDecoder(r.Body).Decode(&gotReq); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range events {
+			w.Write([]byte("data: " + e + "\r\n\r\n"))
+		}
+	}))
+	defer server.Close()
+
+	b, err := NewGeminiBackend("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("NewGeminiBackend: %v", err)
+	}
+
+	tools := []Tool{{Name: "read", Description: "Read file", Parameters: map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"path": map[string]interface{}{"type": "string"}},
+	}}}
+
+	var content strings.Builder
+	var toolCalls []ToolCall
+	err = b.Chat(context.Background(), "gemini-test", []Message{{Role: "user", Content: "read go.mod"}}, tools, true,
+		func(chunk StreamChunk) error {
+			content.WriteString(chunk.Content)
+			if len(chunk.ToolCalls) > 0 {
+				toolCalls = chunk.ToolCalls
+			}
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+
+	if len(gotReq.Tools) != 1 || len(gotReq.Tools[0].FunctionDeclarations) != 1 {
+		t.Errorf("unexpected tools in request: %+v", gotReq.Tools)
+	}
+	if content.String() != "Reading now." {
+		t.Errorf("content = %q, want %q", content.String(), "Reading now.")
+	}
+	if len(toolCalls) != 1 || toolCalls[0].Name != "read" || toolCalls[0].Arguments["path"] != "go.mod" {
+		t.Fatalf("unexpected tool calls: %+v", toolCalls)
+	}
+	if toolCalls[0].ID == "" {
+		t.Error("expected a synthesized tool call ID")
+	}
+	if toolCalls[0].Signature != "c2ln" {
+		t.Errorf("signature = %q, want the part's thought signature", toolCalls[0].Signature)
+	}
+
+	// The signature goes back with the call
+	_, contents := convertMessagesToGemini([]Message{{Role: "assistant", ToolCalls: toolCalls}})
+	if part := contents[0].Parts[0]; part.FunctionCall == nil || part.ThoughtSignature != "c2ln" {
+		t.Errorf("sent back %+v, want the function call with its signature", part)
+	}
+}
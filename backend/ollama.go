@@ -37,6 +37,9 @@ func (o *OllamaBackend) Chat(ctx context.Context, model string, messages []Messa
 			Content:    msg.Content,
 			ToolCallID: msg.ToolCallID,
 		}
+		for _, image := range msg.Images {
+			ollamaMessages[i].Images = append(ollamaMessages[i].Images, api.ImageData(image.Data))
+		}
 		// Convert tool calls
 		if len(msg.ToolCalls) > 0 {
 			ollamaMessages[i].ToolCalls = make([]api.ToolCall, len(msg.ToolCalls))
@@ -72,6 +75,14 @@ func (o *OllamaBackend) Chat(ctx context.Context, model string, messages []Messa
 			Done:    resp.Done,
 		}
 
+		// Token counts are only reported on the final response
+		if resp.Done {
+			chunk.Usage = &Usage{
+				PromptTokens:     resp.PromptEvalCount,
+				CompletionTokens: resp.EvalCount,
+			}
+		}
+
 		// Convert tool calls
 		if len(resp.Message.ToolCalls) > 0 {
 			chunk.ToolCalls = make([]ToolCall, len(resp.Message.ToolCalls))
@@ -88,6 +99,20 @@ func (o *OllamaBackend) Chat(ctx context.Context, model string, messages []Messa
 	})
 }
 
+// ListModels returns the locally installed Ollama models (/api/tags)
+func (o *OllamaBackend) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	resp, err := o.client.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]ModelInfo, len(resp.Models))
+	for i, m := range resp.Models {
+		models[i] = ModelInfo{Name: m.Name, Size: m.Size}
+	}
+	return models, nil
+}
+
 // Close cleans up resources
 func (o *OllamaBackend) Close() error {
 	return nil
@@ -111,6 +136,9 @@ func convertToolsToOllama(tools []Tool) api.Tools {
 					if d, ok := propMap["description"].(string); ok {
 						tp.Description = d
 					}
+					if e, ok := propMap["enum"].([]any); ok {
+						tp.Enum = e
+					}
 					props.Set(name, tp)
 				}
 			}
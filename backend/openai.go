@@ -4,10 +4,12 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strings"
 )
 
@@ -44,6 +46,12 @@ type openAIRequest struct {
 	Messages []openAIMessage    `json:"messages"`
 	Tools    []openAITool       `json:"tools,omitempty"`
 	Stream   bool               `json:"stream"`
+
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type openAIMessage struct {
@@ -51,6 +59,31 @@ type openAIMessage struct {
 	Content    *string          `json:"content"`
 	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string           `json:"tool_call_id,omitempty"`
+
+	// Parts is sent as the content instead when set
+	Parts []openAIContentPart `json:"-"`
+}
+
+// MarshalJSON sends Parts as the content of messages that have them
+func (m openAIMessage) MarshalJSON() ([]byte, error) {
+	type message openAIMessage
+	if len(m.Parts) == 0 {
+		return json.Marshal(message(m))
+	}
+	return json.Marshal(struct {
+		message
+		Content []openAIContentPart `json:"content"`
+	}{message(m), m.Parts})
+}
+
+type openAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
 }
 
 type openAITool struct {
@@ -78,9 +111,15 @@ type openAIFunctionCall struct {
 type openAIResponse struct {
 	ID      string           `json:"id"`
 	Choices []openAIChoice   `json:"choices"`
+	Usage   *openAIUsage     `json:"usage,omitempty"`
 	Error   *openAIError     `json:"error,omitempty"`
 }
 
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
 type openAIChoice struct {
 	Index        int            `json:"index"`
 	Message      openAIMessage  `json:"message,omitempty"`
@@ -116,15 +155,29 @@ type openAIError struct {
 func (o *OpenAIBackend) Chat(ctx context.Context, model string, messages []Message, tools []Tool, stream bool,
 	callback func(StreamChunk) error) error {
 
-	// Convert messages to OpenAI format
-	openAIMessages := make([]openAIMessage, len(messages))
-	for i, msg := range messages {
+	// Convert messages to OpenAI format. Tool results can't hold images, so
+	// theirs follow in a user message after the last result.
+	openAIMessages := make([]openAIMessage, 0, len(messages))
+	var images []openAIContentPart
+	for _, msg := range messages {
+		if msg.Role != "tool" && len(images) > 0 {
+			openAIMessages = append(openAIMessages, openAIImageMessage(images))
+			images = nil
+		}
+		for _, image := range msg.Images {
+			images = append(images, openAIContentPart{
+				Type:     "image_url",
+				ImageURL: &openAIImageURL{URL: "data:" + image.MediaType + ";base64," + base64.StdEncoding.EncodeToString(image.Data)},
+			})
+		}
+
 		content := msg.Content
-		openAIMessages[i] = openAIMessage{
+		openAIMessages = append(openAIMessages, openAIMessage{
 			Role:       msg.Role,
 			Content:    &content,
 			ToolCallID: msg.ToolCallID,
-		}
+		})
+		i := len(openAIMessages) - 1
 		// Convert tool calls
 		if len(msg.ToolCalls) > 0 {
 			openAIMessages[i].Content = nil // OpenAI requires null content when tool_calls present
@@ -142,6 +195,9 @@ func (o *OpenAIBackend) Chat(ctx context.Context, model string, messages []Messa
 			}
 		}
 	}
+	if len(images) > 0 {
+		openAIMessages = append(openAIMessages, openAIImageMessage(images))
+	}
 
 	// Convert tools to OpenAI format
 	openAITools := make([]openAITool, len(tools))
@@ -167,6 +223,11 @@ func (o *OpenAIBackend) Chat(ctx context.Context, model string, messages []Messa
 		req.Tools = nil
 	}
 
+	// Ask for a final usage chunk when streaming
+	if stream {
+		req.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+
 	reqBody, err := json.Marshal(req)
 	if err != nil {
 		return fmt.Errorf("failed to marshal request: %w", err)
@@ -197,6 +258,13 @@ func (o *OpenAIBackend) Chat(ctx context.Context, model string, messages []Messa
 	return o.handleNonStreamingResponse(resp.Body, callback)
 }
 
+// openAIImageMessage is a user message that shows the model the images of
+// the tool results before it
+func openAIImageMessage(images []openAIContentPart) openAIMessage {
+	parts := append([]openAIContentPart{{Type: "text", Text: "Images from the tool results above:"}}, images...)
+	return openAIMessage{Role: "user", Parts: parts}
+}
+
 // handleNonStreamingResponse processes a non-streaming response
 func (o *OpenAIBackend) handleNonStreamingResponse(body io.Reader, callback func(StreamChunk) error) error {
 	var resp openAIResponse
@@ -217,6 +285,13 @@ func (o *OpenAIBackend) handleNonStreamingResponse(body io.Reader, callback func
 		Done: true,
 	}
 
+	if resp.Usage != nil {
+		chunk.Usage = &Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+		}
+	}
+
 	if choice.Message.Content != nil {
 		chunk.Content = *choice.Message.Content
 	}
@@ -245,6 +320,9 @@ func (o *OpenAIBackend) handleStreamingResponse(body io.Reader, callback func(St
 	// Accumulators for tool calls (streamed incrementally)
 	toolCallAccum := make(map[int]*ToolCall)
 
+	// Usage arrives in a final chunk without choices
+	var usage *Usage
+
 	for scanner.Scan() {
 		line := scanner.Text()
 
@@ -260,14 +338,7 @@ func (o *OpenAIBackend) handleStreamingResponse(body io.Reader, callback func(St
 
 		data := strings.TrimPrefix(line, "data: ")
 		if data == "[DONE]" {
-			// Finalize any accumulated tool calls
-			var toolCalls []ToolCall
-			for _, tc := range toolCallAccum {
-				if tc.Name != "" {
-					toolCalls = append(toolCalls, *tc)
-				}
-			}
-			return callback(StreamChunk{Done: true, ToolCalls: toolCalls})
+			return callback(StreamChunk{Done: true, ToolCalls: finalizeOpenAIToolCalls(toolCallAccum), Usage: usage})
 		}
 
 		var resp openAIResponse
@@ -275,6 +346,13 @@ func (o *OpenAIBackend) handleStreamingResponse(body io.Reader, callback func(St
 			continue // Skip malformed chunks
 		}
 
+		if resp.Usage != nil {
+			usage = &Usage{
+				PromptTokens:     resp.Usage.PromptTokens,
+				CompletionTokens: resp.Usage.CompletionTokens,
+			}
+		}
+
 		if len(resp.Choices) == 0 {
 			continue
 		}
@@ -318,26 +396,83 @@ func (o *OpenAIBackend) handleStreamingResponse(body io.Reader, callback func(St
 		}
 	}
 
-	// Finalize tool calls with parsed arguments
+	toolCalls := finalizeOpenAIToolCalls(toolCallAccum)
+	if len(toolCalls) > 0 || usage != nil {
+		return callback(StreamChunk{Done: true, ToolCalls: toolCalls, Usage: usage})
+	}
+
+	return scanner.Err()
+}
+
+// finalizeOpenAIToolCalls parses the accumulated JSON arguments and returns
+// the tool calls in the order the model emitted them
+func finalizeOpenAIToolCalls(toolCallAccum map[int]*ToolCall) []ToolCall {
+	indexes := make([]int, 0, len(toolCallAccum))
+	for idx := range toolCallAccum {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
 	var toolCalls []ToolCall
-	for _, tc := range toolCallAccum {
-		if tc.Name != "" {
-			// Parse accumulated JSON arguments
-			if raw, ok := tc.Arguments["_raw"].(string); ok {
-				var args map[string]interface{}
-				if err := json.Unmarshal([]byte(raw), &args); err == nil {
-					tc.Arguments = args
-				}
+	for _, idx := range indexes {
+		tc := toolCallAccum[idx]
+		if tc.Name == "" {
+			continue
+		}
+		// Parse accumulated JSON arguments
+		if raw, ok := tc.Arguments["_raw"].(string); ok {
+			var args map[string]interface{}
+			if err := json.Unmarshal([]byte(raw), &args); err == nil {
+				tc.Arguments = args
 			}
-			toolCalls = append(toolCalls, *tc)
 		}
+		if tc.Arguments == nil {
+			tc.Arguments = map[string]interface{}{}
+		}
+		toolCalls = append(toolCalls, *tc)
 	}
+	return toolCalls
+}
+
+// openAIModelList is the response of GET /models
+type openAIModelList struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
 
-	if len(toolCalls) > 0 {
-		return callback(StreamChunk{Done: true, ToolCalls: toolCalls})
+// ListModels returns the models available to the API key (/v1/models)
+func (o *OpenAIBackend) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", o.baseURL+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	httpReq.Header.Set("Authorization", "Bearer "+o.apiKey)
 
-	return scanner.Err()
+	resp, err := o.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var list openAIModelList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	models := make([]ModelInfo, len(list.Data))
+	for i, m := range list.Data {
+		models[i] = ModelInfo{Name: m.ID}
+	}
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].Name < models[j].Name
+	})
+	return models, nil
 }
 
 // Close cleans up resources
@@ -0,0 +1,113 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAIStreamingToolCallsAndUsage(t *testing.T) {
+	events := []string{
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"bash","arguments":""}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"read","arguments":"{\"pa"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"th\":\"go.mod\"}"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"function":{"arguments":"{\"cmd\":\"ls\"}"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":120,"completion_tokens":30,"total_tokens":150}}`,
+		`[DONE]`,
+	}
+
+	var gotReq openAIRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&gotReq); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		for _, e := range events {
+			w.Write([]byte("data: " + e + "\n\n"))
+		}
+	}))
+	defer server.Close()
+
+	b, err := NewOpenAIBackend("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("NewOpenAIBackend: %v", err)
+	}
+
+	var final StreamChunk
+	err = b.Chat(context.Background(), "gpt-test", []Message{{Role: "user", Content: "hi"}}, nil, true,
+		func(chunk StreamChunk) error {
+			if chunk.Done {
+				final = chunk
+			}
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+
+	if gotReq.StreamOptions == nil || !gotReq.StreamOptions.IncludeUsage {
+		t.Error("expected stream_options.include_usage in streaming request")
+	}
+
+	if len(final.ToolCalls) != 2 {
+		t.Fatalf("expected 2 tool calls, got %d", len(final.ToolCalls))
+	}
+	// Tool calls keep the model's order and have parsed arguments
+	if final.ToolCalls[0].ID != "call_a" || final.ToolCalls[0].Arguments["path"] != "go.mod" {
+		t.Errorf("unexpected first tool call: %+v", final.ToolCalls[0])
+	}
+	if final.ToolCalls[1].ID != "call_b" || final.ToolCalls[1].Arguments["cmd"] != "ls" {
+		t.Errorf("unexpected second tool call: %+v", final.ToolCalls[1])
+	}
+
+	if final.Usage == nil || final.Usage.PromptTokens != 120 || final.Usage.CompletionTokens != 30 {
+		t.Errorf("unexpected usage: %+v", final.Usage)
+	}
+}
+
+func TestOpenAIImagesFollowToolResults(t *testing.T) {
+	var gotReq struct {
+		Messages []map[string]interface{} `json:"messages"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&gotReq); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"a cat"}}]}`))
+	}))
+	defer server.Close()
+
+	b, err := NewOpenAIBackend("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("NewOpenAIBackend: %v", err)
+	}
+	messages := []Message{
+		{Role: "user", Content: "what is in cat.png?"},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_a", Name: "read"}, {ID: "call_b", Name: "read"}}},
+		{Role: "tool", ToolCallID: "call_a", Content: "Image cat.png", Images: []Image{{MediaType: "image/png", Data: []byte("png")}}},
+		{Role: "tool", ToolCallID: "call_b", Content: "notes"},
+	}
+	if err := b.Chat(context.Background(), "gpt-test", messages, nil, false, func(StreamChunk) error { return nil }); err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+
+	// The image comes after both tool results, which must directly follow
+	// the tool calls
+	if len(gotReq.Messages) != 5 {
+		t.Fatalf("expected 5 messages, got %d: %v", len(gotReq.Messages), gotReq.Messages)
+	}
+	if gotReq.Messages[2]["content"] != "Image cat.png" || gotReq.Messages[3]["role"] != "tool" {
+		t.Errorf("unexpected tool results: %v", gotReq.Messages[2:4])
+	}
+	last := gotReq.Messages[4]
+	parts, _ := last["content"].([]interface{})
+	if last["role"] != "user" || len(parts) != 2 {
+		t.Fatalf("unexpected image message: %v", last)
+	}
+	image, _ := parts[1].(map[string]interface{})["image_url"].(map[string]interface{})
+	if image["url"] != "data:image/png;base64,cG5n" {
+		t.Errorf("image_url = %v", image)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gotha/bitca/shell"
+)
+
+const (
+	// bashDefaultTimeout is how long a command may run unless the call
+	// sets a timeout
+	bashDefaultTimeout = 2 * time.Minute
+
+	// bashMaxTimeout caps the timeout a call can set; longer commands
+	// should run in the background
+	bashMaxTimeout = 10 * time.Minute
+
+	// bashStartWait is how long starting a background job waits, so that
+	// a command that fails at once is reported right away
+	bashStartWait = 500 * time.Millisecond
+
+	// bashMaxOutputWait caps how long bash_output waits for output
+	bashMaxOutputWait = time.Minute
+
+	// bashInputWait is how long bash_input waits for a job to read its
+	// input
+	bashInputWait = 5 * time.Second
+
+	// bashMaxOutput is how much of a command's output bash keeps, its
+	// start and end; the result is cut shorter still, but the saved whole
+	// output holds this much
+	bashMaxOutput = 1 << 20
+)
+
+// toolShell is the bash session of the conversation; created on first use
+// in the current directory when main hasn't set it
+var toolShell *shell.Session
+
+// bashSession returns the session bash commands run in
+func bashSession() *shell.Session {
+	if toolShell == nil {
+		cwd, _ := os.Getwd()
+		toolShell = shell.New(cwd)
+	}
+	return toolShell
+}
+
+// seconds reads a duration in seconds from a tool argument, capped at max
+func seconds(args map[string]interface{}, key string, def, max time.Duration) time.Duration {
+	n, ok := args[key].(float64)
+	if !ok || n < 0 {
+		return def
+	}
+	return min(time.Duration(n*float64(time.Second)), max)
+}
+
+func toolBash(parent context.Context, args map[string]interface{}) (string, error) {
+	cmd, ok := args["cmd"].(string)
+	if !ok {
+		return "", fmt.Errorf("cmd must be a string")
+	}
+
+	session := bashSession()
+	var notes []string
+	if restart, _ := args["restart"].(bool); restart {
+		session.Restart()
+		notes = append(notes, "shell restarted")
+	}
+
+	if background, _ := args["background"].(bool); background {
+		return startBackgroundJob(session, cmd, notes)
+	}
+
+	timeout := seconds(args, "timeout", bashDefaultTimeout, bashMaxTimeout)
+	if timeout == 0 {
+		timeout = bashDefaultTimeout
+	}
+	cwd := session.Cwd()
+
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	output := shell.NewOutput(bashMaxOutput)
+	err := session.Run(ctx, cmd, output)
+	result := strings.TrimRight(output.String(), "\n")
+
+	if ctx.Err() == context.DeadlineExceeded {
+		result += fmt.Sprintf("\n(timed out after %s; set a longer timeout or use background=true)", timeout)
+	} else if ctx.Err() == context.Canceled {
+		result += "\n(cancelled by user)"
+	}
+
+	// Tell the model where later commands will run
+	if now := session.Cwd(); now != cwd {
+		notes = append(notes, "cwd is now "+now)
+	}
+	footer := ""
+	if len(notes) > 0 {
+		footer = "\n(" + strings.Join(notes, "; ") + ")"
+	}
+
+	if result == "" {
+		if err != nil {
+			return fmt.Sprintf("(empty output, error: %v)", err) + footer, nil
+		}
+		return "(empty)" + footer, nil
+	}
+
+	// Include error info if command failed but produced output
+	if err != nil {
+		result = fmt.Sprintf("%s\n(exit code: %v)", strings.TrimSpace(result), err)
+	}
+
+	return strings.TrimSpace(result) + footer, nil
+}
+
+// startBackgroundJob starts cmd as a background job and returns its id with
+// whatever it printed right away
+func startBackgroundJob(session *shell.Session, cmd string, notes []string) (string, error) {
+	job, err := session.Start(cmd)
+	if err != nil {
+		return "", err
+	}
+	debugLog.Printf("Started background job %s: %s", job.ID, cmd)
+
+	job.Wait(bashStartWait)
+	output, _ := job.Read()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Started background job %s (%s)", job.ID, job.Status())
+	if len(notes) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(notes, "; "))
+	}
+	if output = strings.TrimSpace(output); output != "" {
+		b.WriteString("\n" + output)
+	}
+	fmt.Fprintf(&b, "\nUse bash_output with id %s to read more output, bash_input to send input and bash_kill to stop it.", job.ID)
+	return b.String(), nil
+}
+
+// backgroundJob looks up the job named by the id argument
+func backgroundJob(args map[string]interface{}) (*shell.Job, error) {
+	id, ok := args["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("id must be a string")
+	}
+	job, ok := bashSession().Job(id)
+	if !ok {
+		return nil, fmt.Errorf("no background job %q", id)
+	}
+	return job, nil
+}
+
+// jobOutput formats the new output of a job under a status line
+func jobOutput(job *shell.Job) string {
+	output, skipped := job.Read()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s %s]", job.ID, job.Status())
+	if skipped > 0 {
+		fmt.Fprintf(&b, "\n(%d bytes of older output were dropped)", skipped)
+	}
+	if output = strings.TrimRight(output, "\n"); output != "" {
+		b.WriteString("\n" + output)
+	} else {
+		b.WriteString("\n(no new output)")
+	}
+	return b.String()
+}
+
+func toolBashOutput(ctx context.Context, args map[string]interface{}) (string, error) {
+	if _, ok := args["id"]; !ok {
+		jobs := bashSession().Jobs()
+		if len(jobs) == 0 {
+			return "No background jobs", nil
+		}
+		var lines []string
+		for _, job := range jobs {
+			lines = append(lines, fmt.Sprintf("%s  %s  %s", job.ID, job.Status(), job.Command))
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+
+	job, err := backgroundJob(args)
+	if err != nil {
+		return "", err
+	}
+
+	if wait := seconds(args, "wait", 0, bashMaxOutputWait); wait > 0 {
+		waitCtx, cancel := context.WithTimeout(ctx, wait)
+		defer cancel()
+		job.WaitOutput(waitCtx)
+	}
+	return jobOutput(job), nil
+}
+
+func toolBashInput(ctx context.Context, args map[string]interface{}) (string, error) {
+	job, err := backgroundJob(args)
+	if err != nil {
+		return "", err
+	}
+	input, ok := args["input"].(string)
+	if !ok {
+		return "", fmt.Errorf("input must be a string")
+	}
+
+	inputCtx, cancelInput := context.WithTimeout(ctx, bashInputWait)
+	defer cancelInput()
+	if err := job.Input(inputCtx, input); err != nil {
+		return "", err
+	}
+	if closeInput, _ := args["close"].(bool); closeInput {
+		if err := job.CloseInput(); err != nil {
+			return "", err
+		}
+	}
+
+	// Give the job a moment to respond
+	waitCtx, cancel := context.WithTimeout(ctx, bashStartWait)
+	defer cancel()
+	job.WaitOutput(waitCtx)
+	return fmt.Sprintf("Sent %d bytes to %s\n%s", len(input), job.ID, jobOutput(job)), nil
+}
+
+func toolBashKill(args map[string]interface{}) (string, error) {
+	job, err := backgroundJob(args)
+	if err != nil {
+		return "", err
+	}
+	job.Kill()
+	return jobOutput(job), nil
+}
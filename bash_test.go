@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotha/bitca/shell"
+)
+
+func TestBashKeepsSession(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := toolShell
+	toolShell = shell.New(dir)
+	t.Cleanup(func() { toolShell = saved })
+
+	bash := func(args map[string]interface{}) string {
+		t.Helper()
+		result, err := toolBash(context.Background(), args)
+		if err != nil {
+			t.Fatalf("toolBash(%v): %v", args, err)
+		}
+		return result
+	}
+
+	sub := filepath.Join(dir, "sub")
+	if got := bash(map[string]interface{}{"cmd": "cd sub && export NAME=bitca"}); got != "(empty)\n(cwd is now "+sub+")" {
+		t.Errorf("cd result = %q, want the new cwd noted", got)
+	}
+	if got := bash(map[string]interface{}{"cmd": "echo $NAME; pwd"}); got != "bitca\n"+sub {
+		t.Errorf("result = %q, want the variable and directory kept", got)
+	}
+
+	got := bash(map[string]interface{}{"cmd": "echo \"[$NAME]\"", "restart": true})
+	if !strings.HasPrefix(got, "[]\n(shell restarted") {
+		t.Errorf("restart result = %q", got)
+	}
+	if toolShell.Cwd() != dir {
+		t.Errorf("cwd after restart = %q, want %q", toolShell.Cwd(), dir)
+	}
+}
+
+func TestBashCapsOutput(t *testing.T) {
+	saved := toolShell
+	toolShell = shell.New(t.TempDir())
+	t.Cleanup(func() { toolShell = saved })
+
+	result, err := toolBash(context.Background(), map[string]interface{}{"cmd": "echo first; head -c 3000000 /dev/zero | tr '\\0' x; echo; echo last"})
+	if err != nil {
+		t.Fatalf("toolBash: %v", err)
+	}
+	if len(result) > bashMaxOutput+100 || !strings.HasPrefix(result, "first\n") || !strings.HasSuffix(result, "\nlast") ||
+		!strings.Contains(result, "bytes of output dropped") {
+		t.Errorf("result of %d bytes starts %q and ends %q", len(result), result[:min(len(result), 20)], result[max(len(result)-20, 0):])
+	}
+}
+
+func TestBashTimeout(t *testing.T) {
+	saved := toolShell
+	toolShell = shell.New(t.TempDir())
+	t.Cleanup(func() { toolShell = saved })
+
+	start := time.Now()
+	result, err := toolBash(context.Background(), map[string]interface{}{"cmd": "echo started; sleep 30", "timeout": 0.3})
+	if err != nil {
+		t.Fatalf("toolBash: %v", err)
+	}
+	if !strings.HasPrefix(result, "started\n(timed out after 300ms") {
+		t.Errorf("result = %q, want the output and a timeout note", result)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("timed out command took %v", time.Since(start))
+	}
+}
+
+func TestBashBackgroundJob(t *testing.T) {
+	saved := toolShell
+	toolShell = shell.New(t.TempDir())
+	t.Cleanup(func() {
+		toolShell.KillAll()
+		toolShell = saved
+	})
+
+	result, err := toolBash(context.Background(), map[string]interface{}{
+		"cmd":        "echo ready; while read line; do echo \"got $line\"; done; echo bye",
+		"background": true,
+	})
+	if err != nil {
+		t.Fatalf("toolBash: %v", err)
+	}
+	if !strings.HasPrefix(result, "Started background job bg1 (running") || !strings.Contains(result, "\nready\n") {
+		t.Fatalf("result = %q", result)
+	}
+
+	result, err = toolBashInput(context.Background(), map[string]interface{}{"id": "bg1", "input": "hello\n"})
+	if err != nil {
+		t.Fatalf("toolBashInput: %v", err)
+	}
+	if !strings.HasSuffix(result, "got hello") {
+		t.Errorf("input result = %q, want the job's answer", result)
+	}
+
+	closed, err := toolBashInput(context.Background(), map[string]interface{}{"id": "bg1", "input": "", "close": true})
+	if err != nil {
+		t.Fatalf("toolBashInput(close): %v", err)
+	}
+	result, err = toolBashOutput(context.Background(), map[string]interface{}{"id": "bg1", "wait": 5.0})
+	if err != nil {
+		t.Fatalf("toolBashOutput: %v", err)
+	}
+	if !strings.Contains(closed+result, "bye") {
+		t.Errorf("output = %q then %q, want the rest of the output", closed, result)
+	}
+
+	if list, _ := toolBashOutput(context.Background(), map[string]interface{}{}); !strings.HasPrefix(list, "bg1  exited with code 0") {
+		t.Errorf("job list = %q", list)
+	}
+
+	toolBash(context.Background(), map[string]interface{}{"cmd": "sleep 30", "background": true})
+	result, err = toolBashKill(map[string]interface{}{"id": "bg2"})
+	if err != nil {
+		t.Fatalf("toolBashKill: %v", err)
+	}
+	if !strings.HasPrefix(result, "[bg2 ended: signal: killed]") {
+		t.Errorf("kill result = %q", result)
+	}
+
+	if _, err := toolBashOutput(context.Background(), map[string]interface{}{"id": "bg9"}); err == nil {
+		t.Error("expected an error for an unknown job")
+	}
+}
@@ -3,18 +3,24 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"regexp"
 	"strings"
+	"time"
 
-	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/gotha/bitca/backend"
+	"github.com/gotha/bitca/checkpoint"
+	"github.com/gotha/bitca/history"
 	"github.com/gotha/bitca/mcp"
+	"github.com/gotha/bitca/permission"
+	"github.com/gotha/bitca/session"
 )
 
 var debugLog *log.Logger
@@ -85,6 +91,11 @@ var (
 			Italic(true).
 			MarginLeft(1)
 
+	approvalStyle = lipgloss.NewStyle().
+			Foreground(accentColor).
+			Bold(true).
+			MarginLeft(1)
+
 	helpStyle = lipgloss.NewStyle().
 			Foreground(subtleColor).
 			Italic(true).
@@ -98,18 +109,41 @@ var (
 
 type model struct {
 	viewport        viewport.Model
-	textInput       textinput.Model
+	textInput       textarea.Model
+	history         *history.History // input history, nil if it can't be stored
+	historyIndex    int              // entry shown in the input; history.Len() for the draft
+	historyDraft    string           // unsent input while browsing the history
+	search          *historySearch   // active reverse search
 	messages        []backend.Message
-	conversation    []string
+	transcript      []transcriptEntry
+	browsingTools   bool         // a tool block has the keyboard focus
+	focusedTool     int          // transcript index of the focused tool call
+	expandedTools   map[int]bool // expanded tool blocks by transcript index
 	backend         backend.Backend
 	tools           []backend.Tool
 	mcpManager      *mcp.Manager
 	commandRegistry *CommandRegistry
+	sessionStore    *session.Store   // nil if sessions can't be stored
+	session         *session.Session // created on the first user message
 	modelName       string
 	waiting         bool
 	streaming       bool
 	currentResponse string
 	streamChan      chan tea.Msg
+	runningTools    bool
+	permissions     *permission.Policy
+	checkpoints     *checkpoint.Store  // file states at the start of each turn, nil in headless mode
+	pendingCalls    []backend.ToolCall // tool calls being reviewed before they run
+	denials         map[int]string     // reasons for denied pendingCalls by index
+	approval        *approvalPrompt    // tool call waiting for the user's approval
+	compacting      bool
+	cancelling      bool
+	turnCtx         context.Context    // context of the current turn (user message until final answer)
+	cancelTurn      context.CancelFunc // cancels turnCtx
+	models          modelList          // the backend's models, for /model and tab completion
+	usage           tokenUsage
+	completionHint  string // ambiguous tab completion candidates
+	markdown        *markdownRenderer
 	err             error
 	ready           bool
 	width           int
@@ -121,44 +155,70 @@ type streamChunkMsg struct {
 }
 
 type streamDoneMsg struct {
-	fullContent  string
-	toolCalls    []backend.ToolCall
-	err          error
+	fullContent string
+	toolCalls   []backend.ToolCall
+	usage       *backend.Usage
+	err         error
+}
+
+// modelList caches the current backend's models. A failed listing is kept
+// too, so it isn't retried on every key press.
+type modelList struct {
+	backend backend.Backend // the backend listed; nil before the first listing
+	models  []backend.ModelInfo
+	err     error
+	at      time.Time
+	loading bool
+}
+
+// modelListRetry is how long a failed model listing is kept
+const modelListRetry = time.Minute
+
+type modelListMsg struct {
+	backend backend.Backend
+	models  []backend.ModelInfo
+	err     error
 }
 
 type toolExecutionMsg struct {
-	results []backend.Message
+	calls    []backend.ToolCall
+	outcomes []toolOutcome // one per call
+}
+
+// availableBackends lists the backend names accepted by -backend and /backend
+var availableBackends = []string{"ollama", "openai", "anthropic", "gemini"}
+
+// newBackend creates the named backend from the command-line configuration
+// and returns it together with the model configured for it
+func newBackend(name string) (backend.Backend, string, error) {
+	switch name {
+	case "ollama":
+		b, err := backend.NewOllamaBackend()
+		return b, config.Model, err
+	case "openai":
+		b, err := backend.NewOpenAIBackend(config.OpenAIAPIKey, config.OpenAIAPIBase)
+		return b, config.OpenAIModel, err
+	case "anthropic":
+		b, err := backend.NewAnthropicBackend(config.AnthropicAPIKey, config.AnthropicAPIBase)
+		return b, config.AnthropicModel, err
+	case "gemini":
+		b, err := backend.NewGeminiBackend(config.GeminiAPIKey, config.GeminiAPIBase)
+		return b, config.GeminiModel, err
+	default:
+		return nil, "", fmt.Errorf("unknown backend '%s' (available: %s)", name, strings.Join(availableBackends, ", "))
+	}
 }
 
 func initialModel() (model, error) {
 	// Create backend based on configuration
-	var llmBackend backend.Backend
-	var err error
-	var modelName string
-
-	if config.Backend == "openai" {
-		llmBackend, err = backend.NewOpenAIBackend(config.OpenAIAPIKey, config.OpenAIAPIBase)
-		modelName = config.OpenAIModel
-	} else {
-		llmBackend, err = backend.NewOllamaBackend()
-		modelName = config.Model
-	}
+	llmBackend, modelName, err := newBackend(config.Backend)
 	if err != nil {
 		return model{}, err
 	}
 
-	ti := textinput.New()
-	ti.Placeholder = "Type your message..."
-	ti.PlaceholderStyle = lipgloss.NewStyle().Foreground(subtleColor)
-	ti.TextStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#CDD6F4"))
-	ti.Cursor.Style = lipgloss.NewStyle().Foreground(accentColor)
-	ti.PromptStyle = lipgloss.NewStyle().Foreground(primaryColor).Bold(true)
-	ti.Prompt = "› "
-	ti.Focus()
-	ti.CharLimit = 500
-	ti.Width = 80
+	ti := newInputEditor()
 
-	vp := viewport.New(80, 20)
+	vp := newChatViewport(80, 20)
 	vp.SetContent("")
 
 	// Define built-in tools (convert to backend.Tool format)
@@ -168,7 +228,7 @@ func initialModel() (model, error) {
 	mcpManager := mcp.NewManager()
 	if err := mcpManager.LoadFromConfig(mcp.DefaultConfigPath()); err != nil {
 		// Log warning but continue without MCP tools
-		fmt.Printf("Warning: failed to load MCP config: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Warning: failed to load MCP config: %v\n", err)
 	}
 
 	// Merge MCP tools with built-in tools
@@ -190,15 +250,43 @@ When the user asks you to do something, call the appropriate tool immediately. E
 
 Never explain how to use a tool. Just call it.`,
 	}
+	if toolWorkspace != nil {
+		systemPrompt.Content += fmt.Sprintf("\n\nYour workspace is %s. The file tools only accept paths inside it; relative paths are relative to it.",
+			toolWorkspace.Root())
+	}
 
 	// Create command registry
 	commandRegistry := NewCommandRegistry()
 
-	return model{
+	// Open the session store; the app still works without it
+	sessionStore, err := session.NewStore(session.DefaultDir())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: sessions will not be saved: %v\n", err)
+		sessionStore = nil
+	}
+
+	// Load tool permissions; a broken file must not silently allow everything
+	permissions, err := permission.Load(permission.DefaultPath())
+	if err != nil {
+		return model{}, fmt.Errorf("failed to load permissions: %w", err)
+	}
+	// The project's file can only add restrictions
+	if err := permissions.AddProject(permission.ProjectPath); err != nil {
+		return model{}, fmt.Errorf("failed to load permissions: %w", err)
+	}
+	if config.PermissionMode != "" {
+		mode, err := permission.ParseMode(config.PermissionMode)
+		if err != nil {
+			return model{}, err
+		}
+		permissions.Mode = mode
+	}
+
+	m := model{
 		viewport:        vp,
 		textInput:       ti,
 		messages:        []backend.Message{systemPrompt},
-		conversation:    []string{},
+		transcript:      []transcriptEntry{},
 		backend:         llmBackend,
 		tools:           tools,
 		mcpManager:      mcpManager,
@@ -208,11 +296,183 @@ Never explain how to use a tool. Just call it.`,
 		streaming:       false,
 		currentResponse: "",
 		ready:           false,
-	}, nil
+		sessionStore:    sessionStore,
+		permissions:     permissions,
+	}
+
+	// Resume a previous session if requested on the command line
+	if sessionStore != nil && (config.Resume != "" || config.Continue) {
+		id := config.Resume
+		if id == "" {
+			cwd, _ := os.Getwd()
+			latest, err := sessionStore.Latest(cwd)
+			if err != nil {
+				return model{}, err
+			}
+			id = latest.ID
+		}
+		if _, err := m.resumeSession(id); err != nil {
+			return model{}, err
+		}
+	}
+
+	return m, nil
+}
+
+// switchBackend replaces the active backend, keeping the conversation history.
+// An empty modelName selects the model configured for the new backend.
+func (m *model) switchBackend(name, modelName string) (string, error) {
+	newB, defaultModel, err := newBackend(name)
+	if err != nil {
+		return "", err
+	}
+	if modelName == "" {
+		modelName = defaultModel
+	}
+
+	if m.backend != nil {
+		m.backend.Close()
+	}
+	m.backend = newB
+	m.modelName = modelName
+	m.models = modelList{}
+
+	// Histories from backends without tool call IDs (e.g. Ollama) must be
+	// linked up before they are sent to backends that require them
+	m.messages = backend.NormalizeToolCallIDs(m.messages)
+
+	debugLog.Printf("Switched backend to %s (model %s), carrying %d messages", name, modelName, len(m.messages))
+	return modelName, nil
+}
+
+// appendMessages adds messages to the history and persists them to the
+// session, creating the session file on first use
+func (m *model) appendMessages(msgs ...backend.Message) {
+	m.messages = append(m.messages, msgs...)
+
+	if m.sessionStore == nil {
+		return
+	}
+
+	if m.session == nil {
+		cwd, _ := os.Getwd()
+		sess, err := m.sessionStore.Create(session.Meta{
+			Cwd:     cwd,
+			Backend: m.backend.Name(),
+			Model:   m.modelName,
+		})
+		if err != nil {
+			debugLog.Printf("Failed to create session: %v", err)
+			m.sessionStore = nil
+			return
+		}
+		m.session = sess
+		debugLog.Printf("Created session %s", sess.ID)
+		// The system prompt and anything before this point go in first
+		msgs = m.messages
+		for _, entry := range m.transcript {
+			if err := sess.AppendEntry(entry); err != nil {
+				debugLog.Printf("Failed to save transcript entry to session %s: %v", sess.ID, err)
+				break
+			}
+		}
+	}
+
+	if err := m.session.Append(msgs...); err != nil {
+		debugLog.Printf("Failed to save session %s: %v", m.session.ID, err)
+	}
+}
+
+// resumeSession replaces the current conversation with a stored session and
+// continues appending to it. It returns the resumed session's ID.
+func (m *model) resumeSession(id string) (string, error) {
+	if m.sessionStore == nil {
+		return "", fmt.Errorf("session storage is not available")
+	}
+
+	sess, meta, messages, saved, err := m.sessionStore.Open(id)
+	if err != nil {
+		return "", err
+	}
+
+	if m.session != nil {
+		m.session.Close()
+	}
+	m.session = sess
+
+	// Keep the current system prompt if the session somehow has none
+	if len(messages) == 0 || messages[0].Role != "system" {
+		messages = append([]backend.Message{m.messages[0]}, messages...)
+	}
+	m.messages = backend.NormalizeToolCallIDs(messages)
+	if m.checkpoints != nil {
+		// Checkpoints belong to the conversation being left
+		m.checkpoints.Reset()
+	}
+	// So do the shell's directory, environment and background jobs
+	bashSession().Restart()
+	bashSession().KillAll()
+	if len(saved) > 0 {
+		m.transcript = decodeTranscript(saved)
+	} else {
+		m.transcript = transcriptFromMessages(m.messages)
+	}
+	m.browsingTools = false
+	m.expandedTools = nil
+	m.addEntry(entrySystem, fmt.Sprintf("Resumed session %s (%d messages, started with %s/%s)",
+		meta.ID, len(messages), meta.Backend, meta.Model))
+
+	debugLog.Printf("Resumed session %s with %d messages", meta.ID, len(messages))
+	return meta.ID, nil
+}
+
+// refreshModels lists the current backend's models in the background
+// unless they are listed, being listed or failed to list a moment ago
+func (m *model) refreshModels() tea.Cmd {
+	list := m.models
+	if m.backend == nil || list.loading ||
+		(list.backend == m.backend && (list.err == nil || time.Since(list.at) < modelListRetry)) {
+		return nil
+	}
+
+	m.models.loading = true
+	b := m.backend
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		models, err := b.ListModels(ctx)
+		if err != nil {
+			debugLog.Printf("Failed to list models on %s: %v", b.Name(), err)
+		}
+		return modelListMsg{backend: b, models: models, err: err}
+	}
+}
+
+// cachedModels returns the models listed in the background
+func (m *model) cachedModels() ([]backend.ModelInfo, error) {
+	switch {
+	case m.models.backend != m.backend:
+		return nil, fmt.Errorf("the model list is still loading")
+	case m.models.err != nil:
+		return nil, m.models.err
+	}
+	return m.models.models, nil
+}
+
+// modelNames returns the names of the cached models
+func (m *model) modelNames() []string {
+	models, _ := m.cachedModels()
+	names := make([]string, len(models))
+	for i, mi := range models {
+		names[i] = mi.Name
+	}
+	return names
 }
 
 func (m model) Init() tea.Cmd {
-	return textinput.Blink
+	// The model list arrives as a modelListMsg; a copy of m can't mark it
+	// as loading, so a Tab press before then may list the models again
+	return tea.Batch(textarea.Blink, m.refreshModels())
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -236,22 +496,100 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// Account for borders, padding, and input area
 			viewportWidth := msg.Width - 8    // Account for viewport border and padding
 			viewportHeight := msg.Height - 10 // Account for viewport, input, and help text
-			m.viewport = viewport.New(viewportWidth, viewportHeight)
+			m.viewport = newChatViewport(viewportWidth, viewportHeight)
 			m.viewport.YPosition = 0
 			m.ready = true
 		} else {
 			m.viewport.Width = msg.Width - 8
-			m.viewport.Height = msg.Height - 10
 		}
 
-		m.textInput.Width = msg.Width - 10 // Account for input box border and padding
+		m.textInput.SetWidth(msg.Width - 10) // Account for input box border and padding
+		m.resizeInput()
 		m.updateViewportContent()
 
 	case tea.KeyMsg:
+		if msg.Type != tea.KeyTab {
+			m.completionHint = ""
+		}
+		// A pending approval takes all keys except cancel and quit
+		if m.approval != nil && msg.Type != tea.KeyEsc && msg.Type != tea.KeyCtrlC {
+			return m, m.answerApproval(msg.String())
+		}
+		if m.search != nil {
+			return m, m.updateHistorySearch(msg)
+		}
+		if m.browsingTools {
+			return m, m.updateToolBrowsing(msg)
+		}
 		switch msg.Type {
-		case tea.KeyCtrlC, tea.KeyEsc:
+		case tea.KeyEsc:
+			if m.approval != nil {
+				// Nothing is running yet; every pending call gets a
+				// cancelled result so the history stays valid
+				m.cancelling = true
+				m.cancelTurn()
+				calls := m.pendingCalls
+				m.approval = nil
+				m.pendingCalls = nil
+				m.denials = nil
+				m.layout()
+				return m, m.executeTools(m.turnCtx, calls, nil)
+			}
+			if m.waiting {
+				// Cancel the current turn but keep the session alive; the
+				// stream or tool goroutine reports back once it has stopped
+				if m.cancelTurn != nil && !m.cancelling {
+					debugLog.Printf("Cancelling current turn")
+					m.cancelling = true
+					m.cancelTurn()
+				}
+				return m, nil
+			}
 			return m, tea.Quit
+		case tea.KeyCtrlC:
+			if m.cancelTurn != nil {
+				m.cancelTurn()
+			}
+			return m, tea.Quit
+		case tea.KeyTab:
+			if m.waiting || m.commandRegistry == nil {
+				return m, nil
+			}
+			input := m.textInput.Value()
+			var modelNames []string
+			var refresh tea.Cmd
+			if strings.HasPrefix(strings.ToLower(input), "/model ") {
+				modelNames = m.modelNames()
+				refresh = m.refreshModels()
+			}
+			completed, candidates := completeInput(input, m.commandRegistry.GetAllCommands(), modelNames)
+			m.setInput(completed)
+			m.completionHint = strings.Join(candidates, "  ")
+			if m.models.loading && len(modelNames) == 0 {
+				m.completionHint = "loading models..."
+			}
+			return m, refresh
+		case tea.KeyCtrlT:
+			m.startBrowsingTools()
+			return m, nil
+		case tea.KeyCtrlR:
+			if !m.waiting {
+				m.startHistorySearch()
+			}
+			return m, nil
+		case tea.KeyUp:
+			// Up on the first row of the input goes back in the history
+			if !m.waiting && m.onFirstInputRow() && m.historyPrevious() {
+				return m, nil
+			}
+		case tea.KeyDown:
+			if !m.waiting && m.onLastInputRow() && m.historyNext() {
+				return m, nil
+			}
 		case tea.KeyEnter:
+			if msg.Alt {
+				break // Newline in the editor
+			}
 			if m.waiting {
 				return m, nil
 			}
@@ -262,17 +600,8 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 			// Check if input is a slash command
 			if m.commandRegistry != nil && m.commandRegistry.IsCommand(userInput) {
-				// Handle /model command specially to update model
-				cmdName, cmdArgs := ParseCommand(userInput)
-				if strings.ToLower(cmdName) == "model" && len(cmdArgs) > 0 {
-					newModel := cmdArgs[0]
-					m.modelName = newModel
-					m.conversation = append(m.conversation, fmt.Sprintf("Command: %s", userInput))
-					m.conversation = append(m.conversation, fmt.Sprintf("System: Model changed to: %s", newModel))
-					m.textInput.SetValue("")
-					m.updateViewportContent()
-					return m, nil
-				}
+				// Commands that start background work set this
+				var followUp tea.Cmd
 
 				// Execute the command
 				ctx := CommandContext{
@@ -280,42 +609,72 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					Tools:          m.tools,
 					CurrentModel:   m.modelName,
 					CurrentBackend: m.backend.Name(),
+					SetModel:       func(name string) { m.modelName = name },
+					SetBackend:     m.switchBackend,
+					ListModels:     m.cachedModels,
+					Usage:          m.usage,
+					ContextWindow:  contextWindow(m.backend.Name(), m.modelName),
+					Sessions:       m.sessionStore,
+					ResumeSession:  m.resumeSession,
+					Permissions:    m.permissions,
+					Checkpoints:    m.checkpoints,
+					Rewind:         m.rewind,
+					Shell:          bashSession(),
+					Compact: func() (int, error) {
+						cutoff := compactionCutoff(m.messages, compactKeepTurns)
+						if cutoff == 0 {
+							return 0, fmt.Errorf("nothing to compact yet")
+						}
+						followUp = m.startCompaction(false)
+						return cutoff - 1, nil
+					},
+				}
+				if m.session != nil {
+					ctx.CurrentSession = m.session.ID
 				}
 
 				// Show the command in conversation
-				m.conversation = append(m.conversation, fmt.Sprintf("Command: %s", userInput))
-				m.textInput.SetValue("")
+				m.addEntry(entryCommand, userInput)
+				m.submitInput(userInput)
 
 				output, err := m.commandRegistry.Execute(userInput, ctx)
 				if err != nil {
-					m.conversation = append(m.conversation, fmt.Sprintf("Error: %s", err.Error()))
+					m.addEntry(entryError, err.Error())
 				} else {
-					m.conversation = append(m.conversation, fmt.Sprintf("System: %s", output))
+					m.addEntry(entrySystem, output)
 				}
 
 				m.updateViewportContent()
-				return m, nil
+				// A new backend's models are listed for the next /model
+				refresh := m.refreshModels()
+				return m, tea.Batch(followUp, refresh)
+			}
+
+			// Remember the files and history as they are before this turn
+			if m.checkpoints != nil {
+				m.checkpoints.Begin(len(m.messages), userInput)
 			}
 
 			// Add user message to messages array
 			userMsg := backend.Message{Role: "user", Content: userInput}
-			m.messages = append(m.messages, userMsg)
+			m.appendMessages(userMsg)
 
 			// Add user message to conversation display
-			m.conversation = append(m.conversation, fmt.Sprintf("You: %s", userInput))
-			m.textInput.SetValue("")
-			m.waiting = true
-			m.streaming = true
-			m.currentResponse = ""
-			m.streamChan = make(chan tea.Msg)
+			m.addEntry(entryUser, userInput)
+			m.submitInput(userInput)
 
-			m.updateViewportContent()
+			// Each user message starts a new cancellable turn that lasts
+			// through all tool round-trips until the final answer
+			m.turnCtx, m.cancelTurn = context.WithCancel(context.Background())
+
+			// Summarize older turns first if the context is nearly full
+			if m.needsCompaction() {
+				m.addEntry(entrySystem, "Context is nearly full, compacting earlier messages")
+				return m, m.startCompaction(true)
+			}
 
 			// Send to API (messages array already contains full context)
-			return m, tea.Batch(
-				m.sendMessage(),
-				waitForStreamChunk(m.streamChan),
-			)
+			return m, m.startStream()
 		}
 
 	case streamChunkMsg:
@@ -332,9 +691,28 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.waiting = false
 		m.streaming = false
 		m.streamChan = nil // Clear the channel to prevent stale reads
+		if msg.usage != nil {
+			m.usage.add(*msg.usage)
+		}
+
+		if errors.Is(msg.err, context.Canceled) {
+			// Keep whatever was generated so far; pending tool calls are
+			// dropped so the history stays valid for every backend
+			if msg.fullContent != "" {
+				m.appendMessages(backend.Message{Role: "assistant", Content: msg.fullContent})
+				m.addEntry(entryAssistant, msg.fullContent)
+			}
+			m.addEntry(entrySystem, "Generation cancelled")
+			m.currentResponse = ""
+			m.endTurn()
+			m.updateViewportContent()
+			return m, nil
+		}
+
 		if msg.err != nil {
+			m.endTurn()
 			m.err = msg.err
-			m.conversation = append(m.conversation, fmt.Sprintf("Error: %s", msg.err))
+			m.addEntry(entryError, msg.err.Error())
 			m.currentResponse = ""
 			m.updateViewportContent()
 			return m, nil
@@ -349,67 +727,116 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if len(msg.toolCalls) > 0 {
 			assistantMsg.ToolCalls = msg.toolCalls
 		}
-		m.messages = append(m.messages, assistantMsg)
+		m.appendMessages(assistantMsg)
 
-		// Check if there are tool calls to execute
-		toolCalls := msg.toolCalls
-
-		// If no API tool calls, check if the response contains JSON tool calls
-		if len(toolCalls) == 0 && msg.fullContent != "" {
-			jsonToolCalls := parseJSONToolCalls(msg.fullContent)
-			if len(jsonToolCalls) > 0 {
-				toolCalls = jsonToolCalls
-			}
-		}
+		// Use API tool calls, or JSON tool calls in the response text
+		toolCalls := callsToRun(turnResult{content: msg.fullContent, toolCalls: msg.toolCalls})
 
 		if len(toolCalls) > 0 {
 			// Display that tools are being executed
 			if msg.fullContent != "" {
-				m.conversation = append(m.conversation, fmt.Sprintf("Assistant: %s", msg.fullContent))
+				m.addEntry(entryAssistant, msg.fullContent)
 			}
 
 			// Show which tools are being called
 			for _, tc := range toolCalls {
-				m.conversation = append(m.conversation, fmt.Sprintf("[Calling tool: %s with args: %v]", tc.Name, tc.Arguments))
+				m.addToolCall(tc)
 			}
 
+			// Stay busy while the tools run so the turn can still be cancelled
+			m.waiting = true
+			m.runningTools = true
 			m.updateViewportContent()
 
-			// Execute tools and continue conversation
-			return m, m.executeTools(toolCalls)
+			// Check permissions, then execute tools and continue conversation
+			m.pendingCalls = toolCalls
+			m.denials = make(map[int]string)
+			return m, m.reviewToolCalls(0)
 		}
 
 		// No tool calls, just display the response
-		m.conversation = append(m.conversation, fmt.Sprintf("Assistant: %s", msg.fullContent))
+		m.addEntry(entryAssistant, msg.fullContent)
 		m.currentResponse = ""
+		m.endTurn()
 		m.updateViewportContent()
 		return m, nil
 
 	case toolExecutionMsg:
 		// Add tool results to messages
-		m.messages = append(m.messages, msg.results...)
+		m.appendMessages(outcomeMessages(msg.outcomes)...)
 
 		// Display tool execution results
-		for i, result := range msg.results {
-			// Truncate long results for display
-			displayContent := result.Content
-			if len(displayContent) > 500 {
-				displayContent = displayContent[:500] + "... (truncated)"
-			}
-			m.conversation = append(m.conversation, fmt.Sprintf("Tool Result %d: %s", i+1, displayContent))
+		for i, outcome := range msg.outcomes {
+			m.addToolResult(msg.calls[i], outcome)
+		}
+		m.runningTools = false
+
+		if m.turnCtx == nil || m.turnCtx.Err() != nil {
+			// Cancelled while tools were running; the results are kept
+			// but the model is not asked to continue
+			m.waiting = false
+			m.addEntry(entrySystem, "Generation cancelled")
+			m.endTurn()
+			m.updateViewportContent()
+			return m, nil
 		}
 
 		// Continue the conversation with tool results
-		m.waiting = true
-		m.streaming = true
-		m.currentResponse = ""
-		m.streamChan = make(chan tea.Msg)
-		m.updateViewportContent()
+		return m, m.startStream()
 
-		return m, tea.Batch(
-			m.sendMessage(),
-			waitForStreamChunk(m.streamChan),
-		)
+	case modelListMsg:
+		// A listing for a backend switched away from is dropped
+		if msg.backend == m.backend {
+			m.models = modelList{backend: msg.backend, models: msg.models, err: msg.err, at: time.Now()}
+		}
+		return m, nil
+
+	case compactDoneMsg:
+		m.compacting = false
+		if msg.usage != nil {
+			// Count the summary request in the totals without treating it
+			// as the size of the conversation
+			m.usage.Requests++
+			m.usage.PromptTokens += msg.usage.PromptTokens
+			m.usage.CompletionTokens += msg.usage.CompletionTokens
+		}
+
+		if errors.Is(msg.err, context.Canceled) {
+			m.waiting = false
+			m.addEntry(entrySystem, "Compaction cancelled")
+			m.endTurn()
+			m.updateViewportContent()
+			return m, nil
+		}
+
+		if msg.err != nil {
+			m.addEntry(entryError, fmt.Sprintf("Compaction failed: %s", msg.err))
+		} else {
+			m.messages = applyCompaction(m.messages, msg.cutoff, msg.summary)
+			if m.checkpoints != nil {
+				// The summary and system prompt replace everything before cutoff
+				m.checkpoints.ShiftMessages(msg.cutoff, 2-msg.cutoff)
+			}
+			if m.session != nil {
+				if err := m.session.Replace(m.messages); err != nil {
+					debugLog.Printf("Failed to save compacted session %s: %v", m.session.ID, err)
+				}
+			}
+			// The next request reports the real size; estimate until then
+			m.usage.LastPromptTokens = estimateTokens(m.messages)
+			m.usage.LastCompletionTokens = 0
+			m.addEntry(entrySystem, fmt.Sprintf("Compacted %d earlier messages into a summary (~%s tokens of context now)",
+				msg.cutoff-1, formatTokens(m.usage.LastPromptTokens)))
+		}
+
+		if msg.continueTurn {
+			// Send the user message that triggered automatic compaction
+			return m, m.startStream()
+		}
+		m.waiting = false
+		m.endTurn()
+		m.updateViewportContent()
+		return m, nil
 	}
 
 	// Update viewport
@@ -420,55 +847,111 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	if !m.waiting {
 		m.textInput, cmd = m.textInput.Update(msg)
 		cmds = append(cmds, cmd)
+		m.resizeInput()
 	}
 
 	return m, tea.Batch(cmds...)
 }
 
+// startStream sends the current messages to the backend within the current
+// turn and starts listening for streamed chunks
+func (m *model) startStream() tea.Cmd {
+	m.waiting = true
+	m.streaming = true
+	m.currentResponse = ""
+	m.streamChan = make(chan tea.Msg)
+	m.updateViewportContent()
+
+	return tea.Batch(
+		m.sendMessage(m.turnCtx),
+		waitForStreamChunk(m.streamChan),
+	)
+}
+
+// startCompaction summarizes older turns in the background. With continueTurn
+// the current turn goes on to send the pending user message afterwards.
+func (m *model) startCompaction(continueTurn bool) tea.Cmd {
+	if m.turnCtx == nil {
+		m.turnCtx, m.cancelTurn = context.WithCancel(context.Background())
+	}
+	m.waiting = true
+	m.compacting = true
+	m.updateViewportContent()
+
+	return m.compactConversation(m.turnCtx, continueTurn)
+}
+
+// endTurn releases the current turn's context
+func (m *model) endTurn() {
+	if m.cancelTurn != nil {
+		m.cancelTurn()
+	}
+	m.turnCtx = nil
+	m.cancelTurn = nil
+	m.cancelling = false
+	m.runningTools = false
+	m.compacting = false
+	m.approval = nil
+	m.pendingCalls = nil
+	m.denials = nil
+	m.layout()
+}
+
+// backendTitle returns how the title names a backend
+func backendTitle(b backend.Backend) string {
+	if b == nil {
+		return "bitca"
+	}
+	switch name := b.Name(); name {
+	case "ollama":
+		return "Ollama"
+	case "openai":
+		return "OpenAI"
+	case "anthropic":
+		return "Anthropic"
+	case "gemini":
+		return "Gemini"
+	default:
+		return name
+	}
+}
+
 func (m *model) updateViewportContent() {
+	if m.markdown == nil {
+		m.markdown = newMarkdownRenderer()
+	}
+
 	var b strings.Builder
 
 	// Display title
-	title := titleStyle.Render("💬 Chat with Ollama")
+	title := titleStyle.Render("💬 Chat with " + backendTitle(m.backend))
 	b.WriteString(title)
 	b.WriteString("\n\n")
 
-	// Display conversation history
-	for _, line := range m.conversation {
-		// Parse the line to determine if it's user or assistant
-		if strings.HasPrefix(line, "You: ") {
-			content := strings.TrimPrefix(line, "You: ")
-			label := userMessageStyle.Render("You:")
-			wrapped := wordWrap(content, m.viewport.Width-4)
-			styledContent := messageContentStyle.Render(wrapped)
-			b.WriteString(label + "\n" + styledContent)
-		} else if strings.HasPrefix(line, "Assistant: ") {
-			content := strings.TrimPrefix(line, "Assistant: ")
-			label := assistantMessageStyle.Render("Assistant:")
-			wrapped := wordWrap(content, m.viewport.Width-4)
-			styledContent := messageContentStyle.Render(wrapped)
-			b.WriteString(label + "\n" + styledContent)
-		} else if strings.HasPrefix(line, "Error: ") {
-			content := strings.TrimPrefix(line, "Error: ")
-			label := errorStyle.Render("Error:")
-			wrapped := wordWrap(content, m.viewport.Width-4)
-			styledContent := messageContentStyle.Render(wrapped)
-			b.WriteString(label + "\n" + styledContent)
-		} else if strings.HasPrefix(line, "Command: ") {
-			content := strings.TrimPrefix(line, "Command: ")
-			label := commandStyle.Render("Command:")
-			wrapped := wordWrap(content, m.viewport.Width-4)
-			styledContent := messageContentStyle.Render(wrapped)
-			b.WriteString(label + "\n" + styledContent)
-		} else if strings.HasPrefix(line, "System: ") {
-			content := strings.TrimPrefix(line, "System: ")
-			label := systemStyle.Render("System:")
-			wrapped := wordWrap(content, m.viewport.Width-4)
-			styledContent := messageContentStyle.Render(wrapped)
-			b.WriteString(label + "\n" + styledContent)
-		} else {
-			wrapped := wordWrap(line, m.viewport.Width-4)
-			b.WriteString(wrapped)
+	// Display conversation history; tool results are shown in the block of
+	// their tool call
+	pairs := pairToolResults(m.transcript)
+	paired := make(map[int]bool, len(pairs))
+	for _, result := range pairs {
+		paired[result] = true
+	}
+	focusLine := -1
+	for i, entry := range m.transcript {
+		switch {
+		case entry.Kind == entryToolCall:
+			var result *transcriptEntry
+			if r, ok := pairs[i]; ok {
+				result = &m.transcript[r]
+			}
+			focused := m.browsingTools && m.focusedTool == i
+			if focused {
+				focusLine = strings.Count(b.String(), "\n")
+			}
+			b.WriteString(renderToolBlock(entry, result, m.expandedTools[i], focused, m.viewport.Width))
+		case paired[i]:
+			continue
+		default:
+			b.WriteString(m.renderEntry(entry))
 		}
 		b.WriteString("\n\n")
 	}
@@ -476,17 +959,47 @@ func (m *model) updateViewportContent() {
 	// Display streaming response if active
 	if m.streaming && m.currentResponse != "" {
 		label := assistantMessageStyle.Render("Assistant:")
-		wrapped := wordWrap(m.currentResponse, m.viewport.Width-4)
-		styledContent := messageContentStyle.Render(wrapped)
-		b.WriteString(label + "\n" + styledContent)
+		b.WriteString(label + "\n" + m.markdown.renderStreaming(m.currentResponse, m.viewport.Width-2))
 		b.WriteString("\n\n")
 	}
 
 	m.viewport.SetContent(b.String())
+	if focusLine >= 0 {
+		// Keep the focused tool block in view
+		if focusLine < m.viewport.YOffset || focusLine >= m.viewport.YOffset+m.viewport.Height {
+			m.viewport.SetYOffset(focusLine)
+		}
+		return
+	}
 	// Auto-scroll to bottom
 	m.viewport.GotoBottom()
 }
 
+// renderEntry renders one transcript entry for the viewport
+func (m *model) renderEntry(entry transcriptEntry) string {
+	width := m.viewport.Width - 4
+	switch entry.Kind {
+	case entryUser:
+		return userMessageStyle.Render(entry.label()) + "\n" + messageContentStyle.Render(wordWrap(entry.Content, width))
+	case entryAssistant:
+		// The Markdown style brings its own colors and left margin
+		return assistantMessageStyle.Render(entry.label()) + "\n" + m.markdown.render(entry.Content, m.viewport.Width-2)
+	case entryError:
+		return errorStyle.Render(entry.label()) + "\n" + messageContentStyle.Render(wordWrap(entry.Content, width))
+	case entryCommand:
+		return commandStyle.Render(entry.label()) + "\n" + messageContentStyle.Render(wordWrap(entry.Content, width))
+	case entrySystem:
+		return systemStyle.Render(entry.label()) + "\n" + messageContentStyle.Render(wordWrap(entry.Content, width))
+	case entryToolCall:
+		return renderToolBlock(entry, nil, false, false, m.viewport.Width)
+	case entryToolResult:
+		// A result without a matching call
+		return renderToolBlock(transcriptEntry{Kind: entryToolCall, ToolName: entry.ToolName}, &entry, false, false, m.viewport.Width)
+	default:
+		return wordWrap(entry.Content, width)
+	}
+}
+
 // wordWrap wraps text to the specified width
 func wordWrap(text string, width int) string {
 	if width <= 0 {
@@ -510,7 +1023,7 @@ func (m model) View() string {
 	// Display viewport with conversation (with border)
 	viewportContent := viewportStyle.
 		Width(m.width - 4).
-		Height(m.height - 6).
+		Height(m.height - 6 - m.bottomExtraLines()).
 		Render(m.viewport.View())
 	b.WriteString(viewportContent)
 	b.WriteString("\n")
@@ -518,81 +1031,70 @@ func (m model) View() string {
 	// Display input or waiting message at the bottom
 	if m.waiting {
 		var statusMsg string
-		if m.streaming {
-			statusMsg = statusStyle.Render("⏳ Streaming response...")
+		if m.cancelling {
+			statusMsg = statusStyle.Render("⏳ Cancelling...")
+		} else if m.approval != nil {
+			statusMsg = approvalStyle.Render("🔐 " + m.approval.approvalText())
+			if m.approval.preview != "" {
+				statusMsg += "\n" + lipgloss.NewStyle().MarginLeft(1).Render(m.approval.preview)
+			}
+		} else if m.compacting {
+			statusMsg = statusStyle.Render("⏳ Compacting conversation... (Esc to cancel)")
+		} else if m.runningTools {
+			statusMsg = statusStyle.Render("⏳ Running tools... (Esc to cancel)")
+		} else if m.streaming {
+			statusMsg = statusStyle.Render("⏳ Streaming response... (Esc to cancel)")
 		} else {
-			statusMsg = statusStyle.Render("⏳ Waiting for response...")
+			statusMsg = statusStyle.Render("⏳ Waiting for response... (Esc to cancel)")
 		}
 		styledStatus := inputBoxStyle.Width(m.width - 4).Render(statusMsg)
 		b.WriteString(styledStatus)
 	} else {
 		// Style the input box
 		inputContent := m.textInput.View()
+		if m.search != nil {
+			inputContent = m.searchView()
+		}
 		styledInput := inputBoxStyle.Width(m.width - 4).Render(inputContent)
 		b.WriteString(styledInput)
 		b.WriteString("\n")
-		help := helpStyle.Render("Press Ctrl+C or Esc to quit • Arrow keys to scroll")
+		helpText := "Enter to send • Alt+Enter for newline (Shift+Enter only if the terminal sends it as Alt+Enter) • ↑/↓ history • Ctrl+R search • Ctrl+T tool calls • PgUp/PgDn to scroll • Esc to quit"
+		if m.search != nil {
+			helpText = "Type to search • Ctrl+R for older matches • Enter to use • Esc to cancel"
+		}
+		if m.browsingTools {
+			helpText = "↑/↓ to move between tool calls • Enter to expand or collapse • Esc to return"
+		}
+		if usage := m.usage.statusLine(contextWindow(m.backend.Name(), m.modelName)); usage != "" {
+			helpText = usage + " • " + helpText
+		}
+		if m.completionHint != "" {
+			helpText = m.completionHint
+		}
+		help := helpStyle.Render(helpText)
 		b.WriteString(help)
 	}
 
 	return b.String()
 }
 
-func (m model) sendMessage() tea.Cmd {
-	// Streaming is enabled by default, but can be disabled via --no-streaming flag
-	// Some models don't return tool calls with streaming enabled
-	stream := !config.NoStreaming
-
-	// Debug: log the request
-	debugLog.Printf("=== Sending request to %s ===", m.backend.Name())
-	debugLog.Printf("Model: %s", m.modelName)
-	debugLog.Printf("Streaming: %v", stream)
-	debugLog.Printf("Number of tools: %d", len(m.tools))
-	for i, tool := range m.tools {
-		debugLog.Printf("  Tool %d: %s", i, tool.Name)
-	}
-	debugLog.Printf("Number of messages: %d", len(m.messages))
-
+func (m model) sendMessage(ctx context.Context) tea.Cmd {
 	// Return a command that will stream responses
 	return func() tea.Msg {
-		ctx := context.Background()
-
 		go func() {
 			defer close(m.streamChan)
 
-			var fullContent strings.Builder
-			var toolCalls []backend.ToolCall
-
-			err := m.backend.Chat(ctx, m.modelName, m.messages, m.tools, stream, func(chunk backend.StreamChunk) error {
-				debugLog.Printf("Response callback - Content len: %d, Done: %v, ToolCalls: %d",
-					len(chunk.Content), chunk.Done, len(chunk.ToolCalls))
-
-				if chunk.Content != "" {
-					fullContent.WriteString(chunk.Content)
-					// Send chunk update
-					m.streamChan <- streamChunkMsg{content: chunk.Content}
-				}
-
-				// Capture tool calls from the response
-				if len(chunk.ToolCalls) > 0 {
-					debugLog.Printf("Received tool calls: %d", len(chunk.ToolCalls))
-					for _, tc := range chunk.ToolCalls {
-						debugLog.Printf("  Tool call: %s with args: %v", tc.Name, tc.Arguments)
-					}
-					toolCalls = chunk.ToolCalls
-				}
-
-				return nil
+			result, err := chatTurn(ctx, m.backend, m.modelName, m.messages, m.tools, func(content string) {
+				// Send chunk update
+				m.streamChan <- streamChunkMsg{content: content}
 			})
-			if err != nil {
-				m.streamChan <- streamDoneMsg{err: err}
-				return
-			}
 
-			// Send the complete message back to be added to context
+			// On error the partial content is reported so a cancelled turn can keep it
 			m.streamChan <- streamDoneMsg{
-				fullContent: fullContent.String(),
-				toolCalls:   toolCalls,
+				fullContent: result.content,
+				toolCalls:   result.toolCalls,
+				usage:       result.usage,
+				err:         err,
 			}
 		}()
 
@@ -602,47 +1104,9 @@ func (m model) sendMessage() tea.Cmd {
 }
 
 // executeTools runs the requested tool calls and returns their results
-func (m model) executeTools(toolCalls []backend.ToolCall) tea.Cmd {
+func (m model) executeTools(ctx context.Context, toolCalls []backend.ToolCall, denials map[int]string) tea.Cmd {
 	return func() tea.Msg {
-		var results []backend.Message
-
-		for _, toolCall := range toolCalls {
-			args := toolCall.Arguments
-			toolName := toolCall.Name
-
-			// Log tool execution for debugging
-			toolInfo := fmt.Sprintf("Executing tool: %s with args: %v", toolName, args)
-
-			var result string
-			var err error
-
-			// Check if this is an MCP tool
-			if m.mcpManager != nil && m.mcpManager.HasTool(toolName) {
-				result, err = m.mcpManager.ExecuteTool(toolName, args)
-			} else {
-				// Execute built-in tool
-				result, err = executeTool(toolName, args)
-			}
-
-			if err != nil {
-				// Create tool response message with error
-				results = append(results, backend.Message{
-					Role:       "tool",
-					Content:    fmt.Sprintf("Error executing %s: %v\nDebug: %s", toolName, err, toolInfo),
-					ToolCallID: toolCall.ID, // Link back to the tool call
-				})
-				continue
-			}
-
-			// Add successful result with tool call ID
-			results = append(results, backend.Message{
-				Role:       "tool",
-				Content:    result,
-				ToolCallID: toolCall.ID, // Link back to the tool call
-			})
-		}
-
-		return toolExecutionMsg{results: results}
+		return toolExecutionMsg{calls: toolCalls, outcomes: runTools(ctx, m.mcpManager, toolCalls, denials)}
 	}
 }
 
@@ -695,7 +1159,6 @@ func parseJSONToolCalls(content string) []backend.ToolCall {
 	return toolCalls
 }
 
-
 // convertBuiltInTools converts Ollama api.Tools to []backend.Tool
 func convertBuiltInTools() []backend.Tool {
 	ollamaTools := defineTools()
@@ -707,10 +1170,14 @@ func convertBuiltInTools() []backend.Tool {
 		if t.Function.Parameters.Properties != nil {
 			propsMap := t.Function.Parameters.Properties.ToMap()
 			for k, v := range propsMap {
-				props[k] = map[string]interface{}{
+				prop := map[string]interface{}{
 					"type":        v.Type,
 					"description": v.Description,
 				}
+				if len(v.Enum) > 0 {
+					prop["enum"] = v.Enum
+				}
+				props[k] = prop
 			}
 		}
 
@@ -726,4 +1193,4 @@ func convertBuiltInTools() []backend.Tool {
 	}
 
 	return tools
-}
\ No newline at end of file
+}
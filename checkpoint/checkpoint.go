@@ -0,0 +1,202 @@
+// Package checkpoint keeps the state of files before the agent changes them
+// so a turn's changes can be undone, with or without version control.
+package checkpoint
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Checkpoint is the state at the start of a user turn
+type Checkpoint struct {
+	Messages int // length of the message history before the turn, -1 if compacted away
+	Prompt   string
+	Time     time.Time
+	Files    []string // files changed during the turn, in order of their first change
+
+	saved map[string]fileState
+}
+
+// fileState is a file as it was before its first change in a turn
+type fileState struct {
+	existed bool
+	content []byte
+	mode    os.FileMode
+	dirs    []string // missing parent directories of a new file, deepest first
+}
+
+// Store holds the checkpoints of a conversation, oldest first. It is safe
+// for concurrent use.
+type Store struct {
+	mu          sync.Mutex
+	checkpoints []*Checkpoint
+}
+
+// New creates an empty store
+func New() *Store {
+	return &Store{}
+}
+
+// Begin starts a checkpoint for a turn that starts with prompt when the
+// history has messages messages
+func (s *Store) Begin(messages int, prompt string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoints = append(s.checkpoints, &Checkpoint{
+		Messages: messages,
+		Prompt:   prompt,
+		Time:     time.Now(),
+		saved:    make(map[string]fileState),
+	})
+}
+
+// Snapshot records the current state of path, unless it was already
+// recorded during the current turn. It must be called before the file is
+// changed. Without a turn in progress it does nothing.
+func (s *Store) Snapshot(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.checkpoints) == 0 {
+		return nil
+	}
+	cp := s.checkpoints[len(s.checkpoints)-1]
+	if _, ok := cp.saved[path]; ok {
+		return nil
+	}
+
+	state := fileState{}
+	info, err := os.Stat(path)
+	switch {
+	case err == nil:
+		if info.IsDir() {
+			return fmt.Errorf("%s is a directory", path)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		state = fileState{existed: true, content: content, mode: info.Mode().Perm()}
+	case !os.IsNotExist(err):
+		return err
+	default:
+		// Creating the file may create its parent directories too
+		for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+			if _, err := os.Stat(dir); err == nil || dir == filepath.Dir(dir) {
+				break
+			}
+			state.dirs = append(state.dirs, dir)
+		}
+	}
+
+	cp.saved[path] = state
+	cp.Files = append(cp.Files, path)
+	return nil
+}
+
+// Len returns the number of checkpoints
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.checkpoints)
+}
+
+// List returns the checkpoints, oldest first
+func (s *Store) List() []Checkpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Checkpoint, len(s.checkpoints))
+	for i, cp := range s.checkpoints {
+		list[i] = *cp
+		list[i].Files = append([]string(nil), cp.Files...)
+		list[i].saved = nil
+	}
+	return list
+}
+
+// Rewind restores every file changed since checkpoint index began and
+// drops that checkpoint and all later ones. It returns the checkpoint and
+// the restored files. Files that can't be restored are reported in the
+// error; the others are restored anyway.
+func (s *Store) Rewind(index int) (Checkpoint, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if index < 0 || index >= len(s.checkpoints) {
+		return Checkpoint{}, nil, fmt.Errorf("no checkpoint %d", index+1)
+	}
+
+	// Undo the newest changes first so each file ends up as it was when
+	// the checkpoint began
+	var restored []string
+	var errs []error
+	seen := make(map[string]bool)
+	for i := len(s.checkpoints) - 1; i >= index; i-- {
+		cp := s.checkpoints[i]
+		for j := len(cp.Files) - 1; j >= 0; j-- {
+			path := cp.Files[j]
+			if err := restore(path, cp.saved[path]); err != nil {
+				errs = append(errs, fmt.Errorf("failed to restore %s: %w", path, err))
+				continue
+			}
+			if !seen[path] {
+				seen[path] = true
+				restored = append(restored, path)
+			}
+		}
+	}
+
+	cp := *s.checkpoints[index]
+	cp.saved = nil
+	s.checkpoints = s.checkpoints[:index]
+	return cp, restored, errors.Join(errs...)
+}
+
+func restore(path string, state fileState) error {
+	if !state.existed {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, dir := range state.dirs {
+			// Directories that hold other files by now are kept
+			if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+				break
+			}
+		}
+		return nil
+	}
+	if err := os.WriteFile(path, state.content, state.mode); err != nil {
+		return err
+	}
+	// WriteFile only sets the mode of files it creates
+	return os.Chmod(path, state.mode)
+}
+
+// ShiftMessages updates the checkpoints after the messages before cutoff
+// were replaced: later positions move by delta, earlier ones can no longer
+// be restored
+func (s *Store) ShiftMessages(cutoff, delta int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, cp := range s.checkpoints {
+		if cp.Messages >= cutoff {
+			cp.Messages += delta
+		} else {
+			cp.Messages = -1
+		}
+	}
+}
+
+// Reset drops all checkpoints
+func (s *Store) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoints = nil
+}
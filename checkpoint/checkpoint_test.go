@@ -0,0 +1,137 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRewind(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.txt")
+	created := filepath.Join(dir, "created.txt")
+	if err := os.WriteFile(existing, []byte("v1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(s *Store, path, content string) {
+		t.Helper()
+		if err := s.Snapshot(path); err != nil {
+			t.Fatalf("Snapshot: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := New()
+	// Without a turn nothing is recorded
+	write(s, existing, "v1")
+
+	s.Begin(1, "first")
+	write(s, existing, "v2")
+	write(s, existing, "v3") // The state before the turn is kept
+	s.Begin(3, "second")
+	write(s, existing, "v4")
+	write(s, created, "new")
+	s.Begin(5, "third")
+
+	if s.Len() != 3 {
+		t.Fatalf("Len = %d, want 3", s.Len())
+	}
+
+	// Undo the last two turns
+	cp, restored, err := s.Rewind(1)
+	if err != nil {
+		t.Fatalf("Rewind: %v", err)
+	}
+	if cp.Messages != 3 || cp.Prompt != "second" {
+		t.Errorf("checkpoint = %+v", cp)
+	}
+	if len(restored) != 2 {
+		t.Errorf("restored = %v, want both files", restored)
+	}
+	assertContent(t, existing, "v3")
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Errorf("created file should be removed, stat err = %v", err)
+	}
+
+	// Then the first turn
+	if _, _, err := s.Rewind(0); err != nil {
+		t.Fatalf("Rewind: %v", err)
+	}
+	assertContent(t, existing, "v1")
+	if s.Len() != 0 {
+		t.Errorf("Len = %d after rewinding everything", s.Len())
+	}
+	if _, _, err := s.Rewind(0); err == nil {
+		t.Error("expected an error rewinding without checkpoints")
+	}
+}
+
+func TestRewindRestoresModeAndDirectories(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "run.sh")
+	if err := os.WriteFile(script, []byte("echo hi\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	created := filepath.Join(dir, "a", "b", "new.txt")
+	kept := filepath.Join(dir, "keep", "new.txt")
+
+	s := New()
+	s.Begin(1, "change things")
+	for _, path := range []string{script, created, kept} {
+		if err := s.Snapshot(path); err != nil {
+			t.Fatalf("Snapshot: %v", err)
+		}
+	}
+	os.WriteFile(script, []byte("echo bye\n"), 0o644)
+	os.Chmod(script, 0o600)
+	for _, path := range []string{created, kept} {
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		os.WriteFile(path, []byte("new"), 0o644)
+	}
+	// Made by something else in the new directory
+	os.WriteFile(filepath.Join(dir, "keep", "other.txt"), []byte("other"), 0o644)
+
+	if _, _, err := s.Rewind(0); err != nil {
+		t.Fatalf("Rewind: %v", err)
+	}
+	if info, err := os.Stat(script); err != nil {
+		t.Error(err)
+	} else if info.Mode().Perm() != 0o755 {
+		t.Errorf("run.sh mode = %v, want 0755", info.Mode().Perm())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a")); !os.IsNotExist(err) {
+		t.Errorf("created directories not removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "keep", "other.txt")); err != nil {
+		t.Errorf("a directory holding other files was removed: %v", err)
+	}
+}
+
+func TestShiftMessages(t *testing.T) {
+	s := New()
+	s.Begin(1, "a")
+	s.Begin(5, "b")
+	s.Begin(9, "c")
+
+	// Messages 1-4 were replaced by a summary at index 1
+	s.ShiftMessages(5, -3)
+
+	list := s.List()
+	if list[0].Messages != -1 || list[1].Messages != 2 || list[2].Messages != 6 {
+		t.Errorf("messages = %d %d %d, want -1 2 6", list[0].Messages, list[1].Messages, list[2].Messages)
+	}
+}
+
+func assertContent(t *testing.T, path, want string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("%s = %q, want %q", filepath.Base(path), data, want)
+	}
+}
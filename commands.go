@@ -3,10 +3,15 @@ package main
 import (
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/gotha/bitca/backend"
+	"github.com/gotha/bitca/checkpoint"
 	"github.com/gotha/bitca/mcp"
+	"github.com/gotha/bitca/permission"
+	"github.com/gotha/bitca/session"
+	"github.com/gotha/bitca/shell"
 )
 
 // CommandContext provides context for command execution
@@ -15,7 +20,19 @@ type CommandContext struct {
 	Tools          []backend.Tool
 	CurrentModel   string
 	CurrentBackend string
-	SetModel       func(string) // callback to change the model
+	SetModel       func(string)                                 // callback to change the model
+	SetBackend     func(name, modelName string) (string, error) // callback to switch the backend, returns the active model
+	ListModels     func() ([]backend.ModelInfo, error)          // callback to list models on the current backend
+	Usage          tokenUsage
+	ContextWindow  int // 0 if unknown
+	Sessions       *session.Store
+	CurrentSession string                          // empty until the first message is sent
+	ResumeSession  func(id string) (string, error) // callback to load a stored session
+	Compact        func() (int, error)             // callback to start summarizing older turns, returns how many messages
+	Permissions    *permission.Policy
+	Checkpoints    *checkpoint.Store               // nil if changes can't be undone
+	Rewind         func(index int) (string, error) // callback to restore checkpoint index (0-based)
+	Shell          *shell.Session                  // the bash tool's session
 }
 
 // CommandHandler is the function signature for command handlers
@@ -70,9 +87,57 @@ func NewCommandRegistry() *CommandRegistry {
 		Handler:     cmdDebug,
 	})
 
+	registry.Register(Command{
+		Name:        "permissions",
+		Description: "Show or change tool permissions (usage: /permissions [mode <mode> | allow <rule> | deny <rule> | remove <rule>])",
+		Handler:     cmdPermissions,
+	})
+
+	registry.Register(Command{
+		Name:        "usage",
+		Description: "Show token usage and context window fill",
+		Handler:     cmdUsage,
+	})
+
+	registry.Register(Command{
+		Name:        "compact",
+		Description: "Summarize older messages to free up context",
+		Handler:     cmdCompact,
+	})
+
+	registry.Register(Command{
+		Name:        "undo",
+		Description: "Undo the file changes and messages of the last turn",
+		Handler:     cmdUndo,
+	})
+
+	registry.Register(Command{
+		Name:        "rewind",
+		Description: "List checkpoints or go back to one (usage: /rewind [number])",
+		Handler:     cmdRewind,
+	})
+
+	registry.Register(Command{
+		Name:        "shell",
+		Description: "Show the bash session's directory and jobs, restart it or stop its jobs (usage: /shell [restart|kill])",
+		Handler:     cmdShell,
+	})
+
+	registry.Register(Command{
+		Name:        "sessions",
+		Description: "List saved sessions",
+		Handler:     cmdSessions,
+	})
+
+	registry.Register(Command{
+		Name:        "resume",
+		Description: "Resume a saved session (usage: /resume <session_id>)",
+		Handler:     cmdResume,
+	})
+
 	registry.Register(Command{
 		Name:        "backend",
-		Description: "Show current backend information",
+		Description: "Show or switch the current backend (usage: /backend [name] [model])",
 		Handler:     cmdBackend,
 	})
 
@@ -217,10 +282,7 @@ func cmdTools(ctx CommandContext, args []string) (string, error) {
 	builtInTools := []string{}
 	mcpToolsByServer := make(map[string][]string)
 
-	builtInNames := map[string]bool{
-		"read": true, "write": true, "edit": true,
-		"glob": true, "grep": true, "bash": true,
-	}
+	builtInNames := builtInToolNames()
 
 	for _, tool := range ctx.Tools {
 		name := tool.Name
@@ -276,29 +338,154 @@ func cmdTools(ctx CommandContext, args []string) (string, error) {
 
 // cmdModel handles the /model command
 func cmdModel(ctx CommandContext, args []string) (string, error) {
+	var models []backend.ModelInfo
+	var listErr error
+	if ctx.ListModels != nil {
+		models, listErr = ctx.ListModels()
+	} else {
+		listErr = fmt.Errorf("model listing not available")
+	}
+
 	if len(args) == 0 {
-		// Show current model and list recommended models
+		// Show current model and the models the backend actually offers
 		var b strings.Builder
 		b.WriteString(fmt.Sprintf("Current model: %s\n\n", ctx.CurrentModel))
-		b.WriteString("Recommended models for tool calling:\n")
-		b.WriteString("  mistral-small:24b  - Best for tool calling (~14GB)\n")
-		b.WriteString("  llama3.1:8b        - Good tool support (~5GB)\n")
-		b.WriteString("  qwen2.5:14b        - Good reasoning (~10GB)\n")
-		b.WriteString("  qwen2.5:32b        - Best reasoning (~20GB)\n")
-		b.WriteString("  mistral-nemo:12b   - Fast responses (~8GB)\n")
-		b.WriteString("  mistral:7b         - Lightweight (~5GB)\n")
-		b.WriteString("\nUsage: /model <model_name>\n")
-		b.WriteString("Example: /model llama3.1:8b")
+
+		if listErr != nil {
+			b.WriteString(fmt.Sprintf("Could not list models: %v\n", listErr))
+		} else if len(models) == 0 {
+			b.WriteString(fmt.Sprintf("No models available on %s\n", ctx.CurrentBackend))
+		} else {
+			b.WriteString(fmt.Sprintf("Available models (%s):\n", ctx.CurrentBackend))
+			for _, m := range models {
+				marker := "  "
+				if m.Name == ctx.CurrentModel {
+					marker = "* "
+				}
+				if m.Size > 0 {
+					b.WriteString(fmt.Sprintf("  %s%-30s (%s)\n", marker, m.Name, formatSize(m.Size)))
+				} else {
+					b.WriteString(fmt.Sprintf("  %s%s\n", marker, m.Name))
+				}
+			}
+		}
+
+		if ctx.CurrentBackend == "ollama" && listErr == nil && len(models) == 0 {
+			b.WriteString("\nRecommended models for tool calling (install with ollama pull <name>):\n")
+			b.WriteString("  mistral-small:24b  - Best for tool calling (~14GB)\n")
+			b.WriteString("  llama3.1:8b        - Good tool support (~5GB)\n")
+			b.WriteString("  qwen2.5:14b        - Good reasoning (~10GB)\n")
+			b.WriteString("  mistral-nemo:12b   - Fast responses (~8GB)\n")
+		}
+
+		b.WriteString("\nUsage: /model <model_name> (Tab completes model names)")
 		return b.String(), nil
 	}
 
+	if ctx.SetModel == nil {
+		return "Unable to change model", nil
+	}
+
 	newModel := args[0]
-	if ctx.SetModel != nil {
+	if listErr != nil {
+		// Don't block switching when the backend can't be queried
 		ctx.SetModel(newModel)
-		return fmt.Sprintf("Model changed to: %s", newModel), nil
+		return fmt.Sprintf("Model changed to: %s (could not verify: %v)", newModel, listErr), nil
 	}
 
-	return "Unable to change model", nil
+	name, ok := findModel(models, newModel)
+	if !ok {
+		msg := fmt.Sprintf("model '%s' is not available on %s", newModel, ctx.CurrentBackend)
+		if similar := similarModels(models, newModel, 5); len(similar) > 0 {
+			msg += fmt.Sprintf(" (did you mean: %s?)", strings.Join(similar, ", "))
+		}
+		return "", fmt.Errorf("%s", msg)
+	}
+
+	ctx.SetModel(name)
+	return fmt.Sprintf("Model changed to: %s", name), nil
+}
+
+// findModel looks up name in models, accepting Ollama's implicit ":latest" tag
+func findModel(models []backend.ModelInfo, name string) (string, bool) {
+	for _, m := range models {
+		if m.Name == name || m.Name == name+":latest" {
+			return m.Name, true
+		}
+	}
+	return "", false
+}
+
+// similarModels returns up to limit model names containing name (case-insensitive)
+func similarModels(models []backend.ModelInfo, name string, limit int) []string {
+	var similar []string
+	needle := strings.ToLower(strings.SplitN(name, ":", 2)[0])
+	for _, m := range models {
+		if strings.Contains(strings.ToLower(m.Name), needle) {
+			similar = append(similar, m.Name)
+			if len(similar) >= limit {
+				break
+			}
+		}
+	}
+	return similar
+}
+
+// formatSize formats a byte count for model listings (e.g. "4.7GB")
+func formatSize(size int64) string {
+	const gb = 1 << 30
+	const mb = 1 << 20
+	if size >= gb {
+		return fmt.Sprintf("%.1fGB", float64(size)/gb)
+	}
+	return fmt.Sprintf("%dMB", size/mb)
+}
+
+// completeInput tab-completes a slash command name, or a model name after
+// "/model ". It returns the completed input and, when the completion is
+// ambiguous, the candidates that matched.
+func completeInput(input string, commands []Command, models []string) (string, []string) {
+	if !strings.HasPrefix(input, "/") {
+		return input, nil
+	}
+
+	var prefix, partial string
+	var options []string
+
+	if name, rest, found := strings.Cut(input[1:], " "); found {
+		if strings.ToLower(name) != "model" || strings.Contains(rest, " ") {
+			return input, nil
+		}
+		prefix, partial, options = "/"+name+" ", rest, models
+	} else {
+		prefix, partial = "/", name
+		for _, cmd := range commands {
+			options = append(options, cmd.Name)
+		}
+	}
+
+	var matches []string
+	for _, opt := range options {
+		if strings.HasPrefix(opt, partial) {
+			matches = append(matches, opt)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return input, nil
+	case 1:
+		return prefix + matches[0] + " ", nil
+	}
+
+	// Extend to the longest common prefix of all matches
+	common := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	return prefix + common, matches
 }
 
 // cmdDebug handles the /debug command
@@ -316,10 +503,7 @@ func cmdDebug(ctx CommandContext, args []string) (string, error) {
 	// Count built-in vs MCP tools
 	builtInCount := 0
 	mcpCount := 0
-	builtInNames := map[string]bool{
-		"read": true, "write": true, "edit": true,
-		"glob": true, "grep": true, "bash": true,
-	}
+	builtInNames := builtInToolNames()
 
 	for _, tool := range ctx.Tools {
 		if builtInNames[tool.Name] {
@@ -346,14 +530,286 @@ func cmdDebug(ctx CommandContext, args []string) (string, error) {
 	return b.String(), nil
 }
 
-
 // cmdBackend handles the /backend command
 func cmdBackend(ctx CommandContext, args []string) (string, error) {
+	if len(args) == 0 {
+		var b strings.Builder
+		b.WriteString(fmt.Sprintf("Current Backend: %s\n", ctx.CurrentBackend))
+		b.WriteString(fmt.Sprintf("Current Model: %s\n", ctx.CurrentModel))
+		b.WriteString("\nAvailable backends:\n")
+		b.WriteString("  ollama     (local Ollama)\n")
+		b.WriteString("  openai     (requires OPENAI_API_KEY)\n")
+		b.WriteString("  anthropic  (requires ANTHROPIC_API_KEY)\n")
+		b.WriteString("  gemini     (requires GEMINI_API_KEY)\n")
+		b.WriteString("\nUsage: /backend <name> [model]\n")
+		b.WriteString("Example: /backend openai gpt-4o")
+		return b.String(), nil
+	}
+
+	if ctx.SetBackend == nil {
+		return "Unable to change backend", nil
+	}
+
+	name := strings.ToLower(args[0])
+	modelName := ""
+	if len(args) > 1 {
+		modelName = args[1]
+	}
+
+	activeModel, err := ctx.SetBackend(name, modelName)
+	if err != nil {
+		return "", fmt.Errorf("failed to switch backend: %w", err)
+	}
+
+	return fmt.Sprintf("Switched to backend %s (model %s), conversation history kept", name, activeModel), nil
+}
+
+// cmdSessions handles the /sessions command
+func cmdSessions(ctx CommandContext, args []string) (string, error) {
+	if ctx.Sessions == nil {
+		return "Session storage is not available", nil
+	}
+
+	infos, err := ctx.Sessions.List()
+	if err != nil {
+		return "", fmt.Errorf("failed to list sessions: %w", err)
+	}
+	if len(infos) == 0 {
+		return "No saved sessions", nil
+	}
+
+	const maxShown = 20
 	var b strings.Builder
-	b.WriteString(fmt.Sprintf("Current Backend: %s\n", ctx.CurrentBackend))
-	b.WriteString(fmt.Sprintf("Current Model: %s\n", ctx.CurrentModel))
-	b.WriteString("\nNote: To switch backends, restart the application with:\n")
-	b.WriteString("  -backend ollama   (default, local Ollama)\n")
-	b.WriteString("  -backend openai   (requires OPENAI_API_KEY)\n")
+	b.WriteString(fmt.Sprintf("Saved sessions (%d total, newest first):\n", len(infos)))
+	for i, info := range infos {
+		if i >= maxShown {
+			b.WriteString(fmt.Sprintf("  ... and %d more\n", len(infos)-maxShown))
+			break
+		}
+		marker := "  "
+		if info.ID == ctx.CurrentSession {
+			marker = "* "
+		}
+		title := info.Title
+		if title == "" {
+			title = "(no messages)"
+		}
+		b.WriteString(fmt.Sprintf("%s%s  %s  %3d msgs  %s/%s  %s\n", marker, info.ID,
+			info.Updated.Format("2006-01-02 15:04"), info.MessageCount, info.Backend, info.Model, title))
+	}
+	b.WriteString("\nUsage: /resume <session_id> (a unique prefix is enough)")
 	return b.String(), nil
-}
\ No newline at end of file
+}
+
+// cmdResume handles the /resume command
+func cmdResume(ctx CommandContext, args []string) (string, error) {
+	if len(args) == 0 {
+		return "Usage: /resume <session_id> (see /sessions)", nil
+	}
+	if ctx.ResumeSession == nil {
+		return "Unable to resume sessions", nil
+	}
+
+	id, err := ctx.ResumeSession(args[0])
+	if err != nil {
+		return "", fmt.Errorf("failed to resume session: %w", err)
+	}
+	return fmt.Sprintf("Now continuing session %s", id), nil
+}
+
+// cmdUsage handles the /usage command
+func cmdUsage(ctx CommandContext, args []string) (string, error) {
+	u := ctx.Usage
+	if u.Requests == 0 {
+		return "No token usage reported yet", nil
+	}
+
+	var b strings.Builder
+	b.WriteString("Token Usage:\n\n")
+	b.WriteString(fmt.Sprintf("Session (%d requests):\n", u.Requests))
+	b.WriteString(fmt.Sprintf("  Prompt tokens:     %d\n", u.PromptTokens))
+	b.WriteString(fmt.Sprintf("  Completion tokens: %d\n", u.CompletionTokens))
+	b.WriteString(fmt.Sprintf("  Total:             %d\n", u.PromptTokens+u.CompletionTokens))
+	b.WriteString("\nLast request:\n")
+	b.WriteString(fmt.Sprintf("  Prompt tokens:     %d\n", u.LastPromptTokens))
+	b.WriteString(fmt.Sprintf("  Completion tokens: %d\n", u.LastCompletionTokens))
+
+	b.WriteString("\nContext window:\n")
+	if ctx.ContextWindow > 0 {
+		pct := u.contextPercent(ctx.ContextWindow)
+		b.WriteString(fmt.Sprintf("  %d / %d tokens (%d%%) for %s/%s\n", u.contextTokens(), ctx.ContextWindow, pct,
+			ctx.CurrentBackend, ctx.CurrentModel))
+		if pct >= 80 {
+			b.WriteString("  Warning: the context is almost full; use /compact to summarize older messages\n")
+		}
+	} else {
+		b.WriteString(fmt.Sprintf("  Unknown for %s/%s (set it with -context-window)\n", ctx.CurrentBackend, ctx.CurrentModel))
+	}
+
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// cmdCompact handles the /compact command
+func cmdCompact(ctx CommandContext, args []string) (string, error) {
+	if ctx.Compact == nil {
+		return "Unable to compact the conversation", nil
+	}
+
+	n, err := ctx.Compact()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Summarizing %d earlier messages with %s...", n, ctx.CurrentModel), nil
+}
+
+// cmdUndo handles the /undo command
+func cmdUndo(ctx CommandContext, args []string) (string, error) {
+	if ctx.Checkpoints == nil || ctx.Rewind == nil {
+		return "Undo is not available", nil
+	}
+	if ctx.Checkpoints.Len() == 0 {
+		return "Nothing to undo", nil
+	}
+	return ctx.Rewind(ctx.Checkpoints.Len() - 1)
+}
+
+// cmdRewind handles the /rewind command
+func cmdRewind(ctx CommandContext, args []string) (string, error) {
+	if ctx.Checkpoints == nil || ctx.Rewind == nil {
+		return "Rewind is not available", nil
+	}
+
+	checkpoints := ctx.Checkpoints.List()
+	if len(checkpoints) == 0 {
+		return "No checkpoints yet; one is made before every message you send", nil
+	}
+
+	if len(args) == 0 {
+		var b strings.Builder
+		b.WriteString("Checkpoints (oldest first):\n")
+		for i, cp := range checkpoints {
+			files := fmt.Sprintf("%d file(s) changed", len(cp.Files))
+			if len(cp.Files) == 0 {
+				files = "no file changes"
+			}
+			b.WriteString(fmt.Sprintf("  %2d  %s  %-18s %s\n", i+1, cp.Time.Format("15:04:05"), files, clipLine(firstLine(cp.Prompt), 60)))
+		}
+		b.WriteString("\nUsage: /rewind <number> restores the files and the conversation to before that message")
+		return b.String(), nil
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > len(checkpoints) {
+		return "", fmt.Errorf("checkpoint must be a number from 1 to %d", len(checkpoints))
+	}
+	return ctx.Rewind(n - 1)
+}
+
+// cmdShell handles the /shell command
+func cmdShell(ctx CommandContext, args []string) (string, error) {
+	if ctx.Shell == nil {
+		return "The shell is not available", nil
+	}
+
+	if len(args) == 0 {
+		var b strings.Builder
+		b.WriteString(fmt.Sprintf("bash runs in %s\n", ctx.Shell.Cwd()))
+		if jobs := ctx.Shell.Jobs(); len(jobs) > 0 {
+			b.WriteString("\nBackground jobs:\n")
+			for _, job := range jobs {
+				b.WriteString(fmt.Sprintf("  %-4s %-20s %s\n", job.ID, job.Status(), clipLine(firstLine(job.Command), 60)))
+			}
+		}
+		b.WriteString("\nUsage: /shell restart goes back to the workspace root and the original environment,\n/shell kill stops the background jobs")
+		return b.String(), nil
+	}
+	if args[0] == "kill" {
+		n := len(ctx.Shell.Jobs())
+		ctx.Shell.KillAll()
+		return fmt.Sprintf("Stopped %d background job(s)", n), nil
+	}
+	if args[0] != "restart" {
+		return "", fmt.Errorf("unknown argument %q (usage: /shell [restart|kill])", args[0])
+	}
+	ctx.Shell.Restart()
+	return fmt.Sprintf("Restarted the shell in %s", ctx.Shell.Cwd()), nil
+}
+
+// cmdPermissions handles the /permissions command
+func cmdPermissions(ctx CommandContext, args []string) (string, error) {
+	policy := ctx.Permissions
+	if policy == nil {
+		return "Permissions are not available", nil
+	}
+
+	if len(args) == 0 {
+		var b strings.Builder
+		b.WriteString(fmt.Sprintf("Mode: %s\n", policy.Mode))
+		b.WriteString(fmt.Sprintf("Rules file: %s\n", policy.Path()))
+		b.WriteString("\nAllow rules:\n")
+		if len(policy.Allow) == 0 {
+			b.WriteString("  (none)\n")
+		}
+		for _, rule := range policy.Allow {
+			b.WriteString(fmt.Sprintf("  %s\n", rule))
+		}
+		b.WriteString("\nDeny rules:\n")
+		if len(policy.Deny) == 0 {
+			b.WriteString("  (none)\n")
+		}
+		for _, rule := range policy.Deny {
+			b.WriteString(fmt.Sprintf("  %s\n", rule))
+		}
+		if path := policy.ProjectPath(); path != "" {
+			b.WriteString(fmt.Sprintf("\nDeny rules from %s:\n", path))
+			if len(policy.ProjectDeny) == 0 {
+				b.WriteString("  (none)\n")
+			}
+			for _, rule := range policy.ProjectDeny {
+				b.WriteString(fmt.Sprintf("  %s\n", rule))
+			}
+		}
+		b.WriteString("\nModes: ask (always ask), auto-read (run read/glob/grep without asking), allow-all\n")
+		b.WriteString("Usage: /permissions mode <mode> | allow <rule> | deny <rule> | remove <rule>\n")
+		b.WriteString("Rules look like read, bash(go test *) or write(docs/*)")
+		return b.String(), nil
+	}
+
+	if len(args) < 2 {
+		return "", fmt.Errorf("usage: /permissions %s <value>", args[0])
+	}
+	value := strings.Join(args[1:], " ")
+
+	switch strings.ToLower(args[0]) {
+	case "mode":
+		mode, err := permission.ParseMode(value)
+		if err != nil {
+			return "", err
+		}
+		policy.Mode = mode
+		return fmt.Sprintf("Permission mode set to %s for this session", mode), nil
+	case "allow", "deny", "remove":
+		rule, err := permission.ParseRule(value)
+		if err != nil {
+			return "", err
+		}
+		switch strings.ToLower(args[0]) {
+		case "allow":
+			err = policy.AddAllow(rule)
+		case "deny":
+			err = policy.AddDeny(rule)
+		default:
+			var found bool
+			found, err = policy.Remove(rule)
+			if err == nil && !found {
+				return "", fmt.Errorf("no rule %s", rule)
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Updated %s: %s %s", policy.Path(), strings.ToLower(args[0]), rule), nil
+	default:
+		return "", fmt.Errorf("unknown subcommand '%s' (use mode, allow, deny or remove)", args[0])
+	}
+}
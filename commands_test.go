@@ -1,7 +1,14 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
+
+	"github.com/gotha/bitca/backend"
+	"github.com/gotha/bitca/shell"
 )
 
 func TestParseCommand(t *testing.T) {
@@ -93,6 +100,119 @@ func TestCmdHelp(t *testing.T) {
 	}
 }
 
+func TestCmdBackendSwitch(t *testing.T) {
+	var gotName, gotModel string
+	ctx := CommandContext{
+		CurrentBackend: "ollama",
+		SetBackend: func(name, modelName string) (string, error) {
+			gotName, gotModel = name, modelName
+			return "gpt-4o", nil
+		},
+	}
+
+	output, err := cmdBackend(ctx, []string{"OpenAI"})
+	if err != nil {
+		t.Fatalf("cmdBackend returned error: %v", err)
+	}
+	if gotName != "openai" || gotModel != "" {
+		t.Errorf("SetBackend called with (%q, %q), want (\"openai\", \"\")", gotName, gotModel)
+	}
+	if !contains(output, "gpt-4o") {
+		t.Errorf("Expected output to mention the active model, got %q", output)
+	}
+}
+
+func TestCmdModelValidation(t *testing.T) {
+	current := "llama3.1:8b"
+	ctx := CommandContext{
+		CurrentModel:   current,
+		CurrentBackend: "ollama",
+		SetModel:       func(name string) { current = name },
+		ListModels: func() ([]backend.ModelInfo, error) {
+			return []backend.ModelInfo{{Name: "llama3.1:8b"}, {Name: "qwen2.5:latest"}}, nil
+		},
+	}
+
+	// Implicit :latest tag resolves to the installed model
+	if _, err := cmdModel(ctx, []string{"qwen2.5"}); err != nil {
+		t.Fatalf("cmdModel returned error: %v", err)
+	}
+	if current != "qwen2.5:latest" {
+		t.Errorf("model = %q, want qwen2.5:latest", current)
+	}
+
+	// Typos are rejected with a suggestion and leave the model unchanged
+	_, err := cmdModel(ctx, []string{"llama3.1:70b"})
+	if err == nil {
+		t.Fatal("expected error for unknown model")
+	}
+	if !contains(err.Error(), "llama3.1:8b") {
+		t.Errorf("expected suggestion in error, got %q", err)
+	}
+	if current != "qwen2.5:latest" {
+		t.Errorf("model changed to %q after failed validation", current)
+	}
+
+	// When the backend can't be queried the switch still happens
+	ctx.ListModels = func() ([]backend.ModelInfo, error) { return nil, fmt.Errorf("offline") }
+	if _, err := cmdModel(ctx, []string{"mistral:7b"}); err != nil {
+		t.Fatalf("cmdModel returned error: %v", err)
+	}
+	if current != "mistral:7b" {
+		t.Errorf("model = %q, want mistral:7b", current)
+	}
+}
+
+func TestCompleteInput(t *testing.T) {
+	commands := NewCommandRegistry().GetAllCommands()
+	models := []string{"llama3.1:8b", "llama3.2:3b", "mistral:7b"}
+
+	tests := []struct {
+		input          string
+		expected       string
+		wantCandidates int
+	}{
+		{"/mo", "/model ", 0},
+		{"/model mis", "/model mistral:7b ", 0},
+		{"/model lla", "/model llama3.", 2},
+		{"/model x", "/model x", 0},
+		{"hello", "hello", 0},
+	}
+
+	for _, tt := range tests {
+		got, candidates := completeInput(tt.input, commands, models)
+		if got != tt.expected {
+			t.Errorf("completeInput(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+		if len(candidates) != tt.wantCandidates {
+			t.Errorf("completeInput(%q) candidates = %v, want %d", tt.input, candidates, tt.wantCandidates)
+		}
+	}
+}
+
+func TestCmdUsage(t *testing.T) {
+	ctx := CommandContext{CurrentBackend: "ollama", CurrentModel: "llama3.1:8b", ContextWindow: 4096}
+
+	output, _ := cmdUsage(ctx, nil)
+	if output != "No token usage reported yet" {
+		t.Errorf("unexpected output without usage: %q", output)
+	}
+
+	ctx.Usage.add(backend.Usage{PromptTokens: 1000, CompletionTokens: 100})
+	ctx.Usage.add(backend.Usage{PromptTokens: 3200, CompletionTokens: 300})
+
+	output, err := cmdUsage(ctx, nil)
+	if err != nil {
+		t.Fatalf("cmdUsage returned error: %v", err)
+	}
+	if !contains(output, "4200") {
+		t.Errorf("expected session prompt total in output, got %q", output)
+	}
+	if !contains(output, "3500 / 4096 tokens (85%)") || !contains(output, "Warning") {
+		t.Errorf("expected context fill with warning, got %q", output)
+	}
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > 0 && containsHelper(s, substr))
 }
@@ -106,3 +226,53 @@ func containsHelper(s, substr string) bool {
 	return false
 }
 
+
+func TestCmdShell(t *testing.T) {
+	dir := t.TempDir()
+	ctx := CommandContext{Shell: shell.New(dir)}
+	if err := ctx.Shell.Run(context.Background(), "cd /", io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := cmdShell(ctx, nil)
+	if err != nil || !strings.Contains(out, "bash runs in /\n") {
+		t.Errorf("cmdShell() = %q, %v", out, err)
+	}
+
+	out, err = cmdShell(ctx, []string{"restart"})
+	if err != nil || ctx.Shell.Cwd() != dir {
+		t.Errorf("cmdShell(restart) = %q, %v; cwd %s", out, err, ctx.Shell.Cwd())
+	}
+
+	if _, err := cmdShell(ctx, []string{"stop"}); err == nil {
+		t.Error("expected an error for an unknown argument")
+	}
+}
+
+func TestCmdDebugCountsBuiltInTools(t *testing.T) {
+	ctx := CommandContext{CurrentBackend: "ollama", CurrentModel: "llama3.1:8b", Tools: convertBuiltInTools()}
+	output, err := cmdDebug(ctx, nil)
+	if err != nil {
+		t.Fatalf("cmdDebug returned error: %v", err)
+	}
+	if !contains(output, fmt.Sprintf("Built-in: %d\n", len(ctx.Tools))) || !contains(output, "MCP: 0\n") {
+		t.Errorf("expected every tool to count as built-in, got %q", output)
+	}
+}
+
+func TestBackendTitle(t *testing.T) {
+	anthropic, err := backend.NewAnthropicBackend("key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gemini, err := backend.NewGeminiBackend("key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := backendTitle(anthropic); got != "Anthropic" {
+		t.Errorf("backendTitle(anthropic) = %q", got)
+	}
+	if got := backendTitle(gemini); got != "Gemini" {
+		t.Errorf("backendTitle(gemini) = %q", got)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/gotha/bitca/backend"
+)
+
+// compactKeepTurns is the number of most recent user turns (with all their
+// tool exchanges) that compaction keeps verbatim
+const compactKeepTurns = 2
+
+// compactSummaryPrefix marks the message that replaces compacted turns
+const compactSummaryPrefix = "Summary of the earlier conversation:\n\n"
+
+// compactionPrompt instructs the backend how to summarize older turns
+const compactionPrompt = `You summarize conversations between a user and an AI coding assistant so the conversation can continue with less context.
+
+Write a concise summary that preserves:
+- the user's goals and any requirements or constraints they stated
+- files that were read, created or modified, and what changed in them
+- commands that were run and their important results or errors
+- decisions made, open questions and the next steps that were planned
+
+Do not add commentary. Only output the summary.`
+
+// compactDoneMsg reports the result of summarizing older turns
+type compactDoneMsg struct {
+	summary      string
+	cutoff       int  // messages[1:cutoff] were summarized
+	continueTurn bool // send the pending user message afterwards (automatic compaction)
+	usage        *backend.Usage
+	err          error
+}
+
+// compactionCutoff returns the index of the first message to keep verbatim:
+// the start of the keepTurns-th most recent user turn. It returns 0 if there
+// is nothing old enough to compact.
+func compactionCutoff(messages []backend.Message, keepTurns int) int {
+	turns := 0
+	for i := len(messages) - 1; i > 0; i-- {
+		if messages[i].Role == "user" && !isCompactionSummary(messages[i]) {
+			turns++
+			if turns == keepTurns {
+				// Only worth it if there is more than a previous summary to fold in
+				for _, msg := range messages[1:i] {
+					if !isCompactionSummary(msg) {
+						return i
+					}
+				}
+				return 0
+			}
+		}
+	}
+	return 0
+}
+
+// isCompactionSummary reports whether msg is a summary from an earlier compaction
+func isCompactionSummary(msg backend.Message) bool {
+	return msg.Role == "user" && strings.HasPrefix(msg.Content, compactSummaryPrefix)
+}
+
+// applyCompaction replaces messages[1:cutoff] with a single summary message,
+// keeping the system prompt and the recent turns
+func applyCompaction(messages []backend.Message, cutoff int, summary string) []backend.Message {
+	result := make([]backend.Message, 0, len(messages)-cutoff+2)
+	result = append(result, messages[0])
+	result = append(result, backend.Message{Role: "user", Content: compactSummaryPrefix + strings.TrimSpace(summary)})
+	result = append(result, messages[cutoff:]...)
+	return result
+}
+
+// compactionTranscript renders messages as plain text for the summarizer.
+// Long contents are clipped so the request fits small context windows.
+func compactionTranscript(messages []backend.Message) string {
+	var b strings.Builder
+	for _, msg := range messages {
+		switch msg.Role {
+		case "user":
+			if isCompactionSummary(msg) {
+				b.WriteString("Earlier summary: " + strings.TrimPrefix(msg.Content, compactSummaryPrefix))
+			} else {
+				b.WriteString("User: " + clip(msg.Content, 2000))
+			}
+		case "assistant":
+			if msg.Content != "" {
+				b.WriteString("Assistant: " + clip(msg.Content, 2000) + "\n")
+			}
+			for _, tc := range msg.ToolCalls {
+				args, _ := json.Marshal(tc.Arguments)
+				b.WriteString(fmt.Sprintf("Assistant called tool %s with %s\n", tc.Name, clip(string(args), 500)))
+			}
+		case "tool":
+			b.WriteString("Tool result: " + clip(msg.Content, 500))
+		default:
+			continue
+		}
+		b.WriteString("\n\n")
+	}
+	return b.String()
+}
+
+// clip shortens s to at most max bytes, marking the cut
+func clip(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	// Cut at a character boundary
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "... (clipped)"
+}
+
+// imageTokens is roughly what an attached image costs; the APIs charge by
+// its size, up to about this much
+const imageTokens = 1600
+
+// estimateTokens roughly estimates the token count of messages (~4 bytes per
+// token), counting the images that are still sent
+func estimateTokens(messages []backend.Message) int {
+	n := 0
+	images := 0
+	latest := latestTurn(messages)
+	for i, msg := range messages {
+		n += len(msg.Content)
+		for _, tc := range msg.ToolCalls {
+			args, _ := json.Marshal(tc.Arguments)
+			n += len(tc.Name) + len(args)
+		}
+		if i >= latest {
+			images += len(msg.Images)
+		}
+	}
+	return n/4 + images*imageTokens
+}
+
+// needsCompaction reports whether the context is full enough to compact
+// automatically before the next request
+func (m model) needsCompaction() bool {
+	if config.CompactThreshold <= 0 {
+		return false
+	}
+	pct := m.usage.contextPercent(contextWindow(m.backend.Name(), m.modelName))
+	return pct >= config.CompactThreshold && compactionCutoff(m.messages, compactKeepTurns) > 0
+}
+
+// compactConversation asks the backend to summarize everything before the
+// most recent turns. The result is applied when compactDoneMsg arrives.
+func (m model) compactConversation(ctx context.Context, continueTurn bool) tea.Cmd {
+	cutoff := compactionCutoff(m.messages, compactKeepTurns)
+	if cutoff == 0 {
+		return func() tea.Msg {
+			return compactDoneMsg{continueTurn: continueTurn, err: fmt.Errorf("nothing to compact yet")}
+		}
+	}
+
+	request := []backend.Message{
+		{Role: "system", Content: compactionPrompt},
+		{Role: "user", Content: "Summarize this conversation:\n\n" + compactionTranscript(m.messages[1:cutoff])},
+	}
+
+	llmBackend := m.backend
+	modelName := m.modelName
+	debugLog.Printf("Compacting %d messages with %s", cutoff-1, modelName)
+
+	return func() tea.Msg {
+		var summary strings.Builder
+		var usage *backend.Usage
+		err := llmBackend.Chat(ctx, modelName, request, nil, false, func(chunk backend.StreamChunk) error {
+			summary.WriteString(chunk.Content)
+			if chunk.Usage != nil {
+				usage = chunk.Usage
+			}
+			return nil
+		})
+		if err == nil && strings.TrimSpace(summary.String()) == "" {
+			err = fmt.Errorf("the model returned an empty summary")
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+
+		return compactDoneMsg{
+			summary:      summary.String(),
+			cutoff:       cutoff,
+			continueTurn: continueTurn,
+			usage:        usage,
+			err:          err,
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/gotha/bitca/backend"
+)
+
+func TestCompactionCutoff(t *testing.T) {
+	messages := []backend.Message{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "first"},
+		{Role: "assistant", Content: "answer"},
+		{Role: "user", Content: "second"},
+		{Role: "assistant", ToolCalls: []backend.ToolCall{{ID: "call_1", Name: "read"}}},
+		{Role: "tool", ToolCallID: "call_1", Content: "data"},
+		{Role: "assistant", Content: "done"},
+		{Role: "user", Content: "third"},
+	}
+
+	// The last two turns start at "second", keeping its tool exchange intact
+	if got := compactionCutoff(messages, 2); got != 3 {
+		t.Fatalf("cutoff = %d, want 3", got)
+	}
+	if got := compactionCutoff(messages[:4], 2); got != 0 {
+		t.Errorf("cutoff with only two turns = %d, want 0", got)
+	}
+
+	compacted := applyCompaction(messages, 3, "they asked twice")
+	if len(compacted) != 7 {
+		t.Fatalf("expected 7 messages, got %d", len(compacted))
+	}
+	if compacted[0].Role != "system" || !isCompactionSummary(compacted[1]) || compacted[2].Content != "second" {
+		t.Errorf("unexpected compacted history: %+v", compacted[:3])
+	}
+	if !strings.HasSuffix(compacted[1].Content, "they asked twice") {
+		t.Errorf("summary not included: %q", compacted[1].Content)
+	}
+
+	// A previous summary alone is not worth compacting again
+	if got := compactionCutoff(compacted[:4], 2); got != 0 {
+		t.Errorf("cutoff over a lone summary = %d, want 0", got)
+	}
+	compacted = append(compacted, backend.Message{Role: "assistant", Content: "ok"}, backend.Message{Role: "user", Content: "fourth"})
+	if got := compactionCutoff(compacted, 2); got != 6 {
+		t.Errorf("cutoff after more turns = %d, want 6", got)
+	}
+}
+
+func TestCompactionTranscript(t *testing.T) {
+	transcript := compactionTranscript([]backend.Message{
+		{Role: "user", Content: "fix the build"},
+		{Role: "assistant", ToolCalls: []backend.ToolCall{{Name: "bash", Arguments: map[string]interface{}{"cmd": "go build"}}}},
+		{Role: "tool", Content: strings.Repeat("x", 1000)},
+	})
+
+	for _, want := range []string{"User: fix the build", "Assistant called tool bash", "(clipped)"} {
+		if !strings.Contains(transcript, want) {
+			t.Errorf("transcript missing %q:\n%s", want, transcript)
+		}
+	}
+}
+
+func TestClipKeepsCharactersWhole(t *testing.T) {
+	got := clip("añb", 2)
+	if got != "a... (clipped)" {
+		t.Errorf("clip = %q, want the cut before the split character", got)
+	}
+	if !utf8.ValidString(got) {
+		t.Errorf("clip produced invalid UTF-8: %q", got)
+	}
+}
+
+func TestImagesSentOnce(t *testing.T) {
+	image := []backend.Image{{MediaType: "image/png", Data: []byte("png")}}
+	messages := []backend.Message{
+		{Role: "user", Content: "look at a.png"},
+		{Role: "assistant", ToolCalls: []backend.ToolCall{{ID: "1", Name: "read"}}},
+		{Role: "tool", ToolCallID: "1", Content: "a.png is an image", Images: image},
+		{Role: "assistant", ToolCalls: []backend.ToolCall{{ID: "2", Name: "read"}}},
+		{Role: "tool", ToolCallID: "2", Content: "b.png is an image", Images: image},
+	}
+
+	sent := dropOldImages(messages)
+	if len(sent[2].Images) != 0 || len(sent[4].Images) != 1 {
+		t.Errorf("images sent: %d and %d, want only the latest", len(sent[2].Images), len(sent[4].Images))
+	}
+	if len(messages[2].Images) != 1 {
+		t.Error("the history itself lost its images")
+	}
+
+	without := estimateTokens(append(messages[:4:4], backend.Message{Role: "tool", ToolCallID: "2", Content: "b.png is an image"}))
+	if got := estimateTokens(messages); got != without+imageTokens {
+		t.Errorf("estimate %d, want %d for the text and one image", got, without+imageTokens)
+	}
+
+	data, err := json.Marshal(messages[2])
+	if err != nil || strings.Contains(string(data), "images") {
+		t.Errorf("image saved with the message: %s, %v", data, err)
+	}
+}
@@ -0,0 +1,265 @@
+// Package diff computes line-based diffs and formats them as unified diffs.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is the kind of a line in an edit script
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// Edit is one line of an edit script that turns the old text into the new
+type Edit struct {
+	Op   Op
+	Line string
+}
+
+// Hunk is a group of changes with surrounding context lines. Line numbers
+// are 1-based; Lines hold the lines prefixed with ' ', '+' or '-'.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []string
+}
+
+// Header returns the hunk's "@@ -a,b +c,d @@" line
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	if lines == 0 {
+		// An empty range names the line before it
+		start--
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// SplitLines splits text into lines without their line endings. A missing
+// newline at the end is not an extra line.
+func SplitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	return lines
+}
+
+// Lines computes a shortest edit script from a to b (Myers' algorithm)
+func Lines(a, b []string) []Edit {
+	// Common prefix and suffix are cheap to peel off and usually most of a file
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var edits []Edit
+	for _, line := range a[:prefix] {
+		edits = append(edits, Edit{Equal, line})
+	}
+	edits = append(edits, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, Edit{Equal, line})
+	}
+	return edits
+}
+
+// maxEditDistance bounds the work spent on a minimal diff. Texts that
+// differ more are diffed as a plain replacement of the changed region.
+const maxEditDistance = 2000
+
+func myers(a, b []string) []Edit {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replace(a, b)
+	}
+
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] holds v[-d-1..d+1] as it was before round d
+	var trace [][]int
+
+	for d := 0; d <= max && d <= maxEditDistance; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+	return replace(a, b)
+}
+
+// replace is the edit script that deletes all of a and inserts all of b
+func replace(a, b []string) []Edit {
+	edits := make([]Edit, 0, len(a)+len(b))
+	for _, line := range a {
+		edits = append(edits, Edit{Delete, line})
+	}
+	for _, line := range b {
+		edits = append(edits, Edit{Insert, line})
+	}
+	return edits
+}
+
+// backtrack walks the saved frontiers back from the end to recover the path
+func backtrack(a, b []string, trace [][]int) []Edit {
+	x, y := len(a), len(b)
+	var reversed []Edit
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := func(k int) int { return trace[d][k+d+1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v(k-1) < v(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, Edit{Equal, a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				reversed = append(reversed, Edit{Insert, b[y]})
+			} else {
+				x--
+				reversed = append(reversed, Edit{Delete, a[x]})
+			}
+		}
+	}
+
+	edits := make([]Edit, len(reversed))
+	for i, e := range reversed {
+		edits[len(reversed)-1-i] = e
+	}
+	return edits
+}
+
+// Stat counts the added and removed lines of an edit script
+func Stat(edits []Edit) (added, removed int) {
+	for _, e := range edits {
+		switch e.Op {
+		case Insert:
+			added++
+		case Delete:
+			removed++
+		}
+	}
+	return added, removed
+}
+
+// Hunks groups the changes of an edit script with context lines around them.
+// Changes closer than twice the context share a hunk.
+func Hunks(edits []Edit, context int) []Hunk {
+	// Line numbers in the old and new text at each edit
+	oldLines := make([]int, len(edits))
+	newLines := make([]int, len(edits))
+	oldLine, newLine := 1, 1
+	var changes []int
+	for i, e := range edits {
+		oldLines[i], newLines[i] = oldLine, newLine
+		if e.Op != Insert {
+			oldLine++
+		}
+		if e.Op != Delete {
+			newLine++
+		}
+		if e.Op != Equal {
+			changes = append(changes, i)
+		}
+	}
+
+	var hunks []Hunk
+	for len(changes) > 0 {
+		last := 0
+		for last+1 < len(changes) && changes[last+1]-changes[last] <= 2*context+1 {
+			last++
+		}
+
+		start := changes[0] - context
+		if start < 0 {
+			start = 0
+		}
+		end := changes[last] + context + 1
+		if end > len(edits) {
+			end = len(edits)
+		}
+
+		h := Hunk{OldStart: oldLines[start], NewStart: newLines[start]}
+		for _, e := range edits[start:end] {
+			h.add(e)
+		}
+		hunks = append(hunks, h)
+		changes = changes[last+1:]
+	}
+	return hunks
+}
+
+func (h *Hunk) add(e Edit) {
+	switch e.Op {
+	case Equal:
+		h.Lines = append(h.Lines, " "+e.Line)
+		h.OldLines++
+		h.NewLines++
+	case Delete:
+		h.Lines = append(h.Lines, "-"+e.Line)
+		h.OldLines++
+	case Insert:
+		h.Lines = append(h.Lines, "+"+e.Line)
+		h.NewLines++
+	}
+}
+
+// Unified returns a unified diff between two versions of a file, or "" if
+// they are equal
+func Unified(oldName, newName, oldText, newText string, context int) string {
+	hunks := Hunks(Lines(SplitLines(oldText), SplitLines(newText)), context)
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks {
+		b.WriteString(h.Header() + "\n")
+		for _, line := range h.Lines {
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
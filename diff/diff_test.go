@@ -0,0 +1,74 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	old := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	new := "one\ntwo\n3\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\n"
+
+	got := Unified("a/n.txt", "b/n.txt", old, new, 1)
+	want := `--- a/n.txt
++++ b/n.txt
+@@ -2,3 +2,3 @@
+ two
+-three
++3
+ four
+@@ -10 +10,2 @@
+ ten
++eleven
+`
+	if got != want {
+		t.Errorf("Unified =\n%s\nwant\n%s", got, want)
+	}
+
+	if d := Unified("a", "b", old, old, 3); d != "" {
+		t.Errorf("expected no diff for equal texts, got\n%s", d)
+	}
+}
+
+func TestUnifiedNewFile(t *testing.T) {
+	got := Unified("/dev/null", "b/new.txt", "", "hello\nworld\n", 3)
+	want := "--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1,2 @@\n+hello\n+world\n"
+	if got != want {
+		t.Errorf("Unified =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLinesIsMinimal(t *testing.T) {
+	a := SplitLines("a\nb\nc\na\nb\nb\na\n")
+	b := SplitLines("c\nb\na\nb\na\nc\n")
+
+	edits := Lines(a, b)
+	added, removed := Stat(edits)
+	if added+removed != 5 {
+		t.Errorf("edit distance = %d, want 5", added+removed)
+	}
+
+	// Applying the script must give back b
+	var result []string
+	for _, e := range edits {
+		if e.Op != Delete {
+			result = append(result, e.Line)
+		}
+	}
+	if strings.Join(result, "\n") != strings.Join(b, "\n") {
+		t.Errorf("edit script produces %q, want %q", result, b)
+	}
+}
+
+func TestLinesLargeRewrite(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 3000; i++ {
+		a = append(a, fmt.Sprintf("old %d", i))
+		b = append(b, fmt.Sprintf("new %d", i))
+	}
+	added, removed := Stat(Lines(a, b))
+	if added != 3000 || removed != 3000 {
+		t.Errorf("Stat = +%d -%d, want +3000 -3000", added, removed)
+	}
+}
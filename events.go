@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gotha/bitca/backend"
+)
+
+// Output formats of headless mode
+const (
+	outputText       = "text"        // final answer only
+	outputJSON       = "json"        // a single result (or error) event
+	outputStreamJSON = "stream-json" // every event as NDJSON
+)
+
+// outputFormats lists the values accepted by -output-format
+var outputFormats = []string{outputText, outputJSON, outputStreamJSON}
+
+// Agent event types. They mirror what the UI receives as streamChunkMsg,
+// streamDoneMsg and toolExecutionMsg.
+const (
+	eventUser       = "user"        // the prompt
+	eventTextDelta  = "text_delta"  // streamed assistant text
+	eventAssistant  = "assistant"   // a complete assistant message
+	eventToolCall   = "tool_call"   // a tool call with its arguments
+	eventToolResult = "tool_result" // the result of a tool call
+	eventUsage      = "usage"       // token usage of one request
+	eventResult     = "result"      // the final answer
+	eventError      = "error"       // the run failed
+)
+
+// agentEvent is one line of -output-format stream-json. Only the fields
+// relevant to the type are set.
+type agentEvent struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+
+	Content   string             `json:"content,omitempty"`
+	Text      string             `json:"text,omitempty"`
+	ToolCalls []backend.ToolCall `json:"tool_calls,omitempty"`
+
+	// tool_call and tool_result
+	ID         string                 `json:"id,omitempty"`
+	Name       string                 `json:"name,omitempty"`
+	Arguments  map[string]interface{} `json:"arguments,omitempty"`
+	Status     string                 `json:"status,omitempty"`
+	DurationMS int64                  `json:"duration_ms,omitempty"`
+
+	// usage and result
+	Usage *eventUsageCounts `json:"usage,omitempty"`
+
+	// result and error
+	Result    string `json:"result,omitempty"`
+	Error     string `json:"error,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	Rounds    int    `json:"rounds,omitempty"`
+	ExitCode  int    `json:"exit_code,omitempty"`
+}
+
+// eventUsageCounts reports tokens of the request and of the whole run
+type eventUsageCounts struct {
+	PromptTokens          int `json:"prompt_tokens"`
+	CompletionTokens      int `json:"completion_tokens"`
+	TotalPromptTokens     int `json:"total_prompt_tokens"`
+	TotalCompletionTokens int `json:"total_completion_tokens"`
+}
+
+// eventWriter renders agent events in the chosen output format
+type eventWriter struct {
+	format   string
+	out      io.Writer // stdout: the answer or JSON events
+	progress io.Writer // stderr: human-readable progress in text mode
+	enc      *json.Encoder
+}
+
+func newEventWriter(format string, out, progress io.Writer) *eventWriter {
+	return &eventWriter{format: format, out: out, progress: progress, enc: json.NewEncoder(out)}
+}
+
+// emit writes an event; it is safe to call for every event in every format
+func (w *eventWriter) emit(ev agentEvent) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	switch w.format {
+	case outputStreamJSON:
+		w.enc.Encode(ev)
+
+	case outputJSON:
+		if ev.Type == eventResult || ev.Type == eventError {
+			w.enc.Encode(ev)
+		}
+
+	default:
+		switch ev.Type {
+		case eventToolCall:
+			fmt.Fprintf(w.progress, "[tool] %s %s\n", ev.Name, toolSubject(ev.Name, ev.Arguments))
+		case eventToolResult:
+			if ev.Status == toolDenied || ev.Status == toolFailed {
+				fmt.Fprintf(w.progress, "[tool] %s %s: %s\n", ev.Name, ev.Status, firstLine(ev.Content))
+			}
+		case eventResult:
+			fmt.Fprintln(w.out, ev.Result)
+		case eventError:
+			fmt.Fprintf(w.progress, "Error: %s\n", ev.Error)
+		}
+	}
+}
+
+// firstLine returns the first line of s
+func firstLine(s string) string {
+	for i, r := range s {
+		if r == '\n' {
+			return s[:i]
+		}
+	}
+	return s
+}
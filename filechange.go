@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gotha/bitca/checkpoint"
+	"github.com/gotha/bitca/diff"
+)
+
+// toolCheckpoints records files before write and edit change them; nil
+// when changes can't be undone (headless mode)
+var toolCheckpoints *checkpoint.Store
+
+// summaryDiffLines caps the diff returned to the model by write and edit;
+// it needs to see what changed, not the whole file again
+const summaryDiffLines = 40
+
+// fileChange is a change the write or edit tool is about to make
+type fileChange struct {
+	path    string // resolved absolute path
+	old     string // current content, "" for a new file
+	new     string
+	created bool
+	deleted bool
+}
+
+// editProblem is an edit the model got wrong, reported back to it as the
+// tool result rather than as a failure
+type editProblem string
+
+func (p editProblem) Error() string {
+	return string(p)
+}
+
+// planWrite works out the change a write call makes without making it
+func planWrite(args map[string]interface{}) (fileChange, error) {
+	path, ok := args["path"].(string)
+	if !ok {
+		return fileChange{}, fmt.Errorf("path must be a string")
+	}
+
+	content, ok := args["content"].(string)
+	if !ok {
+		return fileChange{}, fmt.Errorf("content must be a string")
+	}
+
+	path, err := resolvePath(path)
+	if err != nil {
+		return fileChange{}, err
+	}
+
+	change := fileChange{path: path, new: content}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		change.old = string(data)
+	case os.IsNotExist(err):
+		change.created = true
+	default:
+		return fileChange{}, err
+	}
+	return change, nil
+}
+
+// planEdit works out the change an edit call makes without making it
+func planEdit(args map[string]interface{}) (fileChange, error) {
+	path, ok := args["path"].(string)
+	if !ok {
+		return fileChange{}, fmt.Errorf("path must be a string")
+	}
+
+	old, ok := args["old"].(string)
+	if !ok {
+		return fileChange{}, fmt.Errorf("old must be a string")
+	}
+
+	new, ok := args["new"].(string)
+	if !ok {
+		return fileChange{}, fmt.Errorf("new must be a string")
+	}
+
+	path, err := resolvePath(path)
+	if err != nil {
+		return fileChange{}, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fileChange{}, err
+	}
+
+	text := string(data)
+	if !strings.Contains(text, old) {
+		return fileChange{}, editProblem("old_string not found")
+	}
+
+	count := strings.Count(text, old)
+	all, _ := args["all"].(bool)
+
+	if !all && count > 1 {
+		return fileChange{}, editProblem(fmt.Sprintf("old_string appears %d times, must be unique (use all=true)", count))
+	}
+
+	var replacement string
+	if all {
+		replacement = strings.ReplaceAll(text, old, new)
+	} else {
+		replacement = strings.Replace(text, old, new, 1)
+	}
+
+	return fileChange{path: path, old: text, new: replacement}, nil
+}
+
+// apply writes the new content, creating parent directories as needed, or
+// removes the file for a deletion.
+// The file's current state is saved first so the change can be undone.
+func (c fileChange) apply() error {
+	if toolCheckpoints != nil {
+		if err := toolCheckpoints.Snapshot(c.path); err != nil {
+			return fmt.Errorf("failed to save %s for undo: %w", displayPath(c.path), err)
+		}
+	}
+	if c.deleted {
+		return os.Remove(c.path)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directories: %w", err)
+	}
+	return os.WriteFile(c.path, []byte(c.new), 0o644)
+}
+
+// diff returns the change as a unified diff with the given context lines
+func (c fileChange) diff(context int) string {
+	name := displayPath(c.path)
+	oldName, newName := "a/"+name, "b/"+name
+	if c.created {
+		oldName = "/dev/null"
+	}
+	if c.deleted {
+		newName = "/dev/null"
+	}
+	return diff.Unified(oldName, newName, c.old, c.new, context)
+}
+
+// summary describes the change for the model: the line counts and a
+// compact diff
+func (c fileChange) summary() string {
+	name := displayPath(c.path)
+	edits := diff.Lines(diff.SplitLines(c.old), diff.SplitLines(c.new))
+	added, removed := diff.Stat(edits)
+
+	if c.created {
+		return fmt.Sprintf("Created %s (%d lines)", name, added)
+	}
+	if c.deleted {
+		return fmt.Sprintf("Deleted %s (%d lines)", name, removed)
+	}
+	if c.old == c.new {
+		return fmt.Sprintf("No changes to %s", name)
+	}
+	// Changes the line diff doesn't show
+	if strings.ReplaceAll(c.old, "\r\n", "\n") == strings.ReplaceAll(c.new, "\r\n", "\n") {
+		return fmt.Sprintf("Updated %s (%s)", name, lineEndingChange(c.new))
+	}
+	if added == 0 && removed == 0 {
+		if strings.HasSuffix(c.new, "\n") {
+			return fmt.Sprintf("Updated %s (added the newline at the end of the file)", name)
+		}
+		return fmt.Sprintf("Updated %s (removed the newline at the end of the file)", name)
+	}
+
+	header := fmt.Sprintf("Updated %s (+%d -%d)", name, added, removed)
+	lines := strings.Split(strings.TrimRight(c.diff(1), "\n"), "\n")
+	lines = lines[2:] // The ---/+++ header repeats the name
+	if len(lines) > summaryDiffLines {
+		more := len(lines) - summaryDiffLines
+		lines = append(lines[:summaryDiffLines], fmt.Sprintf("... (%d more diff lines)", more))
+	}
+	return header + "\n" + strings.Join(lines, "\n")
+}
+
+// lineEndingChange describes a change that only changes line endings, by
+// the new content
+func lineEndingChange(new string) string {
+	switch {
+	case !strings.Contains(new, "\r\n"):
+		return "changed the line endings from CRLF to LF"
+	case strings.Count(new, "\r\n") == strings.Count(new, "\n"):
+		return "changed the line endings from LF to CRLF"
+	}
+	return "changed only line endings"
+}
+
+// displayPath shortens a path to be relative to the workspace (or the
+// current directory) when it is inside it
+func displayPath(path string) string {
+	base := ""
+	if toolWorkspace != nil {
+		base = toolWorkspace.Root()
+	} else if cwd, err := os.Getwd(); err == nil {
+		base = cwd
+	}
+	if base != "" {
+		if rel, err := filepath.Rel(base, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return path
+}
+
+// previewChange returns the diff a write, edit or apply_patch call would
+// make, or "" for other tools and calls that would fail
+func previewChange(name string, args map[string]interface{}) string {
+	var change fileChange
+	var err error
+	switch name {
+	case "write":
+		change, err = planWrite(args)
+	case "edit":
+		change, err = planEdit(args)
+	case "apply_patch":
+		plan, err := planPatch(args)
+		if err != nil {
+			return ""
+		}
+		var diffs strings.Builder
+		for _, f := range plan {
+			for _, c := range f.changes {
+				diffs.WriteString(c.diff(3))
+			}
+		}
+		return diffs.String()
+	default:
+		return ""
+	}
+	if err != nil {
+		return ""
+	}
+	return change.diff(3)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gotha/bitca/workspace"
+)
+
+func TestEditReturnsDiff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(path, []byte("package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	args := map[string]interface{}{"path": path, "old": `println("hi")`, "new": `println("hello")`}
+	preview := previewChange("edit", args)
+	if !strings.Contains(preview, "-\tprintln(\"hi\")\n+\tprintln(\"hello\")") {
+		t.Errorf("preview is missing the change:\n%s", preview)
+	}
+
+	result, err := toolEdit(args)
+	if err != nil {
+		t.Fatalf("toolEdit: %v", err)
+	}
+	if !strings.HasPrefix(result, "Updated ") || !strings.Contains(result, "(+1 -1)") {
+		t.Errorf("result = %q, want a summary with line counts", result)
+	}
+	if strings.Contains(result, "package main") {
+		t.Errorf("result should only have one line of context:\n%s", result)
+	}
+
+	if result, _ := toolEdit(args); result != "error: old_string not found" {
+		t.Errorf("second edit = %q, want the not found error", result)
+	}
+}
+
+func TestWriteSummaries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+
+	result, err := toolWrite(map[string]interface{}{"path": path, "content": "a\nb\n"})
+	if err != nil {
+		t.Fatalf("toolWrite: %v", err)
+	}
+	if !strings.HasPrefix(result, "Created ") || !strings.Contains(result, "(2 lines)") {
+		t.Errorf("result = %q, want a created summary", result)
+	}
+
+	result, err = toolWrite(map[string]interface{}{"path": path, "content": "a\nb\n"})
+	if err != nil {
+		t.Fatalf("toolWrite: %v", err)
+	}
+	if !strings.HasPrefix(result, "No changes") {
+		t.Errorf("result = %q, want no changes", result)
+	}
+
+	for _, tt := range []struct{ content, want string }{
+		{"a\nb", "(removed the newline at the end of the file)"},
+		{"a\nb\n", "(added the newline at the end of the file)"},
+		{"a\r\nb\r\n", "(changed the line endings from LF to CRLF)"},
+		{"a\nb\n", "(changed the line endings from CRLF to LF)"},
+	} {
+		result, err := toolWrite(map[string]interface{}{"path": path, "content": tt.content})
+		if err != nil {
+			t.Fatalf("toolWrite: %v", err)
+		}
+		if !strings.HasPrefix(result, "Updated ") || !strings.HasSuffix(result, tt.want) {
+			t.Errorf("writing %q: result = %q, want %s", tt.content, result, tt.want)
+		}
+	}
+
+	preview := previewChange("write", map[string]interface{}{"path": path, "content": "a\nc\n"})
+	if !strings.Contains(preview, "-b\n+c\n") {
+		t.Errorf("preview = %q, want the changed line", preview)
+	}
+}
+
+func TestWritePathsResolveLikeRead(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	ws, err := workspace.New(home, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := toolWorkspace
+	toolWorkspace = ws
+	t.Cleanup(func() { toolWorkspace = saved })
+
+	want := filepath.Join(ws.Root(), "notes.txt")
+	change, err := planWrite(map[string]interface{}{"path": "~/notes.txt", "content": "x"})
+	if err != nil || change.path != want {
+		t.Errorf("write resolved ~/notes.txt to %q, %v; want %q", change.path, err, want)
+	}
+	if got, err := resolvePath("notes.txt"); err != nil || got != want {
+		t.Errorf("relative path resolved to %q, %v; want %q", got, err, want)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gotha/bitca/glob"
+	"github.com/gotha/bitca/ignore"
+)
+
+// globDefaultLimit is how many paths glob returns unless the call asks for
+// another limit
+const globDefaultLimit = 200
+
+// globPattern is one brace alternative of a glob call, relative to the
+// directory its walk starts in
+type globPattern struct {
+	*glob.Pattern
+	dirOnly bool // the pattern ended with a slash
+}
+
+// globMatch is a matching path with the modification time it is sorted by,
+// read once while walking
+type globMatch struct {
+	path    string
+	modTime time.Time
+}
+
+func toolGlob(ctx context.Context, args map[string]interface{}) (string, error) {
+	pat, ok := args["pat"].(string)
+	if !ok {
+		return "", fmt.Errorf("pat must be a string")
+	}
+
+	basePath := "."
+	if p, ok := args["path"].(string); ok && p != "" {
+		basePath = p
+	}
+
+	limit := globDefaultLimit
+	if n, ok := args["limit"].(float64); ok && n > 0 {
+		limit = int(n)
+	}
+
+	if _, err := resolvePath(basePath); err != nil {
+		return "", err
+	}
+
+	// Each brace alternative is walked from the deepest directory without
+	// glob syntax; alternatives starting in the same directory share a walk
+	roots := make(map[string][]globPattern)
+	var order []string
+	for _, alt := range glob.Expand(pat) {
+		full := alt
+		if !filepath.IsAbs(alt) {
+			full = filepath.Join(basePath, alt)
+		}
+		dir, rest := glob.Split(filepath.ToSlash(full))
+		if dir == "" {
+			dir = "."
+		}
+		pattern, err := glob.Compile(rest)
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.FromSlash(dir)
+		if _, ok := roots[dir]; !ok {
+			order = append(order, dir)
+		}
+		roots[dir] = append(roots[dir], globPattern{pattern, strings.HasSuffix(alt, "/")})
+	}
+
+	seen := make(map[string]bool)
+	var matches []globMatch
+	for _, root := range order {
+		// The pattern itself may lead out of the workspace (../*)
+		if _, err := resolvePath(root); err != nil {
+			continue
+		}
+		found, err := globWalk(ctx, root, roots[root])
+		if err != nil {
+			return "", err
+		}
+		for _, m := range found {
+			if !seen[m.path] {
+				seen[m.path] = true
+				matches = append(matches, m)
+			}
+		}
+	}
+
+	if len(matches) == 0 {
+		return "none", nil
+	}
+
+	// Newest first
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].modTime.After(matches[j].modTime)
+	})
+
+	paths := make([]string, 0, min(len(matches), limit)+1)
+	for _, m := range matches[:min(len(matches), limit)] {
+		paths = append(paths, m.path)
+	}
+	if more := len(matches) - limit; more > 0 {
+		paths = append(paths, fmt.Sprintf("... (%d more matches; narrow the pattern or raise limit)", more))
+	}
+	return strings.Join(paths, "\n"), nil
+}
+
+// globWalk finds the paths below root matching any of patterns, skipping
+// ignored files and directories no pattern can match in. Directories are
+// returned with a trailing slash.
+func globWalk(ctx context.Context, root string, patterns []globPattern) ([]globMatch, error) {
+	var matches []globMatch
+	err := ignore.Walk(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		matched, below := false, false
+		for _, p := range patterns {
+			matched = matched || (p.Match(rel) && (d.IsDir() || !p.dirOnly))
+			below = below || (d.IsDir() && p.MayMatchBelow(rel))
+		}
+
+		if matched {
+			// Don't follow symlinks out of the workspace
+			ok := true
+			if d.Type()&os.ModeSymlink != 0 {
+				_, err := resolvePath(path)
+				ok = err == nil
+			}
+			if info, err := d.Info(); ok && err == nil {
+				name := path
+				if d.IsDir() {
+					name += string(filepath.Separator)
+				}
+				matches = append(matches, globMatch{path: name, modTime: info.ModTime()})
+			}
+		}
+
+		if d.IsDir() && !below {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return matches, err
+}
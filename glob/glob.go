@@ -0,0 +1,232 @@
+// Package glob matches slash-separated paths against shell patterns that
+// support ** for any number of directories and {a,b} alternatives.
+package glob
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Pattern is a compiled glob
+type Pattern struct {
+	alternatives []alternative
+}
+
+// alternative is one brace expansion of a pattern
+type alternative struct {
+	full     *regexp.Regexp
+	segments []*regexp.Regexp // nil for a ** segment
+}
+
+// Compile compiles a glob. * and ? don't match /, [...] matches a class
+// ([!...] negated), ** as a whole path segment matches any number of
+// directories and {a,b} matches either alternative.
+func Compile(pattern string) (*Pattern, error) {
+	p := &Pattern{}
+	for _, expanded := range Expand(pattern) {
+		var alt alternative
+		var full strings.Builder
+		full.WriteString("^")
+
+		segments := strings.Split(expanded, "/")
+		for i, seg := range segments {
+			last := i == len(segments)-1
+			if seg == "**" {
+				alt.segments = append(alt.segments, nil)
+				if last {
+					full.WriteString(".*")
+				} else {
+					full.WriteString("(?:.*/)?")
+				}
+				continue
+			}
+
+			expr, err := segmentRegexp(seg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+			re, err := regexp.Compile("^" + expr + "$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+			alt.segments = append(alt.segments, re)
+			full.WriteString(expr)
+			if !last {
+				full.WriteString("/")
+			}
+		}
+
+		full.WriteString("$")
+		re, err := regexp.Compile(full.String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		alt.full = re
+		p.alternatives = append(p.alternatives, alt)
+	}
+	return p, nil
+}
+
+// segmentRegexp converts one path segment of a glob to a regular expression
+func segmentRegexp(seg string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(seg); i++ {
+		c := seg[i]
+		switch c {
+		case '*':
+			b.WriteString("[^/]*")
+			for i+1 < len(seg) && seg[i+1] == '*' {
+				i++
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(seg[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated [")
+			}
+			class := seg[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(seg) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(string(seg[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String(), nil
+}
+
+// Match reports whether a slash-separated path matches the pattern
+func (p *Pattern) Match(path string) bool {
+	for _, alt := range p.alternatives {
+		if alt.full.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// MayMatchBelow reports whether paths below the directory dir could match
+// the pattern, so a walk can skip directories that can't
+func (p *Pattern) MayMatchBelow(dir string) bool {
+	var parts []string
+	if dir != "" && dir != "." {
+		parts = strings.Split(dir, "/")
+	}
+
+	for _, alt := range p.alternatives {
+		if alt.mayMatchBelow(parts) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a alternative) mayMatchBelow(parts []string) bool {
+	for i, part := range parts {
+		if i >= len(a.segments) {
+			return false
+		}
+		if a.segments[i] == nil {
+			return true
+		}
+		if !a.segments[i].MatchString(part) {
+			return false
+		}
+	}
+	return len(a.segments) > len(parts)
+}
+
+// Match reports whether path matches pattern. An invalid pattern matches
+// nothing.
+func Match(pattern, path string) bool {
+	p, err := Compile(pattern)
+	return err == nil && p.Match(path)
+}
+
+// HasMeta reports whether s contains glob syntax
+func HasMeta(s string) bool {
+	return strings.ContainsAny(s, `*?[{\`)
+}
+
+// Split splits a pattern into the leading directories without glob syntax
+// and the rest, so a walk can start as deep as possible:
+// "src/app/**/*.go" gives "src/app" and "**/*.go".
+func Split(pattern string) (dir, rest string) {
+	segments := strings.Split(pattern, "/")
+	n := 0
+	for n < len(segments)-1 && !HasMeta(segments[n]) {
+		n++
+	}
+	dir = strings.Join(segments[:n], "/")
+	if dir == "" && strings.HasPrefix(pattern, "/") {
+		dir = "/"
+	}
+	return dir, strings.Join(segments[n:], "/")
+}
+
+// Expand expands braces: "*.{go,md}" gives "*.go" and "*.md". Braces nest,
+// and a brace without a comma is kept as is.
+func Expand(pattern string) []string {
+	start, end, parts := findBraces(pattern)
+	if start < 0 {
+		return []string{pattern}
+	}
+
+	var result []string
+	prefix, suffix := pattern[:start], pattern[end+1:]
+	for _, part := range parts {
+		result = append(result, Expand(prefix+part+suffix)...)
+	}
+	return result
+}
+
+// findBraces finds the first brace group with a comma and returns its
+// position and alternatives
+func findBraces(pattern string) (int, int, []string) {
+	for start := 0; start < len(pattern); start++ {
+		switch pattern[start] {
+		case '\\':
+			start++
+			continue
+		case '{':
+		default:
+			continue
+		}
+
+		depth := 0
+		var parts []string
+		last := start + 1
+	scan:
+		for i := start; i < len(pattern); i++ {
+			switch pattern[i] {
+			case '\\':
+				i++
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					if parts != nil {
+						return start, i, append(parts, pattern[last:i])
+					}
+					break scan // No comma; look for a later group
+				}
+			case ',':
+				if depth == 1 {
+					parts = append(parts, pattern[last:i])
+					last = i + 1
+				}
+			}
+		}
+	}
+	return -1, -1, nil
+}
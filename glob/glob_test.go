@@ -0,0 +1,100 @@
+package glob
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "a/b/c/main.go", true},
+		{"**/*.go", "main.go.txt", false},
+		{"src/**/test_*.py", "src/test_a.py", true},
+		{"src/**/test_*.py", "src/x/y/test_a.py", true},
+		{"src/**/test_*.py", "lib/test_a.py", false},
+		{"src/**", "src/a/b", true},
+		{"*.{go,mod}", "go.mod", true},
+		{"*.{go,mod}", "go.sum", false},
+		{"{cmd,internal}/**/*.go", "internal/x/y.go", true},
+		{"a{b,c{d,e}}f", "acef", true},
+		{"file?.txt", "file1.txt", true},
+		{"file?.txt", "file10.txt", false},
+		{"[a-c]*.md", "b.md", true},
+		{"[!a-c]*.md", "b.md", false},
+		{`\*.txt`, "*.txt", true},
+		{`\*.txt`, "a.txt", false},
+		{"{single}.txt", "{single}.txt", true},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMayMatchBelow(t *testing.T) {
+	tests := []struct {
+		pattern string
+		dir     string
+		want    bool
+	}{
+		{"*.go", "cmd", false},
+		{"*/*.go", "cmd", true},
+		{"*/*.go", "cmd/sub", false},
+		{"**/*.go", "a/b/c", true},
+		{"src/**/*.go", "lib", false},
+		{"src/**/*.go", "src/x", true},
+		{"{src,lib}/*.go", "lib", true},
+		{"{src,lib}/*.go", "docs", false},
+	}
+	for _, tt := range tests {
+		p, err := Compile(tt.pattern)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.pattern, err)
+		}
+		if got := p.MayMatchBelow(tt.dir); got != tt.want {
+			t.Errorf("MayMatchBelow(%q, %q) = %v, want %v", tt.pattern, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	got := Expand("src/{a,b{1,2}}/*.{js,ts}")
+	want := []string{
+		"src/a/*.js", "src/a/*.ts",
+		"src/b1/*.js", "src/b1/*.ts",
+		"src/b2/*.js", "src/b2/*.ts",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expand = %v, want %v", got, want)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		pattern, dir, rest string
+	}{
+		{"src/app/**/*.go", "src/app", "**/*.go"},
+		{"**/*.go", "", "**/*.go"},
+		{"main.go", "", "main.go"},
+		{"/etc/*.conf", "/etc", "*.conf"},
+		{"docs/readme.md", "docs", "readme.md"},
+	}
+	for _, tt := range tests {
+		dir, rest := Split(tt.pattern)
+		if dir != tt.dir || rest != tt.rest {
+			t.Errorf("Split(%q) = %q, %q; want %q, %q", tt.pattern, dir, rest, tt.dir, tt.rest)
+		}
+	}
+
+	if _, err := Compile("[abc"); err == nil {
+		t.Error("expected an error for an unterminated class")
+	}
+}
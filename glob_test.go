@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGlob(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		".gitignore",
+		"main.go",
+		"go.mod",
+		"cmd/tool/main.go",
+		"internal/a/a.go",
+		"internal/a/a_test.go",
+		"dist/bundle.go",
+		"README.md",
+	}
+	now := time.Now()
+	for i, name := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		content := ""
+		if name == ".gitignore" {
+			content = "dist/\n"
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// Later files are newer
+		mtime := now.Add(time.Duration(i-len(files)) * time.Minute)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want []string
+	}{
+		{
+			name: "doublestar",
+			args: map[string]interface{}{"pat": "**/*.go"},
+			want: []string{path("internal/a/a_test.go"), path("internal/a/a.go"), path("cmd/tool/main.go"), path("main.go")},
+		},
+		{
+			name: "braces",
+			args: map[string]interface{}{"pat": "*.{mod,md}"},
+			want: []string{path("README.md"), path("go.mod")},
+		},
+		{
+			name: "static prefix",
+			args: map[string]interface{}{"pat": "internal/**/*_test.go"},
+			want: []string{path("internal/a/a_test.go")},
+		},
+		{
+			name: "directories",
+			args: map[string]interface{}{"pat": "*/"},
+			want: []string{path("internal") + "/", path("cmd") + "/"},
+		},
+		{
+			name: "directory matches",
+			args: map[string]interface{}{"pat": "{cmd,internal}/*"},
+			want: []string{path("internal/a") + "/", path("cmd/tool") + "/"},
+		},
+		{
+			name: "limit",
+			args: map[string]interface{}{"pat": "**/*.go", "limit": 1.0},
+			want: []string{path("internal/a/a_test.go"), "... (3 more matches; narrow the pattern or raise limit)"},
+		},
+		{
+			name: "ignored files are skipped unless asked for",
+			args: map[string]interface{}{"pat": "dist/*.go"},
+			want: []string{path("dist/bundle.go")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.args["path"] = dir
+			got, err := toolGlob(context.Background(), tt.args)
+			if err != nil {
+				t.Fatalf("toolGlob: %v", err)
+			}
+			if want := strings.Join(tt.want, "\n"); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/gotha/bitca/glob"
+	"github.com/gotha/bitca/ignore"
+)
+
+const (
+	// grepDefaultLimit is how many matching lines (or files) grep returns
+	// unless the call asks for another limit
+	grepDefaultLimit = 100
+
+	// grepMaxFileSize skips files too large to be source code
+	grepMaxFileSize = 10 << 20
+
+	// grepMaxLineLength is the longest line grep shows in full
+	grepMaxLineLength = 300
+
+	// binarySniffLength is how much of a file is checked for NUL bytes
+	binarySniffLength = 8000
+)
+
+// grepOptions are the arguments of a grep call
+type grepOptions struct {
+	pattern *regexp.Regexp
+	base    string
+	include []fileFilter
+	exclude []fileFilter
+	before  int
+	after   int
+	output  string // "content", "files" or "count"
+	limit   int
+}
+
+// grepFile is a file with matches
+type grepFile struct {
+	path    string
+	lines   []string // set in content mode
+	matches []int    // 0-based indices of matching lines
+	shown   int      // content mode: how many of matches are printed
+}
+
+func parseGrepOptions(args map[string]interface{}) (grepOptions, error) {
+	pat, ok := args["pat"].(string)
+	if !ok {
+		return grepOptions{}, fmt.Errorf("pat must be a string")
+	}
+	if ignoreCase, _ := args["ignore_case"].(bool); ignoreCase {
+		pat = "(?i)" + pat
+	}
+	pattern, err := regexp.Compile(pat)
+	if err != nil {
+		return grepOptions{}, err
+	}
+
+	opts := grepOptions{pattern: pattern, base: ".", output: "content", limit: grepDefaultLimit}
+	if p, ok := args["path"].(string); ok && p != "" {
+		opts.base = p
+	}
+	if s, ok := args["include"].(string); ok {
+		if opts.include, err = parseFileFilters(s); err != nil {
+			return grepOptions{}, err
+		}
+	}
+	if s, ok := args["exclude"].(string); ok {
+		if opts.exclude, err = parseFileFilters(s); err != nil {
+			return grepOptions{}, err
+		}
+	}
+	if n, ok := args["context"].(float64); ok {
+		opts.before, opts.after = int(n), int(n)
+	}
+	if n, ok := args["before"].(float64); ok {
+		opts.before = int(n)
+	}
+	if n, ok := args["after"].(float64); ok {
+		opts.after = int(n)
+	}
+	if n, ok := args["limit"].(float64); ok && n > 0 {
+		opts.limit = int(n)
+	}
+	if s, ok := args["output"].(string); ok && s != "" {
+		if s != "content" && s != "files" && s != "count" {
+			return grepOptions{}, fmt.Errorf("output must be content, files or count")
+		}
+		opts.output = s
+	}
+	opts.before = max(opts.before, 0)
+	opts.after = max(opts.after, 0)
+	return opts, nil
+}
+
+// fileFilter is an include or exclude glob. Globs with a slash are matched
+// against the path below the search base, others against the file name.
+type fileFilter struct {
+	pattern *glob.Pattern
+	path    bool
+}
+
+// parseFileFilters parses a comma-separated list of globs; commas inside
+// braces belong to the glob
+func parseFileFilters(s string) ([]fileFilter, error) {
+	var filters []fileFilter
+	depth, start := 0, 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) {
+			switch s[i] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+			}
+			if s[i] != ',' || depth > 0 {
+				continue
+			}
+		}
+
+		p := strings.TrimSpace(s[start:i])
+		start = i + 1
+		if p == "" {
+			continue
+		}
+		pattern, err := glob.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, fileFilter{pattern: pattern, path: strings.Contains(p, "/")})
+	}
+	return filters, nil
+}
+
+// matchesAny reports whether the file at rel, below the search base,
+// matches one of the filters
+func matchesAny(filters []fileFilter, rel string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, f := range filters {
+		subject := path.Base(rel)
+		if f.path {
+			subject = rel
+		}
+		if f.pattern.Match(subject) {
+			return true
+		}
+	}
+	return false
+}
+
+func toolGrep(ctx context.Context, args map[string]interface{}) (string, error) {
+	opts, err := parseGrepOptions(args)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := resolvePath(opts.base); err != nil {
+		return "", err
+	}
+
+	files, truncated, err := grepFiles(ctx, opts)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "none", nil
+	}
+
+	var out []string
+	switch opts.output {
+	case "files":
+		for _, f := range files {
+			out = append(out, f.path)
+		}
+	case "count":
+		for _, f := range files {
+			out = append(out, fmt.Sprintf("%s:%d", f.path, len(f.matches)))
+		}
+	default:
+		out = formatGrepContent(files, opts)
+	}
+
+	if truncated {
+		out = append(out, fmt.Sprintf("... (stopped at %d results; narrow the search or raise limit)", opts.limit))
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+// grepFiles searches the files below opts.base in parallel. Results are in
+// walk order, cut to the limit; truncated reports whether there were more.
+func grepFiles(ctx context.Context, opts grepOptions) ([]grepFile, bool, error) {
+	type job struct {
+		index int
+		path  string
+	}
+	jobs := make(chan job)
+
+	var (
+		mu      sync.Mutex
+		found   = make(map[int]grepFile)
+		results atomic.Int64 // matching lines, or files outside content mode
+		wg      sync.WaitGroup
+	)
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				f, ok := grepFileAt(j.path, opts)
+				if !ok {
+					continue
+				}
+				if opts.output == "content" {
+					results.Add(int64(len(f.matches)))
+				} else {
+					results.Add(1)
+				}
+				mu.Lock()
+				found[j.index] = f
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// Files are handed out in walk order and the walk stops once the files
+	// searched so far have enough results, so the result is the same as a
+	// search file by file
+	count := 0
+	walkErr := ignore.Walk(opts.base, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if results.Load() > int64(opts.limit) {
+			return filepath.SkipAll
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(opts.base, path)
+		if len(opts.include) > 0 && !matchesAny(opts.include, rel) {
+			return nil
+		}
+		if matchesAny(opts.exclude, rel) {
+			return nil
+		}
+
+		// Don't follow symlinks out of the workspace
+		if d.Type()&os.ModeSymlink != 0 {
+			if _, err := resolvePath(path); err != nil {
+				return nil
+			}
+		}
+
+		jobs <- job{count, path}
+		count++
+		return nil
+	})
+	close(jobs)
+	wg.Wait()
+
+	if walkErr != nil && walkErr != filepath.SkipAll {
+		return nil, false, walkErr
+	}
+
+	var files []grepFile
+	remaining := opts.limit
+	truncated := false
+	for i := range count {
+		f, ok := found[i]
+		if !ok {
+			continue
+		}
+		if remaining == 0 {
+			truncated = true
+			break
+		}
+		if opts.output == "content" {
+			// The rest still show as matches in the context of these
+			f.shown = min(len(f.matches), remaining)
+			if f.shown < len(f.matches) {
+				truncated = true
+			}
+			remaining -= f.shown
+		} else {
+			remaining--
+		}
+		files = append(files, f)
+	}
+	return files, truncated || results.Load() > int64(opts.limit), nil
+}
+
+// grepFileAt searches one file. Binary and very large files are skipped.
+func grepFileAt(path string, opts grepOptions) (grepFile, bool) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > grepMaxFileSize {
+		return grepFile{}, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || isBinary(data) {
+		return grepFile{}, false
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	f := grepFile{path: path}
+	for i, line := range lines {
+		if opts.pattern.MatchString(strings.TrimSuffix(line, "\r")) {
+			f.matches = append(f.matches, i)
+		}
+	}
+	if len(f.matches) == 0 {
+		return grepFile{}, false
+	}
+	if opts.output == "content" {
+		f.lines = lines
+	}
+	return f, true
+}
+
+// isBinary reports whether data looks like a binary file: it has a NUL
+// byte near the start
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), binarySniffLength)], 0) >= 0
+}
+
+// formatGrepContent formats matches like grep: "path:line:text" for
+// matching lines, "path-line-text" for context and "--" between groups
+// that aren't adjacent
+func formatGrepContent(files []grepFile, opts grepOptions) []string {
+	withContext := opts.before > 0 || opts.after > 0
+
+	var out []string
+	for _, f := range files {
+		isMatch := make(map[int]bool, len(f.matches))
+		for _, m := range f.matches {
+			isMatch[m] = true
+		}
+
+		last := -1 // last line printed
+		for _, m := range f.matches[:f.shown] {
+			start := max(m-opts.before, last+1)
+			end := min(m+opts.after, len(f.lines)-1)
+			if start > end {
+				continue // printed as context of an earlier match
+			}
+			// Groups from different files are never adjacent
+			if withContext && len(out) > 0 && (last < 0 || start != last+1) {
+				out = append(out, "--")
+			}
+			for i := start; i <= end; i++ {
+				sep := "-"
+				if isMatch[i] {
+					sep = ":"
+				}
+				out = append(out, fmt.Sprintf("%s%s%d%s%s", f.path, sep, i+1, sep, clipGrepLine(f.lines[i])))
+			}
+			last = end
+		}
+	}
+	return out
+}
+
+// clipGrepLine shortens minified code and other very long lines
+func clipGrepLine(line string) string {
+	line = strings.TrimSuffix(line, "\r")
+	if len(line) <= grepMaxLineLength {
+		return line
+	}
+	cut := grepMaxLineLength
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut] + " ..."
+}
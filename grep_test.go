@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGrep(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".gitignore":        "vendor/\n",
+		"main.go":           "package main\n\n// TODO: one\nfunc main() {}\n// todo: two\n",
+		"lib/util.go":       "package lib\n// TODO: three\n",
+		"lib/util_test.go":  "package lib\n// TODO: four\n",
+		"vendor/dep/dep.go": "// TODO: vendored\n",
+		"image.bin":         "TODO\x00\x01\x02",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	grep := func(args map[string]interface{}) string {
+		t.Helper()
+		args["path"] = dir
+		result, err := toolGrep(context.Background(), args)
+		if err != nil {
+			t.Fatalf("toolGrep(%v): %v", args, err)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want []string
+	}{
+		{
+			name: "skips ignored and binary files",
+			args: map[string]interface{}{"pat": "TODO"},
+			want: []string{
+				path("lib/util.go") + ":2:// TODO: three",
+				path("lib/util_test.go") + ":2:// TODO: four",
+				path("main.go") + ":3:// TODO: one",
+			},
+		},
+		{
+			name: "ignore case and include",
+			args: map[string]interface{}{"pat": "todo", "ignore_case": true, "include": "main.go"},
+			want: []string{path("main.go") + ":3:// TODO: one", path("main.go") + ":5:// todo: two"},
+		},
+		{
+			name: "include with braces and **",
+			args: map[string]interface{}{"pat": "TODO", "include": "lib/**/*_{test,bench}.go"},
+			want: []string{path("lib/util_test.go") + ":2:// TODO: four"},
+		},
+		{
+			name: "exclude",
+			args: map[string]interface{}{"pat": "TODO", "exclude": "*_test.go,main.go"},
+			want: []string{path("lib/util.go") + ":2:// TODO: three"},
+		},
+		{
+			name: "context",
+			args: map[string]interface{}{"pat": "TODO", "include": "*.go", "before": 1.0, "after": 1.0, "ignore_case": true, "exclude": "lib/*"},
+			want: []string{
+				path("main.go") + "-2-",
+				path("main.go") + ":3:// TODO: one",
+				path("main.go") + "-4-func main() {}",
+				path("main.go") + ":5:// todo: two",
+			},
+		},
+		{
+			name: "files",
+			args: map[string]interface{}{"pat": "TODO", "output": "files"},
+			want: []string{path("lib/util.go"), path("lib/util_test.go"), path("main.go")},
+		},
+		{
+			name: "count",
+			args: map[string]interface{}{"pat": "(?i)todo", "output": "count", "include": "main.go"},
+			want: []string{path("main.go") + ":2"},
+		},
+		{
+			name: "limit",
+			args: map[string]interface{}{"pat": "TODO", "limit": 1.0},
+			want: []string{
+				path("lib/util.go") + ":2:// TODO: three",
+				"... (stopped at 1 results; narrow the search or raise limit)",
+			},
+		},
+		{
+			name: "limit with context",
+			args: map[string]interface{}{"pat": "(?i)todo", "limit": 1.0, "after": 2.0, "include": "main.go"},
+			want: []string{
+				path("main.go") + ":3:// TODO: one",
+				path("main.go") + "-4-func main() {}",
+				path("main.go") + ":5:// todo: two",
+				"... (stopped at 1 results; narrow the search or raise limit)",
+			},
+		},
+		{
+			name: "separator between files",
+			args: map[string]interface{}{"pat": "TODO: (three|four)", "before": 1.0},
+			want: []string{
+				path("lib/util.go") + "-1-package lib",
+				path("lib/util.go") + ":2:// TODO: three",
+				"--",
+				path("lib/util_test.go") + "-1-package lib",
+				path("lib/util_test.go") + ":2:// TODO: four",
+			},
+		},
+		{
+			name: "no matches",
+			args: map[string]interface{}{"pat": "FIXME"},
+			want: []string{"none"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := grep(tt.args)
+			if want := strings.Join(tt.want, "\n"); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+
+	if _, err := toolGrep(context.Background(), map[string]interface{}{"pat": "x", "output": "lines"}); err == nil {
+		t.Error("expected an error for an unknown output mode")
+	}
+}
+
+func TestGrepOutputModesReachTheModel(t *testing.T) {
+	for _, tool := range convertBuiltInTools() {
+		if tool.Name != "grep" {
+			continue
+		}
+		output := tool.Parameters["properties"].(map[string]interface{})["output"].(map[string]interface{})
+		if enum, _ := output["enum"].([]any); len(enum) != 3 {
+			t.Errorf("output parameter = %v, want its three modes as an enum", output)
+		}
+		return
+	}
+	t.Fatal("no grep tool")
+}
+
+func TestGrepContextSeparators(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.txt")
+	if err := os.WriteFile(path, []byte("a\nx\nb\nc\nd\ne\nx\nf\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := toolGrep(context.Background(), map[string]interface{}{"pat": "^x$", "path": path, "context": 1.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		path + "-1-a", path + ":2:x", path + "-3-b",
+		"--",
+		path + "-6-e", path + ":7:x", path + "-8-f",
+	}, "\n")
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/gotha/bitca/backend"
+	"github.com/gotha/bitca/permission"
+)
+
+// headlessMaxRounds bounds the backend round-trips of a headless run so a
+// model stuck calling tools can't loop forever
+const headlessMaxRounds = 50
+
+// Exit codes of headless mode
+const (
+	exitOK          = 0
+	exitError       = 1
+	exitUsage       = 2
+	exitInterrupted = 130
+)
+
+// headlessPrompt returns the prompt for headless mode from -p and piped
+// stdin. With -p, stdin is only read when readStdin asks for it (a "-"
+// argument, e.g. `git diff | bitca -p "review this" -`) and appended to
+// the prompt, since callers like CI runners often leave stdin open. ok is
+// false when neither is given and the interactive UI should start.
+func headlessPrompt(flagPrompt string, readStdin bool, stdin *os.File) (prompt string, ok bool, err error) {
+	piped := false
+	if info, err := stdin.Stat(); err == nil {
+		piped = info.Mode()&os.ModeCharDevice == 0
+	}
+
+	if !piped || (flagPrompt != "" && !readStdin) {
+		return flagPrompt, flagPrompt != "", nil
+	}
+
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", true, fmt.Errorf("failed to read prompt from stdin: %w", err)
+	}
+	input := strings.TrimSpace(string(data))
+
+	switch {
+	case flagPrompt != "" && input != "":
+		return flagPrompt + "\n\n" + input, true, nil
+	case flagPrompt != "":
+		return flagPrompt, true, nil
+	default:
+		return input, true, nil
+	}
+}
+
+// runHeadless answers a single prompt without the UI and reports the run in
+// the given output format. It returns the exit code.
+func runHeadless(prompt, format string) int {
+	events := newEventWriter(format, os.Stdout, os.Stderr)
+	fail := func(code int, err error) int {
+		events.emit(agentEvent{Type: eventError, Error: err.Error(), ExitCode: code})
+		return code
+	}
+
+	if strings.TrimSpace(prompt) == "" {
+		return fail(exitUsage, fmt.Errorf("empty prompt"))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	m, err := initialModel()
+	if err != nil {
+		return fail(exitError, fmt.Errorf("failed to initialize: %w", err))
+	}
+	defer m.mcpManager.Close()
+	defer m.backend.Close()
+	defer bashSession().KillAll()
+	defer removeSpillDir()
+	defer func() {
+		if m.session != nil {
+			m.session.Close()
+		}
+	}()
+
+	_, err = m.runAgent(ctx, prompt, events.emit)
+	if errors.Is(err, context.Canceled) {
+		return fail(exitInterrupted, fmt.Errorf("interrupted"))
+	}
+	if err != nil {
+		return fail(exitError, err)
+	}
+	return exitOK
+}
+
+// runAgent sends prompt and keeps executing tool calls until the model
+// answers without any, returning that answer. Tool calls that would need
+// interactive approval are denied. Every step is reported to emit, ending
+// with a result event on success.
+func (m *model) runAgent(ctx context.Context, prompt string, emit func(agentEvent)) (string, error) {
+	m.appendMessages(backend.Message{Role: "user", Content: prompt})
+	emit(agentEvent{Type: eventUser, Content: prompt})
+
+	for round := 1; round <= headlessMaxRounds; round++ {
+		result, err := chatTurn(ctx, m.backend, m.modelName, m.messages, m.tools, func(text string) {
+			emit(agentEvent{Type: eventTextDelta, Text: text})
+		})
+		if result.usage != nil {
+			m.usage.add(*result.usage)
+			emit(agentEvent{Type: eventUsage, Usage: m.usageCounts(*result.usage)})
+		}
+		if err != nil {
+			return "", err
+		}
+
+		assistantMsg := backend.Message{
+			Role:      "assistant",
+			Content:   result.content,
+			ToolCalls: result.toolCalls,
+		}
+		m.appendMessages(assistantMsg)
+		emit(agentEvent{Type: eventAssistant, Content: assistantMsg.Content, ToolCalls: assistantMsg.ToolCalls})
+
+		toolCalls := callsToRun(result)
+		if len(toolCalls) == 0 {
+			final := agentEvent{
+				Type:   eventResult,
+				Result: strings.TrimRight(result.content, "\n"),
+				Rounds: round,
+				Usage: m.usageCounts(backend.Usage{
+					PromptTokens:     m.usage.PromptTokens,
+					CompletionTokens: m.usage.CompletionTokens,
+				}),
+			}
+			if m.session != nil {
+				final.SessionID = m.session.ID
+			}
+			emit(final)
+			return result.content, nil
+		}
+
+		denials := make(map[int]string)
+		for i, call := range toolCalls {
+			emit(agentEvent{Type: eventToolCall, ID: call.ID, Name: call.Name, Arguments: call.Arguments})
+
+			decision, reason := checkToolCall(m.permissions, call)
+			switch decision {
+			case permission.Deny:
+				denials[i] = reason
+			case permission.Ask:
+				denials[i] = "it needs approval, which is not available in headless mode " +
+					"(allow it with -permission-mode or a permission rule)"
+			}
+		}
+
+		outcomes := runTools(ctx, m.mcpManager, toolCalls, denials)
+		for i, outcome := range outcomes {
+			emit(agentEvent{
+				Type:       eventToolResult,
+				ID:         toolCalls[i].ID,
+				Name:       toolCalls[i].Name,
+				Content:    outcome.message.Content,
+				Status:     outcome.status,
+				DurationMS: outcome.duration.Milliseconds(),
+			})
+		}
+		m.appendMessages(outcomeMessages(outcomes)...)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+	}
+
+	return "", fmt.Errorf("no final answer after %d rounds of tool calls", headlessMaxRounds)
+}
+
+// usageCounts combines the usage of one request with the run's totals
+func (m *model) usageCounts(last backend.Usage) *eventUsageCounts {
+	return &eventUsageCounts{
+		PromptTokens:          last.PromptTokens,
+		CompletionTokens:      last.CompletionTokens,
+		TotalPromptTokens:     m.usage.PromptTokens,
+		TotalCompletionTokens: m.usage.CompletionTokens,
+	}
+}
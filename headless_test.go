@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gotha/bitca/backend"
+	"github.com/gotha/bitca/permission"
+)
+
+// scriptedBackend replies with the given responses in order
+type scriptedBackend struct {
+	responses []backend.StreamChunk
+	requests  [][]backend.Message
+}
+
+func (b *scriptedBackend) Name() string { return "scripted" }
+
+func (b *scriptedBackend) Chat(ctx context.Context, model string, messages []backend.Message, tools []backend.Tool,
+	stream bool, callback func(backend.StreamChunk) error) error {
+	b.requests = append(b.requests, append([]backend.Message(nil), messages...))
+	chunk := b.responses[0]
+	b.responses = b.responses[1:]
+	chunk.Done = true
+	return callback(chunk)
+}
+
+func (b *scriptedBackend) ListModels(ctx context.Context) ([]backend.ModelInfo, error) {
+	return nil, nil
+}
+
+func (b *scriptedBackend) Close() error { return nil }
+
+func TestRunAgent(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/notes.txt", []byte("remember the milk"), 0o644)
+
+	llm := &scriptedBackend{responses: []backend.StreamChunk{
+		{ToolCalls: []backend.ToolCall{
+			{ID: "call_1", Name: "read", Arguments: map[string]interface{}{"path": dir + "/notes.txt"}},
+			{ID: "call_2", Name: "bash", Arguments: map[string]interface{}{"cmd": "rm " + dir + "/notes.txt"}},
+		}},
+		{Content: "The note says to remember the milk."},
+	}}
+	m := model{
+		backend:     llm,
+		messages:    []backend.Message{{Role: "system", Content: "sys"}},
+		permissions: &permission.Policy{Mode: permission.ModeAutoRead},
+	}
+
+	var out, progress strings.Builder
+	events := newEventWriter(outputText, &out, &progress)
+	answer, err := m.runAgent(context.Background(), "what does the note say?", events.emit)
+	if err != nil {
+		t.Fatalf("runAgent: %v", err)
+	}
+	if answer != "The note says to remember the milk." {
+		t.Errorf("answer = %q", answer)
+	}
+
+	// The read ran, the bash call needed approval and was denied
+	if len(llm.requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(llm.requests))
+	}
+	results := llm.requests[1][3:]
+	if len(results) != 2 || !strings.Contains(results[0].Content, "remember the milk") {
+		t.Errorf("unexpected tool results: %+v", results)
+	}
+	if !strings.Contains(results[1].Content, "headless mode") {
+		t.Errorf("bash should be denied without approval, got %q", results[1].Content)
+	}
+	if _, err := os.Stat(dir + "/notes.txt"); err != nil {
+		t.Errorf("denied command was run: %v", err)
+	}
+	if !strings.Contains(progress.String(), "[tool] bash denied") {
+		t.Errorf("denial not reported: %q", progress.String())
+	}
+	if out.String() != answer+"\n" {
+		t.Errorf("stdout = %q, want only the answer", out.String())
+	}
+}
+
+func TestRunAgentStreamJSON(t *testing.T) {
+	llm := &scriptedBackend{responses: []backend.StreamChunk{
+		{ToolCalls: []backend.ToolCall{{ID: "call_1", Name: "glob", Arguments: map[string]interface{}{"pat": "*.nothing"}}},
+			Usage: &backend.Usage{PromptTokens: 100, CompletionTokens: 10}},
+		{Content: "No files.", Usage: &backend.Usage{PromptTokens: 120, CompletionTokens: 5}},
+	}}
+	m := model{
+		backend:     llm,
+		messages:    []backend.Message{{Role: "system", Content: "sys"}},
+		permissions: &permission.Policy{Mode: permission.ModeAutoRead},
+	}
+
+	var out strings.Builder
+	events := newEventWriter(outputStreamJSON, &out, io.Discard)
+	if _, err := m.runAgent(context.Background(), "find files", events.emit); err != nil {
+		t.Fatalf("runAgent: %v", err)
+	}
+
+	var types []string
+	var last agentEvent
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var ev agentEvent
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("invalid NDJSON line %q: %v", line, err)
+		}
+		types = append(types, ev.Type)
+		last = ev
+	}
+
+	want := "user usage assistant tool_call tool_result text_delta usage assistant result"
+	if strings.Join(types, " ") != want {
+		t.Errorf("events = %v, want %s", types, want)
+	}
+	if last.Result != "No files." || last.Rounds != 2 || last.Usage.TotalPromptTokens != 220 {
+		t.Errorf("unexpected result event: %+v", last)
+	}
+}
+
+func TestHeadlessPromptLeavesStdinAlone(t *testing.T) {
+	// A pipe nobody closes, as CI runners often leave stdin
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	prompt, ok, err := headlessPrompt("review this", false, r)
+	if err != nil || !ok || prompt != "review this" {
+		t.Errorf("headlessPrompt = %q, %v, %v; want the -p prompt without reading stdin", prompt, ok, err)
+	}
+
+	io.WriteString(w, "diff --git a/x b/x\n")
+	w.Close()
+	prompt, _, err = headlessPrompt("review this", true, r)
+	if err != nil || prompt != "review this\n\ndiff --git a/x b/x" {
+		t.Errorf("with -: headlessPrompt = %q, %v; want stdin appended", prompt, err)
+	}
+}
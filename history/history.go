@@ -0,0 +1,143 @@
+package history
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MaxEntries is the number of entries kept per project
+const MaxEntries = 1000
+
+// History is the input history of one project. Entries are stored one JSON
+// string per line so multiline input survives.
+type History struct {
+	path    string
+	entries []string
+}
+
+// DefaultDir returns the default history directory
+// ($XDG_DATA_HOME/bitca/history, falling back to ~/.local/share/bitca/history)
+func DefaultDir() string {
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		return filepath.Join(dataHome, "bitca", "history")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "share", "bitca", "history")
+}
+
+// Open loads the history of the project in directory project, stored in dir
+func Open(dir, project string) (*History, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("no history directory")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(project))
+	h := &History{path: filepath.Join(dir, hex.EncodeToString(sum[:8])+".jsonl")}
+
+	file, err := os.Open(h.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry string
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue // Skip a partially written line
+		}
+		h.entries = append(h.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	// Trim the file once it holds far more than is kept
+	if len(h.entries) > 2*MaxEntries {
+		h.entries = h.entries[len(h.entries)-MaxEntries:]
+		if err := h.rewrite(); err != nil {
+			return nil, err
+		}
+	} else if len(h.entries) > MaxEntries {
+		h.entries = h.entries[len(h.entries)-MaxEntries:]
+	}
+	return h, nil
+}
+
+// Entries returns the history, oldest first
+func (h *History) Entries() []string {
+	return h.entries
+}
+
+// Len returns the number of entries
+func (h *History) Len() int {
+	return len(h.entries)
+}
+
+// Add appends an entry unless it is blank or repeats the last one
+func (h *History) Add(entry string) error {
+	if strings.TrimSpace(entry) == "" {
+		return nil
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == entry {
+		return nil
+	}
+	h.entries = append(h.entries, entry)
+
+	file, err := os.OpenFile(h.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to save history: %w", err)
+	}
+	defer file.Close()
+
+	data, _ := json.Marshal(entry)
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to save history: %w", err)
+	}
+	return nil
+}
+
+// Search returns the index of the newest entry before index before that
+// contains query (case-insensitive), or -1
+func (h *History) Search(query string, before int) int {
+	query = strings.ToLower(query)
+	if before > len(h.entries) {
+		before = len(h.entries)
+	}
+	for i := before - 1; i >= 0; i-- {
+		if strings.Contains(strings.ToLower(h.entries[i]), query) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (h *History) rewrite() error {
+	var b strings.Builder
+	for _, entry := range h.entries {
+		data, _ := json.Marshal(entry)
+		b.Write(data)
+		b.WriteByte('\n')
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("failed to save history: %w", err)
+	}
+	return os.Rename(tmp, h.path)
+}
@@ -0,0 +1,80 @@
+package history
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHistoryPersistence(t *testing.T) {
+	dir := t.TempDir()
+
+	h, err := Open(dir, "/work/project")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, entry := range []string{"first", "second\nwith a newline", "second\nwith a newline", "  ", "third"} {
+		if err := h.Add(entry); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+
+	reopened, err := Open(dir, "/work/project")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	want := []string{"first", "second\nwith a newline", "third"}
+	if fmt.Sprint(reopened.Entries()) != fmt.Sprint(want) {
+		t.Errorf("Entries = %q, want %q", reopened.Entries(), want)
+	}
+
+	// Each project has its own history
+	other, err := Open(dir, "/work/other")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if other.Len() != 0 {
+		t.Errorf("expected empty history for another project, got %q", other.Entries())
+	}
+}
+
+func TestHistorySearch(t *testing.T) {
+	h, err := Open(t.TempDir(), "p")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, entry := range []string{"run go test", "fix the build", "Run go vet"} {
+		h.Add(entry)
+	}
+
+	if i := h.Search("run go", h.Len()); i != 2 {
+		t.Errorf("Search = %d, want 2", i)
+	}
+	if i := h.Search("run go", 2); i != 0 {
+		t.Errorf("Search before 2 = %d, want 0", i)
+	}
+	if i := h.Search("deploy", h.Len()); i != -1 {
+		t.Errorf("Search for missing entry = %d, want -1", i)
+	}
+}
+
+func TestHistoryTrim(t *testing.T) {
+	dir := t.TempDir()
+	h, err := Open(dir, "p")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for i := 0; i < 2*MaxEntries+5; i++ {
+		h.Add(fmt.Sprintf("entry %d", i))
+	}
+
+	reopened, err := Open(dir, "p")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if reopened.Len() != MaxEntries {
+		t.Fatalf("Len = %d, want %d", reopened.Len(), MaxEntries)
+	}
+	if last := reopened.Entries()[MaxEntries-1]; last != fmt.Sprintf("entry %d", 2*MaxEntries+4) {
+		t.Errorf("last entry = %q", last)
+	}
+}
@@ -0,0 +1,246 @@
+// Package ignore walks file trees the way git sees them: without version
+// control directories and without the files .gitignore excludes.
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// vcsDirs are never searched
+var vcsDirs = map[string]bool{
+	".git": true,
+	".hg":  true,
+	".svn": true,
+}
+
+// rule is one pattern from an ignore file
+type rule struct {
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Matcher holds the rules of an ignore file and those of the directories
+// above it
+type Matcher struct {
+	parent *Matcher
+	base   string // directory the rules are relative to
+	rules  []rule
+}
+
+// parse parses ignore rules in .gitignore syntax
+func parse(data []byte) []rule {
+	var rules []rule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if r, ok := parseRule(scanner.Text()); ok {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+func parseRule(line string) (rule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule{}, false
+	}
+
+	r := rule{}
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule{}, false
+	}
+
+	// A slash anywhere but the end ties the pattern to the ignore file's
+	// directory; otherwise it matches a name at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := globToRegexp(line)
+	if anchored {
+		expr = "^" + expr + "$"
+	} else {
+		expr = "^(?:.*/)?" + expr + "$"
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return rule{}, false
+	}
+	r.pattern = pattern
+	return r, true
+}
+
+// globToRegexp converts a gitignore glob to a regular expression matching
+// slash-separated paths
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// with returns a matcher that applies rules relative to dir after the
+// rules of m, which may be nil
+func (m *Matcher) with(dir string, rules []rule) *Matcher {
+	if len(rules) == 0 {
+		return m
+	}
+	return &Matcher{parent: m, base: dir, rules: rules}
+}
+
+// Ignored reports whether path is ignored. Rules of deeper ignore files
+// take precedence, and within a file the last matching rule wins.
+func (m *Matcher) Ignored(path string, isDir bool) bool {
+	for ; m != nil; m = m.parent {
+		rel, err := filepath.Rel(m.base, path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for i := len(m.rules) - 1; i >= 0; i-- {
+			r := m.rules[i]
+			if r.dirOnly && !isDir {
+				continue
+			}
+			if r.pattern.MatchString(rel) {
+				return !r.negate
+			}
+		}
+	}
+	return false
+}
+
+// load reads the ignore rules of dir
+func load(dir string) []rule {
+	data, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return nil
+	}
+	return parse(data)
+}
+
+// ForDir returns the matcher for files in dir: the rules of the
+// .gitignore files of dir and of its parents up to the repository root,
+// and the repository's .git/info/exclude. Outside a repository only dir's
+// own .gitignore applies.
+func ForDir(dir string) *Matcher {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil
+	}
+
+	// Find the repository root, if any
+	dirs := []string{dir}
+	root := ""
+	for d := dir; ; {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			root = d
+			break
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
+		}
+		d = parent
+		dirs = append(dirs, d)
+	}
+
+	var m *Matcher
+	if root == "" {
+		return m.with(dir, load(dir))
+	}
+	if data, err := os.ReadFile(filepath.Join(root, ".git", "info", "exclude")); err == nil {
+		m = m.with(root, parse(data))
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		m = m.with(dirs[i], load(dirs[i]))
+	}
+	return m
+}
+
+// Walk walks the tree rooted at root like filepath.WalkDir, skipping
+// version control directories and whatever the .gitignore files of the
+// repository ignore. Paths passed to fn start with root.
+func Walk(root string, fn fs.WalkDirFunc) error {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	matchers := map[string]*Matcher{abs: ForDir(abs)}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return fn(path, d, err)
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return fn(path, d, err)
+		}
+		absPath := filepath.Join(abs, rel)
+		m := matchers[filepath.Dir(absPath)]
+
+		if d.IsDir() {
+			if vcsDirs[d.Name()] || m.Ignored(absPath, true) {
+				return filepath.SkipDir
+			}
+			matchers[absPath] = m.with(absPath, load(absPath))
+		} else if m.Ignored(absPath, false) {
+			return nil
+		}
+		return fn(path, d, nil)
+	})
+}
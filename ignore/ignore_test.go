@@ -0,0 +1,117 @@
+package ignore
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"*.log", "debug.log", false, true},
+		{"*.log", "a/b/debug.log", false, true},
+		{"*.log", "debug.log.txt", false, false},
+		{"/build", "build", true, true},
+		{"/build", "src/build", true, false},
+		{"build/", "src/build", true, true},
+		{"build/", "src/build", false, false},
+		{"docs/*.md", "docs/a.md", false, true},
+		{"docs/*.md", "docs/sub/a.md", false, false},
+		{"docs/*.md", "x/docs/a.md", false, false},
+		{"**/testdata", "a/b/testdata", true, true},
+		{"a/**/z", "a/z", false, true},
+		{"a/**/z", "a/b/c/z", false, true},
+		{"out/**", "out/x/y", false, true},
+		{"file[0-9].txt", "file3.txt", false, true},
+		{"file[!0-9].txt", "file3.txt", false, false},
+		{`\#notes`, "#notes", false, true},
+	}
+	for _, tt := range tests {
+		m := (*Matcher)(nil).with("/repo", parse([]byte(tt.pattern)))
+		if got := m.Ignored(filepath.Join("/repo", tt.path), tt.isDir); got != tt.want {
+			t.Errorf("%q matching %q (dir %v) = %v, want %v", tt.pattern, tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestNegationAndPrecedence(t *testing.T) {
+	m := (*Matcher)(nil).with("/repo", parse([]byte("# comment\n*.gen.go\n!keep.gen.go\n")))
+	m = m.with("/repo/sub", parse([]byte("!other.gen.go\n")))
+
+	if !m.Ignored("/repo/a.gen.go", false) {
+		t.Error("a.gen.go should be ignored")
+	}
+	if m.Ignored("/repo/keep.gen.go", false) {
+		t.Error("keep.gen.go is re-included by the later rule")
+	}
+	if m.Ignored("/repo/sub/other.gen.go", false) {
+		t.Error("the deeper .gitignore should win")
+	}
+	if m.Ignored("/elsewhere/a.gen.go", false) {
+		t.Error("rules don't apply outside their directory")
+	}
+}
+
+func TestWalk(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".gitignore":            "node_modules/\n*.log\n/dist\n",
+		".git/config":           "",
+		"main.go":               "",
+		"debug.log":             "",
+		"dist/app.js":           "",
+		"src/dist/keep.js":      "",
+		"src/.gitignore":        "*.tmp\n!important.log\n",
+		"src/a.tmp":             "",
+		"src/important.log":     "",
+		"node_modules/x/y.js":   "",
+		"src/node_modules/z.js": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	walk := func(dir string) []string {
+		var got []string
+		err := Walk(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() {
+				rel, _ := filepath.Rel(root, path)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Walk: %v", err)
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	want := []string{".gitignore", "main.go", "src/.gitignore", "src/dist/keep.js", "src/important.log"}
+	if got := walk(root); !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk = %v, want %v", got, want)
+	}
+
+	// Rules from the parent directories apply when walking a subdirectory
+	want = []string{"src/.gitignore", "src/dist/keep.js", "src/important.log"}
+	if got := walk(filepath.Join(root, "src")); !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk(src) = %v, want %v", got, want)
+	}
+}
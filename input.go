@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/gotha/bitca/history"
+)
+
+// maxInputLines is how far the input grows before it scrolls
+const maxInputLines = 8
+
+// newInputEditor creates the multiline message editor. Enter sends the
+// message; Alt+Enter and Ctrl+J insert a newline. Shift+Enter only works in
+// terminals set up to send it as Alt+Enter, otherwise it arrives as Enter.
+func newInputEditor() textarea.Model {
+	ta := textarea.New()
+	ta.Placeholder = "Type your message..."
+	ta.Prompt = "› "
+	ta.ShowLineNumbers = false
+	ta.CharLimit = 0 // Pasted files and logs can be long
+	ta.MaxHeight = 0
+	ta.KeyMap.InsertNewline = key.NewBinding(key.WithKeys("alt+enter", "ctrl+j"))
+
+	textStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#CDD6F4"))
+	ta.FocusedStyle.Text = textStyle
+	ta.FocusedStyle.CursorLine = textStyle
+	ta.FocusedStyle.Placeholder = lipgloss.NewStyle().Foreground(subtleColor)
+	ta.FocusedStyle.Prompt = lipgloss.NewStyle().Foreground(primaryColor).Bold(true)
+	ta.Cursor.Style = lipgloss.NewStyle().Foreground(accentColor)
+
+	ta.SetWidth(80)
+	ta.SetHeight(1)
+	ta.Focus()
+	return ta
+}
+
+// newChatViewport creates the conversation viewport. The arrow keys belong
+// to the input editor, so it scrolls with PgUp/PgDn and Shift+Up/Down.
+func newChatViewport(width, height int) viewport.Model {
+	vp := viewport.New(width, height)
+	vp.KeyMap = viewport.KeyMap{
+		PageUp:   key.NewBinding(key.WithKeys("pgup")),
+		PageDown: key.NewBinding(key.WithKeys("pgdown")),
+		Up:       key.NewBinding(key.WithKeys("shift+up")),
+		Down:     key.NewBinding(key.WithKeys("shift+down")),
+	}
+	return vp
+}
+
+// openHistory opens the input history of the current directory. The app
+// works without it.
+func openHistory() *history.History {
+	cwd, _ := os.Getwd()
+	h, err := history.Open(history.DefaultDir(), cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: input history will not be saved: %v\n", err)
+		return nil
+	}
+	return h
+}
+
+// resizeInput grows the input with its content up to maxInputLines and
+// gives the rest of the screen to the viewport
+func (m *model) resizeInput() {
+	lines := m.textInput.LineCount()
+	if lines > maxInputLines {
+		lines = maxInputLines
+	}
+	if lines < 1 {
+		lines = 1
+	}
+	if lines != m.textInput.Height() {
+		m.textInput.SetHeight(lines)
+	}
+	m.layout()
+}
+
+// layout sizes the viewport to leave room for the input or status area
+func (m *model) layout() {
+	if m.ready {
+		m.viewport.Height = m.height - 10 - m.bottomExtraLines()
+	}
+}
+
+// bottomExtraLines is how many more lines the input or status area takes
+// than a single line of input
+func (m model) bottomExtraLines() int {
+	if m.approval != nil {
+		// The prompt takes two lines, plus the diff of the change
+		extra := 1
+		if m.approval.preview != "" {
+			extra += strings.Count(m.approval.preview, "\n") + 1
+		}
+		return extra
+	}
+	return m.textInput.Height() - 1
+}
+
+// setInput replaces the editor's content, leaving the cursor at the end
+func (m *model) setInput(value string) {
+	m.textInput.SetValue(value)
+	m.resizeInput()
+}
+
+// submitInput records a sent message or command in the history and clears
+// the editor
+func (m *model) submitInput(value string) {
+	if m.history != nil {
+		if err := m.history.Add(value); err != nil {
+			debugLog.Printf("Failed to save input history: %v", err)
+		}
+		m.historyIndex = m.history.Len()
+	}
+	m.historyDraft = ""
+	m.setInput("")
+}
+
+// onFirstInputRow reports whether the cursor is on the first row of the
+// input, counting the rows long lines wrap onto
+func (m *model) onFirstInputRow() bool {
+	return m.textInput.Line() == 0 && m.textInput.LineInfo().RowOffset == 0
+}
+
+// onLastInputRow reports whether the cursor is on the last row of the input
+func (m *model) onLastInputRow() bool {
+	info := m.textInput.LineInfo()
+	return m.textInput.Line() == m.textInput.LineCount()-1 && info.RowOffset == info.Height-1
+}
+
+// historyPrevious shows the previous history entry, keeping what was being
+// typed so historyNext can bring it back
+func (m *model) historyPrevious() bool {
+	if m.history == nil || m.historyIndex <= 0 {
+		return false
+	}
+	if m.historyIndex >= m.history.Len() {
+		m.historyIndex = m.history.Len()
+		m.historyDraft = m.textInput.Value()
+	}
+	m.historyIndex--
+	m.setInput(m.history.Entries()[m.historyIndex])
+	return true
+}
+
+// historyNext shows the next history entry, or the draft after the newest
+func (m *model) historyNext() bool {
+	if m.history == nil || m.historyIndex >= m.history.Len() {
+		return false
+	}
+	m.historyIndex++
+	if m.historyIndex == m.history.Len() {
+		m.setInput(m.historyDraft)
+	} else {
+		m.setInput(m.history.Entries()[m.historyIndex])
+	}
+	return true
+}
+
+// historySearch is an active reverse search (Ctrl+R) through the history
+type historySearch struct {
+	query string
+	match int // index of the matching entry, -1 if none
+}
+
+// startHistorySearch starts a reverse search, or jumps to the next older
+// match if one is active
+func (m *model) startHistorySearch() {
+	if m.history == nil {
+		return
+	}
+	if m.search == nil {
+		m.search = &historySearch{match: -1}
+		return
+	}
+	before := m.history.Len()
+	if m.search.match >= 0 {
+		before = m.search.match
+	}
+	if match := m.history.Search(m.search.query, before); match >= 0 {
+		m.search.match = match
+	}
+}
+
+// updateHistorySearch handles a key while a reverse search is active
+func (m *model) updateHistorySearch(msg tea.KeyMsg) tea.Cmd {
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return tea.Quit
+	case tea.KeyCtrlR:
+		m.startHistorySearch()
+	case tea.KeyEsc, tea.KeyCtrlG:
+		m.search = nil
+	case tea.KeyEnter:
+		if m.search.match >= 0 {
+			m.historyIndex = m.search.match
+			m.setInput(m.history.Entries()[m.search.match])
+		}
+		m.search = nil
+	case tea.KeyBackspace:
+		if runes := []rune(m.search.query); len(runes) > 0 {
+			m.search.query = string(runes[:len(runes)-1])
+			m.search.match = m.searchMatch()
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.search.query += string(msg.Runes)
+		m.search.match = m.searchMatch()
+	}
+	return nil
+}
+
+// searchMatch finds the newest entry matching the search query
+func (m *model) searchMatch() int {
+	if m.search.query == "" {
+		return -1
+	}
+	return m.history.Search(m.search.query, m.history.Len())
+}
+
+// searchView renders the reverse search in place of the editor
+func (m model) searchView() string {
+	match := ""
+	if m.search.match >= 0 {
+		match = m.history.Entries()[m.search.match]
+	} else if m.search.query != "" {
+		match = lipgloss.NewStyle().Foreground(errorColor).Render("no match")
+	}
+	prompt := lipgloss.NewStyle().Foreground(primaryColor).Bold(true).
+		Render(fmt.Sprintf("(reverse-i-search)`%s': ", m.search.query))
+	return prompt + match
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/gotha/bitca/history"
+)
+
+func TestInputHistoryNavigation(t *testing.T) {
+	h, err := history.Open(t.TempDir(), "project")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	m := model{textInput: newInputEditor(), history: h}
+	m.submitInput("first")
+	m.submitInput("second\nline")
+
+	m.setInput("draft")
+	if !m.historyPrevious() || m.textInput.Value() != "second\nline" {
+		t.Fatalf("previous = %q, want the newest entry", m.textInput.Value())
+	}
+	if m.textInput.Height() != 2 {
+		t.Errorf("input height = %d, want 2 for a two-line entry", m.textInput.Height())
+	}
+	if !m.historyPrevious() || m.textInput.Value() != "first" {
+		t.Fatalf("previous = %q, want the oldest entry", m.textInput.Value())
+	}
+	if m.historyPrevious() {
+		t.Error("expected no entry before the oldest")
+	}
+	m.historyNext()
+	if !m.historyNext() || m.textInput.Value() != "draft" {
+		t.Fatalf("next = %q, want the draft back", m.textInput.Value())
+	}
+}
+
+func TestInputHistorySearch(t *testing.T) {
+	h, err := history.Open(t.TempDir(), "project")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	m := model{textInput: newInputEditor(), history: h}
+	for _, entry := range []string{"run the tests", "fix lint", "run the build"} {
+		m.submitInput(entry)
+	}
+
+	m.startHistorySearch()
+	for _, r := range "run" {
+		m.updateHistorySearch(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	m.updateHistorySearch(tea.KeyMsg{Type: tea.KeyCtrlR})
+	m.updateHistorySearch(tea.KeyMsg{Type: tea.KeyEnter})
+
+	if m.search != nil {
+		t.Error("expected the search to end")
+	}
+	if got := m.textInput.Value(); got != "run the tests" {
+		t.Errorf("input = %q, want the second match", got)
+	}
+}
+
+func TestInputHistoryWaitsForTheEdgeRow(t *testing.T) {
+	h, err := history.Open(t.TempDir(), "project")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	m := model{textInput: newInputEditor(), history: h}
+	m.textInput.SetWidth(20)
+	m.submitInput("older entry")
+	m.setInput("a draft long enough to wrap onto a few rows of the input")
+
+	if m.onFirstInputRow() {
+		t.Error("cursor at the end of a wrapped line counts as the first row")
+	}
+	if !m.onLastInputRow() {
+		t.Error("cursor at the end of the input isn't on the last row")
+	}
+	m.textInput.CursorStart()
+	if !m.onFirstInputRow() {
+		t.Error("cursor at the start of the input isn't on the first row")
+	}
+	if m.onLastInputRow() {
+		t.Error("cursor at the start of a wrapped line counts as the last row")
+	}
+}
@@ -4,8 +4,12 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/gotha/bitca/checkpoint"
+	"github.com/gotha/bitca/shell"
+	"github.com/gotha/bitca/workspace"
 )
 
 // Config holds command-line configuration
@@ -16,16 +20,58 @@ type Config struct {
 	OpenAIModel   string
 	OpenAIAPIKey  string
 	OpenAIAPIBase string
+
+	AnthropicModel   string
+	AnthropicAPIKey  string
+	AnthropicAPIBase string
+
+	GeminiModel   string
+	GeminiAPIKey  string
+	GeminiAPIBase string
+
+	Resume   string
+	Continue bool
+
+	ContextWindow    int
+	CompactThreshold int
+
+	PermissionMode string
+
+	Workspace string
+	AllowDirs stringList
+
+	Prompt       string
+	OutputFormat string
+
+	MaxToolOutput int
+	NoSpill       bool
+	ReadImages    bool
 }
 
 var config Config
 
+// stringList is a flag that can be given multiple times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 func printUsage() {
-	fmt.Printf("Usage: %s [options]\n\n", os.Args[0])
+	fmt.Printf("Usage: %s [options]\n", os.Args[0])
+	fmt.Printf("       %s -p \"prompt\" [options]\n", os.Args[0])
+	fmt.Printf("       echo \"prompt\" | %s [options]\n\n", os.Args[0])
 	fmt.Printf("A terminal-based chat application with MCP tool support.\n\n")
+	fmt.Printf("With -p or a prompt on stdin, bitca runs without the UI: it answers the prompt,\n")
+	fmt.Printf("running tools as needed, prints the final answer to stdout and exits non-zero on failure.\n\n")
 	fmt.Printf("Options:\n")
 	fmt.Printf("  -backend string\n")
-	fmt.Printf("        Backend to use: 'ollama' or 'openai' (default \"ollama\")\n")
+	fmt.Printf("        Backend to use: 'ollama', 'openai', 'anthropic' or 'gemini' (default \"ollama\")\n")
 	fmt.Printf("  -model string\n")
 	fmt.Printf("        Ollama model to use (default \"mistral-small:24b\")\n")
 	fmt.Printf("  -openai-model string\n")
@@ -34,6 +80,42 @@ func printUsage() {
 	fmt.Printf("        OpenAI API key (fallback to OPENAI_API_KEY env var)\n")
 	fmt.Printf("  -openai-api-base string\n")
 	fmt.Printf("        OpenAI API base URL (fallback to OPENAI_API_BASE env var)\n")
+	fmt.Printf("  -anthropic-model string\n")
+	fmt.Printf("        Anthropic model to use (default \"claude-sonnet-4-5\")\n")
+	fmt.Printf("  -anthropic-api-key string\n")
+	fmt.Printf("        Anthropic API key (fallback to ANTHROPIC_API_KEY env var)\n")
+	fmt.Printf("  -anthropic-api-base string\n")
+	fmt.Printf("        Anthropic API base URL (fallback to ANTHROPIC_API_BASE env var)\n")
+	fmt.Printf("  -gemini-model string\n")
+	fmt.Printf("        Gemini model to use (default \"gemini-2.5-flash\")\n")
+	fmt.Printf("  -gemini-api-key string\n")
+	fmt.Printf("        Gemini API key (fallback to GEMINI_API_KEY env var)\n")
+	fmt.Printf("  -gemini-api-base string\n")
+	fmt.Printf("        Gemini API base URL (fallback to GEMINI_API_BASE env var)\n")
+	fmt.Printf("  -resume string\n")
+	fmt.Printf("        Resume the saved session with this ID (see /sessions)\n")
+	fmt.Printf("  -continue\n")
+	fmt.Printf("        Continue the most recent session started in the current directory\n")
+	fmt.Printf("  -context-window int\n")
+	fmt.Printf("        Context window size in tokens used for usage accounting (default: guessed per model)\n")
+	fmt.Printf("  -compact-threshold int\n")
+	fmt.Printf("        Compact older messages automatically when the context is this %% full, 0 to disable (default 80)\n")
+	fmt.Printf("  -permission-mode string\n")
+	fmt.Printf("        Tool approval mode: 'ask', 'auto-read' or 'allow-all' (default: from the permissions file, else auto-read)\n")
+	fmt.Printf("  -p string\n")
+	fmt.Printf("        Answer this prompt without the UI (piped stdin is appended to it)\n")
+	fmt.Printf("  -output-format string\n")
+	fmt.Printf("        Headless output: 'text' (the answer), 'json' (one result object) or 'stream-json' (NDJSON events) (default \"text\")\n")
+	fmt.Printf("  -workspace string\n")
+	fmt.Printf("        Directory the file tools are confined to (default: current directory)\n")
+	fmt.Printf("  -allow-dir string\n")
+	fmt.Printf("        Extra directory the file tools may access (can be repeated)\n")
+	fmt.Printf("  -max-tool-output int\n")
+	fmt.Printf("        Characters of tool output sent to the model per turn; longer results are cut in the middle, 0 for no limit (default 100000)\n")
+	fmt.Printf("  -no-spill\n")
+	fmt.Printf("        Don't save the whole output of truncated tool results to temporary files\n")
+	fmt.Printf("  -read-images\n")
+	fmt.Printf("        Let the read tool attach images for models that can see them (PNG, JPEG, GIF and WebP up to 5 MB)\n")
 	fmt.Printf("  -no-streaming\n")
 	fmt.Printf("        Disable response streaming (some models don't support tool calls with streaming)\n")
 	fmt.Printf("  -h, -help\n")
@@ -43,6 +125,14 @@ func printUsage() {
 	fmt.Printf("  /model    Show or change the current model\n")
 	fmt.Printf("  /backend  Show or change the current backend\n")
 	fmt.Printf("  /tools    List available tools\n")
+	fmt.Printf("  /permissions Show or change tool permissions\n")
+	fmt.Printf("  /usage    Show token usage and context window fill\n")
+	fmt.Printf("  /compact  Summarize older messages to free up context\n")
+	fmt.Printf("  /undo     Undo the file changes and messages of the last turn\n")
+	fmt.Printf("  /rewind   List checkpoints or go back to one\n")
+	fmt.Printf("  /shell    Show the bash session's directory and jobs, restart it or stop its jobs\n")
+	fmt.Printf("  /sessions List saved sessions\n")
+	fmt.Printf("  /resume   Resume a saved session\n")
 	fmt.Printf("  /mcp      Show MCP server status\n")
 	fmt.Printf("  /debug    Show debug information\n")
 }
@@ -58,10 +148,28 @@ func main() {
 
 	flag.BoolVar(&config.NoStreaming, "no-streaming", false, "Disable response streaming")
 	flag.StringVar(&config.Model, "model", "mistral-small:24b", "Ollama model to use")
-	flag.StringVar(&config.Backend, "backend", "ollama", "Backend to use: 'ollama' or 'openai'")
+	flag.StringVar(&config.Backend, "backend", "ollama", "Backend to use: 'ollama', 'openai', 'anthropic' or 'gemini'")
 	flag.StringVar(&config.OpenAIModel, "openai-model", "gpt-4o", "OpenAI model to use")
 	flag.StringVar(&config.OpenAIAPIKey, "openai-api-key", "", "OpenAI API key")
 	flag.StringVar(&config.OpenAIAPIBase, "openai-api-base", "", "OpenAI API base URL")
+	flag.StringVar(&config.AnthropicModel, "anthropic-model", "claude-sonnet-4-5", "Anthropic model to use")
+	flag.StringVar(&config.AnthropicAPIKey, "anthropic-api-key", "", "Anthropic API key")
+	flag.StringVar(&config.AnthropicAPIBase, "anthropic-api-base", "", "Anthropic API base URL")
+	flag.StringVar(&config.GeminiModel, "gemini-model", "gemini-2.5-flash", "Gemini model to use")
+	flag.StringVar(&config.GeminiAPIKey, "gemini-api-key", "", "Gemini API key")
+	flag.StringVar(&config.GeminiAPIBase, "gemini-api-base", "", "Gemini API base URL")
+	flag.StringVar(&config.Resume, "resume", "", "Resume the saved session with this ID")
+	flag.BoolVar(&config.Continue, "continue", false, "Continue the most recent session in the current directory")
+	flag.IntVar(&config.ContextWindow, "context-window", 0, "Context window size in tokens (0 = guess per model)")
+	flag.IntVar(&config.CompactThreshold, "compact-threshold", 80, "Compact older messages when the context is this percent full (0 = never)")
+	flag.StringVar(&config.PermissionMode, "permission-mode", "", "Tool approval mode: 'ask', 'auto-read' or 'allow-all'")
+	flag.StringVar(&config.Workspace, "workspace", "", "Directory the file tools are confined to (default: current directory)")
+	flag.Var(&config.AllowDirs, "allow-dir", "Extra directory the file tools may access (can be repeated)")
+	flag.StringVar(&config.Prompt, "p", "", "Answer this prompt without the UI and exit; a - argument appends stdin to it")
+	flag.StringVar(&config.OutputFormat, "output-format", outputText, "Headless output: 'text', 'json' or 'stream-json'")
+	flag.IntVar(&config.MaxToolOutput, "max-tool-output", 100000, "Characters of tool output sent to the model per turn (0 = no limit)")
+	flag.BoolVar(&config.NoSpill, "no-spill", false, "Don't save truncated tool output to temporary files")
+	flag.BoolVar(&config.ReadImages, "read-images", false, "Let the read tool show images to the model (needs a model that can see images)")
 	flag.Parse()
 
 	// Use environment variables as fallback for OpenAI configuration
@@ -72,27 +180,111 @@ func main() {
 		config.OpenAIAPIBase = os.Getenv("OPENAI_API_BASE")
 	}
 
+	// Same for Anthropic configuration
+	if config.AnthropicAPIKey == "" {
+		config.AnthropicAPIKey = os.Getenv("ANTHROPIC_API_KEY")
+	}
+	if config.AnthropicAPIBase == "" {
+		config.AnthropicAPIBase = os.Getenv("ANTHROPIC_API_BASE")
+	}
+
+	// Same for Gemini configuration
+	if config.GeminiAPIKey == "" {
+		config.GeminiAPIKey = os.Getenv("GEMINI_API_KEY")
+	}
+	if config.GeminiAPIBase == "" {
+		config.GeminiAPIBase = os.Getenv("GEMINI_API_BASE")
+	}
+
 	// Validate backend selection
-	if config.Backend != "ollama" && config.Backend != "openai" {
-		fmt.Printf("Error: backend must be 'ollama' or 'openai', got '%s'\n", config.Backend)
+	validBackend := false
+	for _, name := range availableBackends {
+		if config.Backend == name {
+			validBackend = true
+		}
+	}
+	if !validBackend {
+		fmt.Fprintf(os.Stderr, "Error: backend must be 'ollama', 'openai', 'anthropic' or 'gemini', got '%s'\n", config.Backend)
 		os.Exit(1)
 	}
 
 	// Validate OpenAI configuration if using OpenAI backend
 	if config.Backend == "openai" && config.OpenAIAPIKey == "" {
-		fmt.Printf("Error: OpenAI API key is required. Set OPENAI_API_KEY env var or use -openai-api-key flag\n")
+		fmt.Fprintf(os.Stderr, "Error: OpenAI API key is required. Set OPENAI_API_KEY env var or use -openai-api-key flag\n")
 		os.Exit(1)
 	}
 
+	// Validate Anthropic configuration if using Anthropic backend
+	if config.Backend == "anthropic" && config.AnthropicAPIKey == "" {
+		fmt.Fprintf(os.Stderr, "Error: Anthropic API key is required. Set ANTHROPIC_API_KEY env var or use -anthropic-api-key flag\n")
+		os.Exit(1)
+	}
+
+	// Validate Gemini configuration if using Gemini backend
+	if config.Backend == "gemini" && config.GeminiAPIKey == "" {
+		fmt.Fprintf(os.Stderr, "Error: Gemini API key is required. Set GEMINI_API_KEY env var or use -gemini-api-key flag\n")
+		os.Exit(1)
+	}
+
+	// Confine the file tools to the workspace; relative paths and bash
+	// commands start from its root
+	ws, err := workspace.New(config.Workspace, config.AllowDirs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.Chdir(ws.Root()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: cannot change to workspace %s: %v\n", ws.Root(), err)
+		os.Exit(1)
+	}
+	toolWorkspace = ws
+	toolShell = shell.New(ws.Root())
+
+	// Run headless when a prompt is given with -p or on stdin
+	readStdin := flag.NArg() == 1 && flag.Arg(0) == "-"
+	prompt, headless, err := headlessPrompt(config.Prompt, readStdin, os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	validFormat := false
+	for _, format := range outputFormats {
+		if config.OutputFormat == format {
+			validFormat = true
+		}
+	}
+	if !validFormat {
+		fmt.Fprintf(os.Stderr, "Error: output format must be 'text', 'json' or 'stream-json', got '%s'\n", config.OutputFormat)
+		os.Exit(exitUsage)
+	}
+	if headless {
+		os.Exit(runHeadless(prompt, config.OutputFormat))
+	}
+	if config.OutputFormat != outputText {
+		fmt.Fprintf(os.Stderr, "Error: -output-format needs a prompt from -p or stdin\n")
+		os.Exit(exitUsage)
+	}
+
 	m, err := initialModel()
 	if err != nil {
-		fmt.Printf("Error initializing: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error initializing: %v\n", err)
 		os.Exit(1)
 	}
+	// Only the interactive UI keeps an input history and checkpoints
+	m.history = openHistory()
+	if m.history != nil {
+		m.historyIndex = m.history.Len()
+	}
+	m.checkpoints = checkpoint.New()
+	toolCheckpoints = m.checkpoints
 
 	p := tea.NewProgram(m, tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
-		fmt.Printf("Error running program: %v\n", err)
+	_, err = p.Run()
+	// Don't leave servers started by the agent running
+	bashSession().KillAll()
+	removeSpillDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error running program: %v\n", err)
 		os.Exit(1)
 	}
 }
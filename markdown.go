@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+)
+
+// markdownRenderer renders assistant messages as Markdown with syntax
+// highlighted code blocks. Rendered text is cached because the whole
+// transcript is redrawn on every update.
+type markdownRenderer struct {
+	width    int
+	renderer *glamour.TermRenderer
+	cache    map[string]string
+
+	// The completed blocks of the response being streamed, kept apart from
+	// the cache, which would otherwise get every longer prefix of it
+	stable         string
+	stableWidth    int
+	stableRendered string
+}
+
+func newMarkdownRenderer() *markdownRenderer {
+	return &markdownRenderer{cache: make(map[string]string)}
+}
+
+// render renders text wrapped to width. It falls back to plain wrapping if
+// the Markdown can't be rendered.
+func (r *markdownRenderer) render(text string, width int) string {
+	if width <= 0 {
+		return text
+	}
+	if width != r.width || r.renderer == nil {
+		// Word wrap is fixed per renderer, so start over when the width changes
+		renderer, err := glamour.NewTermRenderer(
+			glamour.WithStylePath(markdownStyle()),
+			glamour.WithWordWrap(width),
+		)
+		if err != nil {
+			debugLog.Printf("Failed to create Markdown renderer: %v", err)
+			return wordWrap(text, width)
+		}
+		r.renderer = renderer
+		r.width = width
+		r.cache = make(map[string]string)
+	}
+
+	if rendered, ok := r.cache[text]; ok {
+		return rendered
+	}
+
+	rendered, err := r.renderer.Render(text)
+	if err != nil {
+		debugLog.Printf("Failed to render Markdown: %v", err)
+		return wordWrap(text, width)
+	}
+	rendered = strings.Trim(rendered, "\n")
+	r.cache[text] = rendered
+	return rendered
+}
+
+// renderStreaming renders a response that is still being streamed. The
+// completed blocks are rendered again only when another one completes;
+// the block still being written is rendered on every chunk, with an open
+// code fence closed so partial code is highlighted too.
+func (r *markdownRenderer) renderStreaming(text string, width int) string {
+	stable, tail := splitStableMarkdown(text)
+
+	var parts []string
+	if stable != "" {
+		if stable != r.stable || width != r.stableWidth {
+			_, cached := r.cache[stable]
+			r.stableRendered = r.render(stable, width)
+			if !cached {
+				delete(r.cache, stable)
+			}
+			r.stable, r.stableWidth = stable, width
+		}
+		parts = append(parts, r.stableRendered)
+	}
+	if strings.TrimSpace(tail) != "" {
+		if openFence(stable + tail) {
+			tail += "\n```"
+		}
+		// The tail changes with every chunk; don't let it fill the cache
+		rendered := r.render(tail, width)
+		delete(r.cache, tail)
+		parts = append(parts, rendered)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// splitStableMarkdown splits streamed Markdown after the last blank line
+// outside a code block. Blocks before it won't change as more text arrives.
+func splitStableMarkdown(text string) (stable, tail string) {
+	inFence := false
+	split := 0
+	offset := 0
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		offset += len(line)
+		trimmed := strings.TrimSpace(line)
+		if isFence(trimmed) {
+			inFence = !inFence
+			continue
+		}
+		// Only count complete lines; the last one may still be growing
+		if !inFence && trimmed == "" && strings.HasSuffix(line, "\n") {
+			split = offset
+		}
+	}
+
+	return strings.TrimRight(text[:split], "\n"), text[split:]
+}
+
+// openFence reports whether text ends inside a fenced code block
+func openFence(text string) bool {
+	open := false
+	for _, line := range strings.Split(text, "\n") {
+		if isFence(strings.TrimSpace(line)) {
+			open = !open
+		}
+	}
+	return open
+}
+
+func isFence(line string) bool {
+	return strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~")
+}
+
+// markdownStyle returns the glamour style to use: $GLAMOUR_STYLE (a style
+// name or a JSON style file) or the dark style matching the UI colors
+func markdownStyle() string {
+	if style := os.Getenv("GLAMOUR_STYLE"); style != "" {
+		return style
+	}
+	return "dark"
+}
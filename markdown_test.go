@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitStableMarkdown(t *testing.T) {
+	tests := []struct {
+		text   string
+		stable string
+		tail   string
+	}{
+		{"Hello", "", "Hello"},
+		{"# Title\n\nSome text", "# Title", "Some text"},
+		{"Intro\n\n```go\nfunc main() {\n\n\tfmt.Println", "Intro", "```go\nfunc main() {\n\n\tfmt.Println"},
+		{"```go\nx := 1\n```\n\nAfter", "```go\nx := 1\n```", "After"},
+		{"Para one\n\nPara two\n\n", "Para one\n\nPara two", ""},
+	}
+
+	for _, tt := range tests {
+		stable, tail := splitStableMarkdown(tt.text)
+		if stable != tt.stable || tail != tt.tail {
+			t.Errorf("splitStableMarkdown(%q) = %q, %q; want %q, %q", tt.text, stable, tail, tt.stable, tt.tail)
+		}
+	}
+}
+
+func TestRenderStreamingClosesFence(t *testing.T) {
+	r := newMarkdownRenderer()
+	out := r.renderStreaming("Look:\n\n```go\nfunc main() {", 60)
+	if strings.Contains(out, "```") {
+		t.Errorf("open fence rendered literally:\n%s", out)
+	}
+	if !strings.Contains(out, "main") {
+		t.Errorf("code missing from output:\n%s", out)
+	}
+	if len(r.cache) != 0 || r.stable != "Look:" {
+		t.Errorf("only the stable part should be kept, got %d cache entries and %q", len(r.cache), r.stable)
+	}
+}
+
+func TestRenderStreamingKeepsOnePrefix(t *testing.T) {
+	r := newMarkdownRenderer()
+	var text string
+	for i := 0; i < 20; i++ {
+		text += "Paragraph.\n\n"
+		r.renderStreaming(text+"More", 60)
+	}
+	if len(r.cache) != 0 {
+		t.Errorf("%d streamed prefixes cached, want none", len(r.cache))
+	}
+	if r.stable != strings.TrimRight(text, "\n") {
+		t.Errorf("kept %q, want the last stable prefix", r.stable)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// toolOutputLimits caps the characters of a single result per tool; other
+// tools, MCP ones included, get defaultToolOutputLimit
+var toolOutputLimits = map[string]int{
+	"read":        40000,
+	"bash":        30000,
+	"bash_output": 30000,
+	"grep":        20000,
+	"glob":        20000,
+}
+
+const (
+	defaultToolOutputLimit = 30000
+
+	// minToolOutput is what a result keeps even when the turn's budget is
+	// used up, so every call still tells the model something
+	minToolOutput = 2000
+
+	// truncationNoteSize is the room kept for the note that replaces the
+	// middle of a truncated result
+	truncationNoteSize = 200
+)
+
+// outputBudget is how much tool output the results of one turn may add to
+// the conversation
+type outputBudget struct {
+	remaining int // characters left; below zero means no limit
+}
+
+// newOutputBudget starts a budget of total characters, 0 meaning no limit
+func newOutputBudget(total int) *outputBudget {
+	if total <= 0 {
+		return &outputBudget{remaining: -1}
+	}
+	return &outputBudget{remaining: total}
+}
+
+// fit truncates the result of a tool to the tool's limit and what is left
+// of the budget, and charges the budget for it
+func (b *outputBudget) fit(name, result string) string {
+	if b.remaining < 0 {
+		return result
+	}
+
+	limit, ok := toolOutputLimits[name]
+	if !ok {
+		limit = defaultToolOutputLimit
+	}
+	limit = min(limit, max(b.remaining, minToolOutput))
+
+	result = truncateOutput(name, result, limit)
+	b.remaining = max(b.remaining-len(result), 0)
+	return result
+}
+
+// truncateOutput keeps the head and tail of a result longer than limit
+// characters and replaces the middle with a note on how to get it: the
+// offset to read from for the read tool, or the file the whole result was
+// saved to for other tools
+func truncateOutput(name, result string, limit int) string {
+	if len(result) <= limit {
+		return result
+	}
+
+	// Two thirds of the room left by the note for the head, the rest for
+	// the tail
+	room := max(limit-truncationNoteSize, 0)
+	head, tail := splitOutput(result, room*2/3, room/3)
+	omitted := result[len(head) : len(result)-len(tail)]
+	lines := strings.Count(omitted, "\n")
+
+	var note string
+	if name == "read" {
+		rest := omitted
+		if !strings.HasSuffix(head, "\n") {
+			_, rest, _ = strings.Cut(rest, "\n")
+		}
+		note = fmt.Sprintf("[... %d lines omitted; read them with offset and limit%s ...]", lines, readOffsetHint(rest, lines))
+	} else if path, err := spillOutput(name, result); err == nil {
+		note = fmt.Sprintf("[... %d lines (%d characters) omitted; the whole output is in %s, read it with offset and limit ...]",
+			lines, len(omitted), path)
+	} else {
+		if !os.IsNotExist(err) {
+			debugLog.Printf("Cannot save %s output: %v", name, err)
+		}
+		note = fmt.Sprintf("[... %d lines (%d characters) omitted ...]", lines, len(omitted))
+	}
+
+	debugLog.Printf("Truncated %s output from %d to %d characters", name, len(result), len(head)+len(tail))
+	return strings.TrimSuffix(head, "\n") + "\n" + note + "\n" + tail
+}
+
+// splitOutput returns at most headSize characters from the start of s and
+// at most tailSize from the end, cut at line boundaries where possible
+func splitOutput(s string, headSize, tailSize int) (head, tail string) {
+	head = s[:headSize]
+	if i := strings.LastIndex(head, "\n"); i >= 0 {
+		head = head[:i+1]
+	} else {
+		// A single long line is cut at a character boundary instead
+		for len(head) > 0 && !utf8.RuneStart(s[len(head)]) {
+			head = head[:len(head)-1]
+		}
+	}
+
+	tail = s[len(s)-tailSize:]
+	if i := strings.Index(tail, "\n"); i >= 0 && i < len(tail)-1 {
+		tail = tail[i+1:]
+	} else {
+		for len(tail) > 0 && !utf8.RuneStart(tail[0]) {
+			tail = tail[1:]
+		}
+	}
+	return head, tail
+}
+
+// readOffsetHint suggests the offset and limit that read the omitted part
+// of a read result, which starts with a line numbered by the read tool
+func readOffsetHint(omitted string, lines int) string {
+	number, _, ok := strings.Cut(omitted, "|")
+	if !ok {
+		return ""
+	}
+	line, err := strconv.Atoi(strings.TrimSpace(number))
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf(" (offset %d, limit %d)", line-1, lines)
+}
+
+// spillDir holds tool results that were truncated, so the model can page
+// through them with the read tool. It is created on first use and removed
+// when bitca exits.
+var spillDir string
+
+// spillOutput saves a whole tool result to a file in spillDir and returns
+// its path. It returns an error satisfying os.IsNotExist when saving is
+// turned off.
+func spillOutput(name, result string) (string, error) {
+	if config.NoSpill {
+		return "", os.ErrNotExist
+	}
+	if spillDir == "" {
+		dir, err := os.MkdirTemp("", "bitca-output-")
+		if err != nil {
+			return "", err
+		}
+		// Resolved, so the paths handed out match what the read tool sees
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = resolved
+		}
+		spillDir = dir
+	}
+
+	// MCP tool names may contain anything
+	prefix := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, name)
+	f, err := os.CreateTemp(spillDir, prefix+"-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(result); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// isSpillFile reports whether path is a saved tool result, which the read
+// tool may read even outside the workspace
+func isSpillFile(path string) bool {
+	if spillDir == "" || !filepath.IsAbs(path) {
+		return false
+	}
+	return filepath.Dir(filepath.Clean(path)) == spillDir
+}
+
+// removeSpillDir removes the saved tool results
+func removeSpillDir() {
+	if spillDir != "" {
+		os.RemoveAll(spillDir)
+		spillDir = ""
+	}
+}
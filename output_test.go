@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gotha/bitca/workspace"
+)
+
+// numberedLines returns n lines the way the read tool prints them
+func numberedLines(n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "%4d| line %d\n", i, i)
+	}
+	return b.String()
+}
+
+func TestTruncateReadOutput(t *testing.T) {
+	result := numberedLines(1000)
+	got := truncateOutput("read", result, 3000)
+
+	if len(got) > 3000 {
+		t.Errorf("truncated to %d characters, want about 3000", len(got))
+	}
+	if !strings.HasPrefix(got, "   1| line 1\n") || !strings.HasSuffix(got, "1000| line 1000\n") {
+		t.Errorf("head or tail missing:\n%s", got)
+	}
+
+	note := regexp.MustCompile(`\[\.\.\. (\d+) lines omitted; read them with offset and limit \(offset (\d+), limit (\d+)\) \.\.\.\]\n +(\d+)\|`).
+		FindStringSubmatch(got)
+	if note == nil {
+		t.Fatalf("no offset note in:\n%s", got)
+	}
+	var omitted, offset, limit, next int
+	fmt.Sscan(note[1]+" "+note[2]+" "+note[3]+" "+note[4], &omitted, &offset, &limit, &next)
+	if limit != omitted || offset+limit+1 != next {
+		t.Errorf("offset %d, limit %d doesn't cover the %d lines before line %d", offset, limit, omitted, next)
+	}
+	if !strings.Contains(got, fmt.Sprintf("%4d| line %d\n[...", offset, offset)) {
+		t.Errorf("offset %d doesn't follow the head:\n%s", offset, got)
+	}
+}
+
+func TestTruncateSpillsOutput(t *testing.T) {
+	ws, err := workspace.New(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedWorkspace := toolWorkspace
+	toolWorkspace = ws
+	t.Cleanup(func() {
+		toolWorkspace = savedWorkspace
+		removeSpillDir()
+	})
+
+	result := strings.Repeat("building...\n", 5000) + "FAIL: TestSomething\n"
+	got := truncateOutput("bash", result, 2000)
+	if !strings.HasSuffix(got, "FAIL: TestSomething\n") {
+		t.Errorf("tail missing:\n%s", got)
+	}
+
+	match := regexp.MustCompile(`the whole output is in (\S+), read it`).FindStringSubmatch(got)
+	if match == nil {
+		t.Fatalf("no file in:\n%s", got)
+	}
+	data, err := os.ReadFile(match[1])
+	if err != nil || string(data) != result {
+		t.Fatalf("saved output is %d characters, %v; want the whole result", len(data), err)
+	}
+
+	// The read tool can page through it although it is outside the workspace
+	page, err := toolRead(map[string]interface{}{"path": match[1], "offset": 5000.0, "limit": 1.0})
+	if err != nil {
+		t.Fatalf("reading the saved output: %v", err)
+	}
+	if page != "5001| FAIL: TestSomething\n" {
+		t.Errorf("page = %q", page)
+	}
+	if _, err := toolRead(map[string]interface{}{"path": filepath.Join(filepath.Dir(match[1]), "..", "other.txt")}); err == nil {
+		t.Error("expected files next to the saved output's directory to stay outside the workspace")
+	}
+
+	removeSpillDir()
+	if _, err := os.Stat(match[1]); !os.IsNotExist(err) {
+		t.Errorf("saved output not removed: %v", err)
+	}
+}
+
+func TestTruncateWithoutSpill(t *testing.T) {
+	saved := config.NoSpill
+	config.NoSpill = true
+	t.Cleanup(func() { config.NoSpill = saved })
+
+	got := truncateOutput("mcp/tool", strings.Repeat("x", 10000), 1000)
+	if !strings.Contains(got, "\n[... 0 lines (9201 characters) omitted ...]\n") || len(got) > 1000 {
+		t.Errorf("got %d characters:\n%s", len(got), got)
+	}
+	if spillDir != "" {
+		t.Error("output saved although spilling is off")
+	}
+}
+
+func TestOutputBudget(t *testing.T) {
+	saved := config.NoSpill
+	config.NoSpill = true
+	t.Cleanup(func() { config.NoSpill = saved })
+
+	short := "ok"
+	long := strings.Repeat("some output\n", 10000)
+
+	budget := newOutputBudget(50000)
+	if got := budget.fit("bash", short); got != short {
+		t.Errorf("short result changed to %q", got)
+	}
+	// Each result is held to its tool's limit...
+	if got := budget.fit("grep", long); len(got) > toolOutputLimits["grep"] {
+		t.Errorf("grep result is %d characters, over its limit", len(got))
+	}
+	first := budget.fit("bash", long)
+	// ...and together to the budget, leaving every later result a little
+	second := budget.fit("bash", long)
+	if len(first) < 25000 || len(second) > 10000 || len(second) < minToolOutput/2 {
+		t.Errorf("results of %d and %d characters; want the second cut to what is left", len(first), len(second))
+	}
+	if last := budget.fit("bash", long); len(last) > minToolOutput {
+		t.Errorf("result after the budget is used up is %d characters", len(last))
+	}
+
+	unlimited := newOutputBudget(0)
+	if got := unlimited.fit("bash", long); got != long {
+		t.Error("expected no truncation without a budget")
+	}
+}
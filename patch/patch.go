@@ -0,0 +1,452 @@
+// Package patch parses patches in unified diff or search/replace block
+// format and applies them with fuzzy context matching.
+package patch
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DevNull is the path a unified diff uses for a missing file
+const DevNull = "/dev/null"
+
+// Op is the kind of a hunk line
+type Op int
+
+const (
+	Context Op = iota
+	Add
+	Remove
+)
+
+// Line is one line of a hunk
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Hunk is one change to a file
+type Hunk struct {
+	OldStart int // 1-based line the hunk starts at in the old file, 0 if unknown
+	Lines    []Line
+}
+
+// old returns the lines the hunk expects in the file
+func (h Hunk) old() []Line {
+	var lines []Line
+	for _, l := range h.Lines {
+		if l.Op != Add {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// FilePatch is the change to one file. OldPath is DevNull for a new file
+// and NewPath is DevNull for a deleted one.
+type FilePatch struct {
+	OldPath string
+	NewPath string
+	Hunks   []Hunk
+}
+
+// Path returns the path of the file the patch changes
+func (p FilePatch) Path() string {
+	if p.NewPath == DevNull {
+		return p.OldPath
+	}
+	return p.NewPath
+}
+
+// IsNew reports whether the patch creates the file
+func (p FilePatch) IsNew() bool {
+	return p.OldPath == DevNull
+}
+
+// IsDelete reports whether the patch deletes the file
+func (p FilePatch) IsDelete() bool {
+	return p.NewPath == DevNull
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// Parse parses a patch in unified diff format or as search/replace blocks:
+//
+//	path/to/file.go
+//	<<<<<<< SEARCH
+//	lines to find
+//	=======
+//	lines to put instead
+//	>>>>>>> REPLACE
+func Parse(text string) ([]FilePatch, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if strings.Contains(text, "<<<<<<< SEARCH") {
+		return parseSearchReplace(text)
+	}
+	return parseUnified(text)
+}
+
+func parseUnified(text string) ([]FilePatch, error) {
+	var patches []FilePatch
+	var current *FilePatch
+	var hunk *Hunk
+
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			patches = append(patches, FilePatch{
+				OldPath: diffPath(line[4:]),
+				NewPath: diffPath(lines[i+1][4:]),
+			})
+			current = &patches[len(patches)-1]
+			hunk = nil
+			i++
+		case strings.HasPrefix(line, "@@"):
+			if current == nil {
+				return nil, fmt.Errorf("line %d: hunk without a ---/+++ file header", i+1)
+			}
+			h := Hunk{}
+			if m := hunkHeader.FindStringSubmatch(line); m != nil {
+				h.OldStart, _ = strconv.Atoi(m[1])
+			}
+			current.Hunks = append(current.Hunks, h)
+			hunk = &current.Hunks[len(current.Hunks)-1]
+		case hunk != nil && strings.HasPrefix(line, "+"):
+			hunk.Lines = append(hunk.Lines, Line{Add, line[1:]})
+		case hunk != nil && strings.HasPrefix(line, "-"):
+			hunk.Lines = append(hunk.Lines, Line{Remove, line[1:]})
+		case hunk != nil && strings.HasPrefix(line, " "):
+			hunk.Lines = append(hunk.Lines, Line{Context, line[1:]})
+		case hunk != nil && line == "" && i < len(lines)-1:
+			// Editors and models often strip the space of empty context lines
+			hunk.Lines = append(hunk.Lines, Line{Context, ""})
+		case strings.HasPrefix(line, `\ No newline`):
+		default:
+			// Anything else (diff --git, index, commentary) ends the hunk
+			hunk = nil
+		}
+	}
+
+	var result []FilePatch
+	index := make(map[string]int)
+	for _, p := range patches {
+		// Trailing empty context lines are usually the end of the text
+		for i := range p.Hunks {
+			p.Hunks[i].Lines = trimTrailingEmptyContext(p.Hunks[i].Lines)
+		}
+		if len(p.Hunks) == 0 && !p.IsDelete() {
+			continue
+		}
+		// Sections for the same file are applied together, like the hunks
+		// of one section
+		n, ok := index[p.Path()]
+		if !ok {
+			index[p.Path()] = len(result)
+			result = append(result, p)
+			continue
+		}
+		if result[n].OldPath != p.OldPath || result[n].NewPath != p.NewPath {
+			return nil, fmt.Errorf("%s has more than one section and they don't agree on creating, deleting or renaming it", p.Path())
+		}
+		result[n].Hunks = append(result[n].Hunks, p.Hunks...)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no file changes found; expected a unified diff (---/+++ headers and @@ hunks) or SEARCH/REPLACE blocks")
+	}
+	return result, nil
+}
+
+func trimTrailingEmptyContext(lines []Line) []Line {
+	for len(lines) > 0 && lines[len(lines)-1] == (Line{Context, ""}) {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffPath strips the timestamp and the a/ or b/ prefix from a file header
+func diffPath(s string) string {
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	if s == DevNull {
+		return s
+	}
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		s = s[2:]
+	}
+	return s
+}
+
+func parseSearchReplace(text string) ([]FilePatch, error) {
+	var patches []FilePatch
+	index := make(map[string]int)
+
+	lines := strings.Split(text, "\n")
+	path := ""
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(trimmed, "<<<<<<< SEARCH") {
+			if trimmed != "" && !strings.HasPrefix(trimmed, "```") {
+				path = strings.Trim(trimmed, "`*: ")
+			}
+			continue
+		}
+		if path == "" {
+			return nil, fmt.Errorf("line %d: SEARCH block without a file path on the line before it", i+1)
+		}
+
+		var search, replace []string
+		section := &search
+		end := -1
+		for j := i + 1; j < len(lines); j++ {
+			t := strings.TrimSpace(lines[j])
+			if strings.HasPrefix(t, "=======") && section == &search {
+				section = &replace
+				continue
+			}
+			if strings.HasPrefix(t, ">>>>>>> REPLACE") {
+				end = j
+				break
+			}
+			*section = append(*section, lines[j])
+		}
+		if end < 0 || section != &replace {
+			return nil, fmt.Errorf("line %d: SEARCH block for %s is not closed with ======= and >>>>>>> REPLACE", i+1, path)
+		}
+
+		hunk := Hunk{}
+		for _, l := range search {
+			hunk.Lines = append(hunk.Lines, Line{Remove, l})
+		}
+		for _, l := range replace {
+			hunk.Lines = append(hunk.Lines, Line{Add, l})
+		}
+
+		n, ok := index[path]
+		if !ok {
+			patches = append(patches, FilePatch{OldPath: path, NewPath: path})
+			n = len(patches) - 1
+			index[path] = n
+			if len(search) == 0 {
+				// An empty search creates the file
+				patches[n].OldPath = DevNull
+			}
+		}
+		patches[n].Hunks = append(patches[n].Hunks, hunk)
+		i = end
+	}
+
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no SEARCH/REPLACE blocks found")
+	}
+	return patches, nil
+}
+
+// HunkResult reports how one hunk was applied
+type HunkResult struct {
+	Applied bool
+	Line    int    // 1-based line in the original file where it applied
+	Note    string // how it matched, or why it failed
+}
+
+// Apply applies the hunks to content. Hunks that can't be placed are
+// skipped and reported; the others are applied.
+func Apply(content string, hunks []Hunk) (string, []HunkResult) {
+	trailingNewline := content == "" || strings.HasSuffix(content, "\n")
+	var lines []string
+	if content != "" {
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+
+	results := make([]HunkResult, len(hunks))
+	offset := 0 // lines added minus removed by earlier hunks
+	for i, hunk := range hunks {
+		hint := -1
+		if hunk.OldStart > 0 {
+			hint = hunk.OldStart - 1 + offset
+		}
+
+		pos, matched, note, err := locate(lines, hunk, hint)
+		if err != nil {
+			results[i] = HunkResult{Note: err.Error()}
+			continue
+		}
+
+		var replacement []string
+		m := 0
+		for _, l := range matched.Lines {
+			switch l.Op {
+			case Context:
+				// Keep the file's own text of context lines
+				replacement = append(replacement, lines[pos+m])
+				m++
+			case Remove:
+				m++
+			case Add:
+				replacement = append(replacement, l.Text)
+			}
+		}
+
+		results[i] = HunkResult{Applied: true, Line: pos - offset + 1, Note: note}
+		lines = append(lines[:pos], append(replacement, lines[pos+m:]...)...)
+		offset += len(replacement) - m
+	}
+
+	result := strings.Join(lines, "\n")
+	if trailingNewline && len(lines) > 0 {
+		result += "\n"
+	}
+	return result, results
+}
+
+// locate finds where a hunk applies, trying an exact match first and then
+// looser ones: ignoring whitespace, then with fewer context lines. It
+// returns the position and the hunk as matched (possibly with context
+// trimmed).
+func locate(lines []string, hunk Hunk, hint int) (int, Hunk, string, error) {
+	old := hunk.old()
+	if len(old) == 0 {
+		// Pure insertion: at the hinted line, or at the end
+		pos := len(lines)
+		if hint >= 0 && hint <= len(lines) {
+			pos = hint
+			if hunk.OldStart > 0 {
+				// "@@ -n,0" inserts after line n
+				pos = hint + 1
+				if pos > len(lines) {
+					pos = len(lines)
+				}
+			}
+		}
+		return pos, hunk, "", nil
+	}
+
+	strategies := []struct {
+		note  string
+		equal func(a, b string) bool
+	}{
+		{"", func(a, b string) bool { return a == b }},
+		{"ignoring trailing whitespace", func(a, b string) bool {
+			return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t")
+		}},
+		{"ignoring whitespace", func(a, b string) bool {
+			return strings.Join(strings.Fields(a), " ") == strings.Join(strings.Fields(b), " ")
+		}},
+	}
+
+	// Fuzz: drop up to two context lines from each end, like patch(1)
+	for fuzz := 0; fuzz <= 2; fuzz++ {
+		trimmed, dropped, ok := trimContext(hunk, fuzz)
+		if !ok {
+			break
+		}
+		for _, s := range strategies {
+			positions := find(lines, trimmed.old(), s.equal)
+			if len(positions) == 0 {
+				continue
+			}
+
+			pos := positions[0]
+			if len(positions) > 1 {
+				if hint < 0 {
+					return 0, Hunk{}, "", fmt.Errorf("the lines to replace appear %d times; include more surrounding lines to make them unique", len(positions))
+				}
+				pos = nearest(positions, hint+dropped)
+			}
+
+			var notes []string
+			if s.note != "" {
+				notes = append(notes, s.note)
+			}
+			if fuzz > 0 {
+				notes = append(notes, fmt.Sprintf("with fuzz %d", fuzz))
+			}
+			if hint >= 0 && pos != hint+dropped {
+				notes = append(notes, fmt.Sprintf("offset %+d lines", pos-hint-dropped))
+			}
+			return pos, trimmed, strings.Join(notes, ", "), nil
+		}
+	}
+
+	return 0, Hunk{}, "", fmt.Errorf("could not find the lines to replace, starting with %q", firstText(old))
+}
+
+// trimContext drops up to fuzz leading and trailing context lines. dropped
+// is how many leading lines were dropped. ok is false if the hunk doesn't
+// have that much context to drop.
+func trimContext(h Hunk, fuzz int) (Hunk, int, bool) {
+	if fuzz == 0 {
+		return h, 0, true
+	}
+	lines := h.Lines
+	dropped := 0
+	for dropped < fuzz && len(lines) > 0 && lines[0].Op == Context {
+		lines = lines[1:]
+		dropped++
+	}
+	trailing := 0
+	for trailing < fuzz && len(lines) > 0 && lines[len(lines)-1].Op == Context {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+	if dropped < fuzz && trailing < fuzz {
+		// Nothing more to drop than at the previous level
+		return Hunk{}, 0, false
+	}
+	for _, l := range lines {
+		if l.Op == Remove {
+			return Hunk{OldStart: h.OldStart, Lines: lines}, dropped, true
+		}
+	}
+	// Without the context only insertions are left; their place is lost
+	return Hunk{}, 0, false
+}
+
+// find returns every position where want starts in lines
+func find(lines []string, want []Line, equal func(a, b string) bool) []int {
+	var positions []int
+	for pos := 0; pos+len(want) <= len(lines); pos++ {
+		match := true
+		for i, w := range want {
+			if !equal(lines[pos+i], w.Text) {
+				match = false
+				break
+			}
+		}
+		if match {
+			positions = append(positions, pos)
+		}
+	}
+	return positions
+}
+
+func nearest(positions []int, target int) int {
+	best := positions[0]
+	for _, p := range positions[1:] {
+		if abs(p-target) < abs(best-target) {
+			best = p
+		}
+	}
+	return best
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func firstText(lines []Line) string {
+	for _, l := range lines {
+		if strings.TrimSpace(l.Text) != "" {
+			return l.Text
+		}
+	}
+	return ""
+}
@@ -0,0 +1,239 @@
+package patch
+
+import (
+	"strings"
+	"testing"
+)
+
+const original = `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("hello")
+}
+
+func other() {
+	return
+}
+`
+
+func TestParseUnified(t *testing.T) {
+	text := `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -5,3 +5,3 @@ import "fmt"
+ func main() {
+-	fmt.Println("hello")
++	fmt.Println("bye")
+ }
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1,2 @@
++one
++two
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-gone
+`
+	patches, err := Parse(text)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(patches) != 3 {
+		t.Fatalf("got %d file patches, want 3", len(patches))
+	}
+	if p := patches[0]; p.Path() != "main.go" || len(p.Hunks) != 1 || p.Hunks[0].OldStart != 5 || len(p.Hunks[0].Lines) != 4 {
+		t.Errorf("patch 0 = %+v", p)
+	}
+	if !patches[1].IsNew() || patches[1].Path() != "new.txt" {
+		t.Errorf("patch 1 = %+v, want a new file", patches[1])
+	}
+	if !patches[2].IsDelete() || patches[2].Path() != "old.txt" {
+		t.Errorf("patch 2 = %+v, want a deletion", patches[2])
+	}
+}
+
+func TestParseUnifiedMergesSections(t *testing.T) {
+	text := "--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-one\n+uno\n" +
+		"--- a/other.go\n+++ b/other.go\n@@ -1 +1 @@\n-x\n+y\n" +
+		"--- a/main.go\n+++ b/main.go\n@@ -3 +3 @@\n-three\n+tres\n"
+	patches, err := Parse(text)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(patches) != 2 || patches[0].Path() != "main.go" || len(patches[0].Hunks) != 2 {
+		t.Fatalf("patches = %+v, want both main.go sections in one patch", patches)
+	}
+	got, results := Apply("one\ntwo\nthree\n", patches[0].Hunks)
+	if got != "uno\ntwo\ntres\n" || !results[0].Applied || !results[1].Applied {
+		t.Errorf("applied = %q, %+v", got, results)
+	}
+
+	conflict := "--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-one\n+uno\n" +
+		"--- a/main.go\n+++ /dev/null\n@@ -1 +0,0 @@\n-uno\n"
+	if _, err := Parse(conflict); err == nil {
+		t.Error("expected an error for sections that both change and delete a file")
+	}
+}
+
+func TestParseSearchReplace(t *testing.T) {
+	text := "main.go\n```go\n<<<<<<< SEARCH\n\tfmt.Println(\"hello\")\n=======\n\tfmt.Println(\"bye\")\n>>>>>>> REPLACE\n```\n\n" +
+		"main.go\n<<<<<<< SEARCH\n\treturn\n=======\n\treturn\n>>>>>>> REPLACE\n\n" +
+		"docs/new.md\n<<<<<<< SEARCH\n=======\n# New\n>>>>>>> REPLACE\n"
+	patches, err := Parse(text)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(patches) != 2 {
+		t.Fatalf("got %d file patches, want 2", len(patches))
+	}
+	if patches[0].Path() != "main.go" || len(patches[0].Hunks) != 2 {
+		t.Errorf("patch 0 = %+v, want two hunks for main.go", patches[0])
+	}
+	if !patches[1].IsNew() || patches[1].Path() != "docs/new.md" {
+		t.Errorf("patch 1 = %+v, want a new file", patches[1])
+	}
+
+	if _, err := Parse("<<<<<<< SEARCH\nx\n=======\ny\n"); err == nil {
+		t.Error("expected an error for an unterminated block")
+	}
+	if _, err := Parse("just some text"); err == nil {
+		t.Error("expected an error for text without changes")
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		hunk     Hunk
+		want     string // replaces "hello" in the original, or "" if it fails
+		wantLine int
+		wantNote string
+	}{
+		{
+			name: "exact",
+			hunk: Hunk{OldStart: 5, Lines: []Line{
+				{Context, "func main() {"},
+				{Remove, "\tfmt.Println(\"hello\")"},
+				{Add, "\tfmt.Println(\"bye\")"},
+				{Context, "}"},
+			}},
+			want:     "bye",
+			wantLine: 5,
+		},
+		{
+			name: "offset",
+			hunk: Hunk{OldStart: 1, Lines: []Line{
+				{Context, "func main() {"},
+				{Remove, "\tfmt.Println(\"hello\")"},
+				{Add, "\tfmt.Println(\"bye\")"},
+			}},
+			want:     "bye",
+			wantLine: 5,
+			wantNote: "offset +4 lines",
+		},
+		{
+			name: "whitespace",
+			hunk: Hunk{Lines: []Line{
+				{Remove, "    fmt.Println(\"hello\")  "},
+				{Add, "\tfmt.Println(\"bye\")"},
+			}},
+			want:     "bye",
+			wantLine: 6,
+			wantNote: "ignoring whitespace",
+		},
+		{
+			name: "fuzz",
+			hunk: Hunk{OldStart: 5, Lines: []Line{
+				{Context, "func mian() {"},
+				{Remove, "\tfmt.Println(\"hello\")"},
+				{Add, "\tfmt.Println(\"bye\")"},
+				{Context, "}"},
+			}},
+			want:     "bye",
+			wantLine: 6,
+			wantNote: "with fuzz 1",
+		},
+		{
+			name: "missing",
+			hunk: Hunk{Lines: []Line{
+				{Remove, "\tfmt.Println(\"goodbye\")"},
+				{Add, "\tfmt.Println(\"bye\")"},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, results := Apply(original, []Hunk{tt.hunk})
+			r := results[0]
+			if tt.want == "" {
+				if r.Applied || got != original {
+					t.Errorf("hunk applied, want a failure; result %+v", r)
+				}
+				if r.Note == "" {
+					t.Error("failure has no reason")
+				}
+				return
+			}
+			if !r.Applied {
+				t.Fatalf("hunk failed: %s", r.Note)
+			}
+			if want := strings.Replace(original, "hello", tt.want, 1); got != want {
+				t.Errorf("content =\n%s\nwant\n%s", got, want)
+			}
+			if r.Line != tt.wantLine || r.Note != tt.wantNote {
+				t.Errorf("result = line %d %q, want line %d %q", r.Line, r.Note, tt.wantLine, tt.wantNote)
+			}
+		})
+	}
+}
+
+func TestApplyMultipleHunks(t *testing.T) {
+	patches, err := Parse(`--- a/main.go
++++ b/main.go
+@@ -1,3 +1,4 @@
+ package main
+
++// Package comment
+ import "fmt"
+@@ -9,3 +10,3 @@ func main() {
+ func other() {
+-	return
++	panic("no")
+ }
+@@ -20,1 +21,1 @@
+-not in the file
++anything
+`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	got, results := Apply(original, patches[0].Hunks)
+	if !results[0].Applied || !results[1].Applied || results[2].Applied {
+		t.Fatalf("results = %+v, want the first two applied", results)
+	}
+	if results[1].Line != 9 || results[1].Note != "" {
+		t.Errorf("hunk 2 = %+v, want line 9 without a note", results[1])
+	}
+	if !strings.Contains(got, "\n// Package comment\nimport") || !strings.Contains(got, `panic("no")`) {
+		t.Errorf("content =\n%s", got)
+	}
+}
+
+func TestApplyAmbiguous(t *testing.T) {
+	content := "a\nx\nb\nx\n"
+	hunk := Hunk{Lines: []Line{{Remove, "x"}, {Add, "y"}}}
+
+	if _, results := Apply(content, []Hunk{hunk}); results[0].Applied {
+		t.Error("ambiguous hunk without a line number applied")
+	}
+
+	hunk.OldStart = 4
+	got, results := Apply(content, []Hunk{hunk})
+	if !results[0].Applied || got != "a\nx\nb\ny\n" {
+		t.Errorf("got %q, %+v; want the match nearest line 4 replaced", got, results[0])
+	}
+}
@@ -0,0 +1,335 @@
+package permission
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Mode controls which tool calls run without asking
+type Mode string
+
+const (
+	ModeAsk      Mode = "ask"       // ask before every tool call
+	ModeAutoRead Mode = "auto-read" // run read-only tools, ask for everything else
+	ModeAllowAll Mode = "allow-all" // run everything that isn't denied by a rule
+)
+
+// Modes lists the valid modes
+var Modes = []Mode{ModeAsk, ModeAutoRead, ModeAllowAll}
+
+// ParseMode validates a mode name
+func ParseMode(s string) (Mode, error) {
+	for _, mode := range Modes {
+		if string(mode) == s {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("unknown permission mode '%s' (use ask, auto-read or allow-all)", s)
+}
+
+// Decision is the outcome of checking a tool call
+type Decision int
+
+const (
+	Ask Decision = iota
+	Allow
+	Deny
+)
+
+// Rule matches tool calls by tool name and, optionally, a pattern for the
+// call's subject (the command for bash, the path for file tools). In the
+// pattern '*' matches any text, and a trailing " *" also matches nothing,
+// so "go test *" matches both "go test" and "go test ./...".
+type Rule struct {
+	Tool    string
+	Pattern string // empty matches any call of the tool
+}
+
+// ParseRule parses rules such as "read", "bash(go test *)" or "write(docs/*)"
+func ParseRule(s string) (Rule, error) {
+	s = strings.TrimSpace(s)
+	open := strings.Index(s, "(")
+	if open < 0 {
+		if s == "" || strings.ContainsAny(s, ") ") {
+			return Rule{}, fmt.Errorf("invalid rule '%s'", s)
+		}
+		return Rule{Tool: s}, nil
+	}
+	if open == 0 || !strings.HasSuffix(s, ")") {
+		return Rule{}, fmt.Errorf("invalid rule '%s' (expected tool or tool(pattern))", s)
+	}
+	return Rule{Tool: strings.TrimSpace(s[:open]), Pattern: s[open+1 : len(s)-1]}, nil
+}
+
+// String formats the rule the way ParseRule reads it
+func (r Rule) String() string {
+	if r.Pattern == "" {
+		return r.Tool
+	}
+	return r.Tool + "(" + r.Pattern + ")"
+}
+
+// Matches reports whether the rule applies to a call of tool with subject
+func (r Rule) Matches(tool, subject string) bool {
+	if !match(r.Tool, tool) {
+		return false
+	}
+	if r.Pattern == "" {
+		return true
+	}
+	subject = strings.TrimSpace(subject)
+	if match(r.Pattern, subject) {
+		return true
+	}
+	return strings.HasSuffix(r.Pattern, " *") && match(strings.TrimSuffix(r.Pattern, " *"), subject)
+}
+
+// match reports whether s matches pattern, where '*' matches any text
+func match(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
+
+// Policy decides whether tool calls may run
+type Policy struct {
+	Mode  Mode
+	Allow []Rule
+	Deny  []Rule
+
+	// ProjectDeny holds the deny rules of the project's permissions file;
+	// they are never saved to the user's file
+	ProjectDeny []Rule
+
+	path        string
+	projectPath string
+	fileMode    Mode // mode stored in the file, kept when saving a -permission-mode override
+}
+
+// fileFormat is the JSON layout of the permissions file
+type fileFormat struct {
+	Mode  Mode     `json:"mode,omitempty"`
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// ProjectPath is the permissions file a project can ship, relative to the
+// current directory. See AddProject for what it may do.
+var ProjectPath = filepath.Join(".bitca", "permissions.json")
+
+// DefaultPath returns the user's permissions file:
+// $XDG_CONFIG_HOME/bitca/permissions.json (~/.config/bitca/permissions.json)
+func DefaultPath() string {
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		return filepath.Join(configHome, "bitca", "permissions.json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "bitca", "permissions.json")
+}
+
+// Load reads a policy from path. A missing file yields the default policy
+// (auto-read, no rules), which is saved to path when a rule is added.
+func Load(path string) (*Policy, error) {
+	policy := &Policy{Mode: ModeAutoRead, path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return policy, nil
+		}
+		return nil, err
+	}
+
+	var file fileFormat
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	if file.Mode != "" {
+		mode, err := ParseMode(string(file.Mode))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		policy.Mode = mode
+		policy.fileMode = mode
+	}
+	if policy.Allow, err = parseRules(file.Allow); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if policy.Deny, err = parseRules(file.Deny); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return policy, nil
+}
+
+// AddProject applies a project's permissions file at path on top of the
+// policy. A cloned repository can't be trusted, so the file can only
+// restrict: its deny rules are added and a stricter mode is used, while its
+// allow rules and a looser mode are ignored. A missing file changes nothing.
+func (p *Policy) AddProject(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	project, err := Load(path)
+	if err != nil {
+		return err
+	}
+
+	p.projectPath = path
+	p.ProjectDeny = project.Deny
+	if project.fileMode != "" && strictness(project.fileMode) < strictness(p.Mode) {
+		p.Mode = project.fileMode
+	}
+	return nil
+}
+
+// strictness orders modes from the one that asks most
+func strictness(mode Mode) int {
+	for i, m := range Modes {
+		if m == mode {
+			return i
+		}
+	}
+	return len(Modes)
+}
+
+func parseRules(specs []string) ([]Rule, error) {
+	var rules []Rule
+	for _, spec := range specs {
+		rule, err := ParseRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Path returns the file the policy is loaded from and saved to
+func (p *Policy) Path() string {
+	return p.path
+}
+
+// ProjectPath returns the project's permissions file, or "" if there is none
+func (p *Policy) ProjectPath() string {
+	return p.projectPath
+}
+
+// Check decides whether a call of tool with subject may run. Deny rules win
+// over allow rules, which win over the mode. The matching rule is returned
+// when a rule decided.
+func (p *Policy) Check(tool, subject string, readOnly bool) (Decision, *Rule) {
+	for i := range p.ProjectDeny {
+		if p.ProjectDeny[i].Matches(tool, subject) {
+			return Deny, &p.ProjectDeny[i]
+		}
+	}
+	for i := range p.Deny {
+		if p.Deny[i].Matches(tool, subject) {
+			return Deny, &p.Deny[i]
+		}
+	}
+	for i := range p.Allow {
+		if p.Allow[i].Matches(tool, subject) {
+			return Allow, &p.Allow[i]
+		}
+	}
+
+	switch {
+	case p.Mode == ModeAllowAll:
+		return Allow, nil
+	case p.Mode == ModeAutoRead && readOnly:
+		return Allow, nil
+	default:
+		return Ask, nil
+	}
+}
+
+// AddAllow adds an allow rule and saves the policy
+func (p *Policy) AddAllow(rule Rule) error {
+	p.Allow = addRule(p.Allow, rule)
+	return p.Save()
+}
+
+// AddDeny adds a deny rule and saves the policy
+func (p *Policy) AddDeny(rule Rule) error {
+	p.Deny = addRule(p.Deny, rule)
+	return p.Save()
+}
+
+// Remove deletes a rule from the allow and deny lists and saves the policy.
+// It reports whether the rule existed.
+func (p *Policy) Remove(rule Rule) (bool, error) {
+	var found bool
+	p.Allow, found = removeRule(p.Allow, rule)
+	var foundDeny bool
+	p.Deny, foundDeny = removeRule(p.Deny, rule)
+	if !found && !foundDeny {
+		return false, nil
+	}
+	return true, p.Save()
+}
+
+func removeRule(rules []Rule, rule Rule) ([]Rule, bool) {
+	for i, r := range rules {
+		if r == rule {
+			return append(rules[:i:i], rules[i+1:]...), true
+		}
+	}
+	return rules, false
+}
+
+func addRule(rules []Rule, rule Rule) []Rule {
+	for _, r := range rules {
+		if r == rule {
+			return rules
+		}
+	}
+	return append(rules, rule)
+}
+
+// Save writes the rules to the policy file, creating it if needed
+func (p *Policy) Save() error {
+	if p.path == "" {
+		return fmt.Errorf("no permissions file")
+	}
+
+	file := fileFormat{Mode: p.fileMode}
+	for _, rule := range p.Allow {
+		file.Allow = append(file.Allow, rule.String())
+	}
+	for _, rule := range p.Deny {
+		file.Deny = append(file.Deny, rule.String())
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(p.path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to save permissions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package permission
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRuleMatches(t *testing.T) {
+	tests := []struct {
+		rule    string
+		tool    string
+		subject string
+		want    bool
+	}{
+		{"read", "read", "/etc/passwd", true},
+		{"read", "write", "main.go", false},
+		{"bash(go test *)", "bash", "go test ./...", true},
+		{"bash(go test *)", "bash", "go test", true},
+		{"bash(go test *)", "bash", "go testify", false},
+		{"bash(go test *)", "bash", "go build ./...", false},
+		{"bash(git * --dry-run)", "bash", "git clean -fd --dry-run", true},
+		{"write(docs/*)", "write", "docs/guide.md", true},
+		{"write(docs/*)", "write", "main.go", false},
+		{"github_*", "github_get_me", "{}", true},
+	}
+
+	for _, tt := range tests {
+		rule, err := ParseRule(tt.rule)
+		if err != nil {
+			t.Fatalf("ParseRule(%q): %v", tt.rule, err)
+		}
+		if rule.String() != tt.rule {
+			t.Errorf("String() = %q, want %q", rule.String(), tt.rule)
+		}
+		if got := rule.Matches(tt.tool, tt.subject); got != tt.want {
+			t.Errorf("%s matches %s(%s) = %v, want %v", tt.rule, tt.tool, tt.subject, got, tt.want)
+		}
+	}
+
+	for _, invalid := range []string{"", "(x)", "bash(go", "two words"} {
+		if _, err := ParseRule(invalid); err == nil {
+			t.Errorf("expected error for rule %q", invalid)
+		}
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	policy := &Policy{
+		Mode:  ModeAutoRead,
+		Allow: []Rule{{Tool: "bash", Pattern: "go *"}},
+		Deny:  []Rule{{Tool: "bash", Pattern: "go clean *"}, {Tool: "read", Pattern: "*.env"}},
+	}
+
+	checks := []struct {
+		tool     string
+		subject  string
+		readOnly bool
+		want     Decision
+	}{
+		{"read", "main.go", true, Allow},
+		{"read", "prod.env", true, Deny},
+		{"write", "main.go", false, Ask},
+		{"bash", "go vet ./...", false, Allow},
+		{"bash", "go clean -cache", false, Deny},
+		{"bash", "rm -rf /", false, Ask},
+	}
+	for _, c := range checks {
+		if got, _ := policy.Check(c.tool, c.subject, c.readOnly); got != c.want {
+			t.Errorf("Check(%s, %s) = %v, want %v", c.tool, c.subject, got, c.want)
+		}
+	}
+
+	policy.Mode = ModeAsk
+	if got, _ := policy.Check("read", "main.go", true); got != Ask {
+		t.Errorf("ask mode should ask for reads, got %v", got)
+	}
+	policy.Mode = ModeAllowAll
+	if got, _ := policy.Check("write", "main.go", false); got != Allow {
+		t.Errorf("allow-all mode should allow writes, got %v", got)
+	}
+	if got, _ := policy.Check("bash", "go clean -cache", false); got != Deny {
+		t.Errorf("deny rules must win in allow-all mode, got %v", got)
+	}
+}
+
+func TestPolicyLoadSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bitca", "permissions.json")
+
+	policy, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load missing file: %v", err)
+	}
+	if policy.Mode != ModeAutoRead || len(policy.Allow) != 0 {
+		t.Errorf("unexpected default policy: %+v", policy)
+	}
+
+	// A command-line override of the mode is not written to the file
+	policy.Mode = ModeAllowAll
+	if err := policy.AddAllow(Rule{Tool: "bash", Pattern: "go test *"}); err != nil {
+		t.Fatalf("AddAllow: %v", err)
+	}
+	if err := policy.AddAllow(Rule{Tool: "bash", Pattern: "go test *"}); err != nil {
+		t.Fatalf("AddAllow duplicate: %v", err)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if reloaded.Mode != ModeAutoRead {
+		t.Errorf("Mode = %s, want %s", reloaded.Mode, ModeAutoRead)
+	}
+	if len(reloaded.Allow) != 1 || reloaded.Allow[0].String() != "bash(go test *)" {
+		t.Errorf("unexpected allow rules: %v", reloaded.Allow)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"mode": "yolo"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestPolicyAddProject(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "permissions.json")
+
+	policy := &Policy{Mode: ModeAutoRead, Allow: []Rule{{Tool: "bash", Pattern: "go test *"}}}
+	if err := policy.AddProject(path); err != nil || policy.ProjectPath() != "" {
+		t.Fatalf("missing project file: %v, path %q", err, policy.ProjectPath())
+	}
+
+	// An untrusted repository can't loosen the user's policy...
+	loose := `{"mode": "allow-all", "allow": ["bash"], "deny": ["bash(curl *)"]}`
+	if err := os.WriteFile(path, []byte(loose), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.AddProject(path); err != nil {
+		t.Fatalf("AddProject: %v", err)
+	}
+	if policy.Mode != ModeAutoRead {
+		t.Errorf("Mode = %s, want the user's %s", policy.Mode, ModeAutoRead)
+	}
+	if decision, _ := policy.Check("bash", "rm -rf ~", false); decision != Ask {
+		t.Errorf("project allow rule was used: %v", decision)
+	}
+	// ...but it can restrict it
+	if decision, _ := policy.Check("bash", "curl example.com", false); decision != Deny {
+		t.Errorf("project deny rule not used: %v", decision)
+	}
+
+	strict := `{"mode": "ask", "deny": ["bash(go test *)"]}`
+	if err := os.WriteFile(path, []byte(strict), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.AddProject(path); err != nil {
+		t.Fatalf("AddProject: %v", err)
+	}
+	if policy.Mode != ModeAsk {
+		t.Errorf("Mode = %s, want the project's stricter %s", policy.Mode, ModeAsk)
+	}
+	if decision, _ := policy.Check("bash", "go test ./...", false); decision != Deny {
+		t.Errorf("project deny rule lost to the user's allow rule: %v", decision)
+	}
+
+	// Project rules are not saved to the user's file
+	policy.path = filepath.Join(dir, "user.json")
+	if err := policy.Save(); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := Load(policy.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Deny) != 0 {
+		t.Errorf("project rules saved: %v", saved.Deny)
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gotha/bitca/backend"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+const (
+	// readDefaultLimit is how many lines read returns unless the call sets
+	// a limit
+	readDefaultLimit = 2000
+
+	// readMaxLineLength is where read cuts long lines, such as minified code
+	readMaxLineLength = 2000
+
+	// readCountLimit is how far past the lines it returns read looks to
+	// count the rest of the file
+	readCountLimit = 4 << 20
+
+	// maxImageSize is the largest image read attaches; the APIs reject
+	// bigger ones
+	maxImageSize = 5 << 20
+)
+
+// imageTypes are the image formats the vision APIs accept
+var imageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+func toolRead(args map[string]interface{}) (string, error) {
+	result, _, err := readFile(args)
+	return result, err
+}
+
+// readFile reads the file a read call names: its lines, numbered, or with
+// -read-images a short description and the image itself for images
+func readFile(args map[string]interface{}) (string, []backend.Image, error) {
+	path, ok := args["path"].(string)
+	if !ok {
+		return "", nil, fmt.Errorf("path must be a string")
+	}
+
+	// Truncated tool results saved outside the workspace can be read too
+	if !isSpillFile(path) {
+		var err error
+		if path, err = resolvePath(path); err != nil {
+			return "", nil, err
+		}
+	}
+
+	offset := 0
+	if o, ok := args["offset"].(float64); ok && o > 0 {
+		offset = int(o)
+	}
+	limit := readDefaultLimit
+	if l, ok := args["limit"].(float64); ok && l > 0 {
+		limit = int(l)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", nil, err
+	}
+	if info.IsDir() {
+		return "", nil, fmt.Errorf("%s is a directory; use glob to list it", path)
+	}
+
+	// Only the start of the file decides how to read it; the rest is
+	// streamed, so large files are never loaded whole
+	r := bufio.NewReaderSize(f, 64*1024)
+	head, _ := r.Peek(binarySniffLength)
+
+	contentType := http.DetectContentType(head)
+	if imageTypes[contentType] {
+		return readImage(path, contentType, info.Size())
+	}
+	decoder, encoding := textDecoder(head)
+	if decoder == nil && isBinary(head) {
+		return fmt.Sprintf("%s is a binary file (%s, %d bytes) and can't be shown as text", path, contentType, info.Size()), nil, nil
+	}
+
+	var src io.Reader = r
+	if decoder != nil {
+		src = transform.NewReader(r, decoder)
+	}
+	result, err := readLines(bufio.NewReaderSize(src, 64*1024), offset, limit)
+	if err != nil {
+		return "", nil, err
+	}
+	if encoding != "" {
+		result = addNote(result, "decoded from "+encoding)
+	}
+	return result, nil, nil
+}
+
+// readImage describes an image file, and attaches it when images are
+// turned on
+func readImage(path, mediaType string, size int64) (string, []backend.Image, error) {
+	desc := fmt.Sprintf("%s is an image (%s, %d bytes)", path, mediaType, size)
+	switch {
+	case !config.ReadImages:
+		return desc + "; start bitca with -read-images to show images to models that can see them", nil, nil
+	case size > maxImageSize:
+		return fmt.Sprintf("%s, too large to attach (at most %d MB)", desc, maxImageSize>>20), nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	return desc + "; it is attached", []backend.Image{{MediaType: mediaType, Data: data}}, nil
+}
+
+// textDecoder picks the decoder for a text file from its first bytes: none
+// for UTF-8, which is read as is, and a named one for other encodings
+func textDecoder(head []byte) (transform.Transformer, string) {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		// Only drops the byte order mark
+		return unicode.UTF8BOM.NewDecoder(), ""
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder(), "UTF-16LE"
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM).NewDecoder(), "UTF-16BE"
+	case !isBinary(head) && !validUTF8Start(head):
+		// The usual encoding of text that isn't UTF-8
+		return charmap.Windows1252.NewDecoder(), "Windows-1252"
+	}
+	return nil, ""
+}
+
+// validUTF8Start reports whether head is valid UTF-8 apart from a character
+// cut off at its end
+func validUTF8Start(head []byte) bool {
+	for cut := 0; cut < utf8.UTFMax && cut <= len(head); cut++ {
+		if utf8.Valid(head[:len(head)-cut]) {
+			return true
+		}
+	}
+	return false
+}
+
+// readLines returns limit lines of r after the first offset, numbered. A
+// note at the end says how to read on when lines follow, and about CRLF
+// line endings and lines cut at readMaxLineLength.
+func readLines(r *bufio.Reader, offset, limit int) (string, error) {
+	var b strings.Builder
+	var crlf bool
+	var cut int
+	n := 0 // lines read
+	for ; n < offset+limit; n++ {
+		keep := readMaxLineLength
+		if n < offset {
+			keep = 0
+		}
+		line, length, err := readLine(r, keep)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if n < offset {
+			continue
+		}
+
+		if length == len(line) && strings.HasSuffix(line, "\r") {
+			line = line[:len(line)-1]
+			length--
+			crlf = true
+		}
+		fmt.Fprintf(&b, "%4d| %s", n+1, line)
+		if length > len(line) {
+			fmt.Fprintf(&b, " [... %d more bytes]", length-len(line))
+			cut++
+		}
+		b.WriteString("\n")
+	}
+
+	if n <= offset {
+		if n == 0 {
+			return "(empty file)", nil
+		}
+		return fmt.Sprintf("(the file has %d lines; offset %d is past the end)", n, offset), nil
+	}
+
+	result := b.String()
+	if rest, all, err := countLines(r, readCountLimit); err != nil {
+		return "", err
+	} else if !all {
+		result = addNote(result, fmt.Sprintf("showing lines %d-%d; more lines follow, read more with offset %d", offset+1, n, n))
+	} else if rest > 0 {
+		result = addNote(result, fmt.Sprintf("showing lines %d-%d of %d; read more with offset %d", offset+1, n, n+rest, n))
+	}
+	if crlf {
+		result = addNote(result, "the file has CRLF line endings, shown without the CR")
+	}
+	if cut > 0 {
+		result = addNote(result, fmt.Sprintf("%d long lines were cut at %d bytes", cut, readMaxLineLength))
+	}
+	return result, nil
+}
+
+// readLine reads a line, keeping at most keep bytes of it without the
+// newline, and returns them with the length of the whole line. It returns
+// io.EOF only when there is no line left.
+func readLine(r *bufio.Reader, keep int) (string, int, error) {
+	var line []byte
+	length := 0
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if err == nil || (err == io.EOF && len(chunk) > 0) {
+			chunk = bytes.TrimSuffix(chunk, []byte("\n"))
+		}
+		length += len(chunk)
+		if room := keep - len(line); room > 0 {
+			line = append(line, chunk[:min(room, len(chunk))]...)
+		}
+
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && length > 0:
+			err = nil
+		}
+		// Don't leave half a character where the line was cut
+		for i := 0; i < utf8.UTFMax && length > len(line) && len(line) > 0; i++ {
+			if r, size := utf8.DecodeLastRune(line); r != utf8.RuneError || size > 1 {
+				break
+			}
+			line = line[:len(line)-1]
+		}
+		return string(line), length, err
+	}
+}
+
+// countLines counts the lines left in r, reading at most limit bytes. It
+// reports false when it stopped before the end, so the count is incomplete.
+func countLines(r io.Reader, limit int64) (int, bool, error) {
+	buf := make([]byte, 64*1024)
+	count := 0
+	last := byte('\n')
+	var read int64
+	for {
+		if read >= limit {
+			return count, false, nil
+		}
+		n, err := r.Read(buf[:min(int64(len(buf)), limit-read)])
+		if n > 0 {
+			count += bytes.Count(buf[:n], []byte("\n"))
+			last = buf[n-1]
+			read += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, false, err
+		}
+	}
+	// A last line without a newline
+	if last != '\n' {
+		count++
+	}
+	return count, true, nil
+}
+
+// addNote appends a note in parentheses to a tool result
+func addNote(result, note string) string {
+	return strings.TrimRight(result, "\n") + "\n(" + note + ")"
+}
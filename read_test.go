@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gotha/bitca/workspace"
+)
+
+func TestRead(t *testing.T) {
+	dir := t.TempDir()
+	var numbered strings.Builder
+	for i := 1; i <= 2500; i++ {
+		fmt.Fprintf(&numbered, "line %d\n", i)
+	}
+	files := map[string]string{
+		"short.txt":   "one\ntwo\nthree",
+		"long.txt":    numbered.String(),
+		"empty.txt":   "",
+		"crlf.txt":    "one\r\ntwo\r\n",
+		"wide.min.js": "var a=1;x" + strings.Repeat("é", readMaxLineLength) + "\nnext\n",
+		"bom.txt":     "\xEF\xBB\xBFhello\n",
+		"utf16.txt":   "\xFF\xFEh\x00i\x00\n\x00\xAC\x20\n\x00",
+		"latin1.txt":  "caf\xE9 \x80\n",
+		"data.bin":    "\x7FELF\x02\x01\x01\x00\x00\x00",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"short", map[string]interface{}{"path": "short.txt"}, "   1| one\n   2| two\n   3| three\n"},
+		{"offset and limit", map[string]interface{}{"path": "short.txt", "offset": 1.0, "limit": 1.0},
+			"   2| two\n(showing lines 2-2 of 3; read more with offset 2)"},
+		{"default limit", map[string]interface{}{"path": "long.txt"},
+			"   1| line 1\n...\n2000| line 2000\n(showing lines 1-2000 of 2500; read more with offset 2000)"},
+		{"past the end", map[string]interface{}{"path": "short.txt", "offset": 5.0}, "(the file has 3 lines; offset 5 is past the end)"},
+		{"empty", map[string]interface{}{"path": "empty.txt"}, "(empty file)"},
+		{"crlf", map[string]interface{}{"path": "crlf.txt"},
+			"   1| one\n   2| two\n(the file has CRLF line endings, shown without the CR)"},
+		{"long line", map[string]interface{}{"path": "wide.min.js"},
+			// Cut before the é that doesn't fit whole
+			"   1| var a=1;x" + strings.Repeat("é", 995) + " [... 2010 more bytes]\n   2| next\n" +
+				"(1 long lines were cut at 2000 bytes)"},
+		{"utf-8 bom", map[string]interface{}{"path": "bom.txt"}, "   1| hello\n"},
+		{"utf-16", map[string]interface{}{"path": "utf16.txt"}, "   1| hi\n   2| €\n(decoded from UTF-16LE)"},
+		{"windows-1252", map[string]interface{}{"path": "latin1.txt"}, "   1| café €\n(decoded from Windows-1252)"},
+		{"binary", map[string]interface{}{"path": "data.bin"},
+			filepath.Join(dir, "data.bin") + " is a binary file (application/octet-stream, 10 bytes) and can't be shown as text"},
+	}
+
+	ws, err := workspace.New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := toolWorkspace
+	toolWorkspace = ws
+	t.Cleanup(func() { toolWorkspace = saved })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toolRead(tt.args)
+			if err != nil {
+				t.Fatalf("toolRead: %v", err)
+			}
+			// Long results are compared by their ends
+			if head, tail, ok := strings.Cut(tt.want, "...\n"); ok {
+				if !strings.HasPrefix(got, head) || !strings.HasSuffix(got, tail) {
+					t.Errorf("got %q...%q, want %q...%q", got[:min(len(got), 80)], got[max(len(got)-80, 0):], head, tail)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := toolRead(map[string]interface{}{"path": "."}); err == nil || !strings.Contains(err.Error(), "directory") {
+		t.Errorf("expected a directory error, got %v", err)
+	}
+}
+
+func TestReadImage(t *testing.T) {
+	// A 1x1 PNG
+	png, _ := base64.StdEncoding.DecodeString("iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg==")
+	path := filepath.Join(t.TempDir(), "pixel.png")
+	if err := os.WriteFile(path, png, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := config.ReadImages
+	t.Cleanup(func() { config.ReadImages = saved })
+
+	config.ReadImages = false
+	result, images, err := readFile(map[string]interface{}{"path": path})
+	if err != nil || len(images) != 0 || !strings.Contains(result, "is an image (image/png, 70 bytes); start bitca with -read-images") {
+		t.Errorf("without images: %q, %d images, %v", result, len(images), err)
+	}
+
+	config.ReadImages = true
+	result, images, err = readFile(map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != path+" is an image (image/png, 70 bytes); it is attached" {
+		t.Errorf("result = %q", result)
+	}
+	if len(images) != 1 || images[0].MediaType != "image/png" || !bytes.Equal(images[0].Data, png) {
+		t.Errorf("images = %+v", images)
+	}
+}
+
+func TestCountLinesStopsAtLimit(t *testing.T) {
+	text := strings.Repeat("line\n", 100)
+	if count, all, err := countLines(strings.NewReader(text), 1000); err != nil || !all || count != 100 {
+		t.Errorf("whole text: %d lines, all %v, %v", count, all, err)
+	}
+	if count, all, err := countLines(strings.NewReader(text), 50); err != nil || all || count != 10 {
+		t.Errorf("first 50 bytes: %d lines, all %v, %v; want 10 and not all", count, all, err)
+	}
+}
@@ -0,0 +1,334 @@
+package session
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotha/bitca/backend"
+)
+
+// Record types stored in a session file, one JSON object per line
+const (
+	RecordMeta    = "meta"    // first line: session metadata
+	RecordMessage = "message" // a single message appended to the history
+	RecordReplace = "replace" // the history was rewritten (e.g. compacted)
+
+	// Entries of the transcript shown to the user, which holds more than
+	// the history: times, notices, commands and errors
+	RecordEntry      = "entry"      // a single entry appended to the transcript
+	RecordTranscript = "transcript" // the transcript was rewritten (e.g. rewound)
+)
+
+// Meta describes a session
+type Meta struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Cwd     string    `json:"cwd"`
+	Backend string    `json:"backend"`
+	Model   string    `json:"model"`
+}
+
+// Record is a single line in a session file
+type Record struct {
+	Type     string            `json:"type"`
+	Time     time.Time         `json:"time"`
+	Meta     *Meta             `json:"meta,omitempty"`
+	Message  *backend.Message  `json:"message,omitempty"`
+	Messages []backend.Message `json:"messages,omitempty"`
+	Entry    json.RawMessage   `json:"entry,omitempty"`
+	Entries  json.RawMessage   `json:"entries,omitempty"` // a JSON array
+}
+
+// Info summarizes a stored session for listings
+type Info struct {
+	Meta
+	Updated      time.Time
+	MessageCount int
+	Title        string // first user message, shortened
+}
+
+// Store manages session files in a directory
+type Store struct {
+	dir string
+}
+
+// Session is an open session that messages are appended to
+type Session struct {
+	ID   string
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+// DefaultDir returns the default session directory
+// ($XDG_DATA_HOME/bitca/sessions, falling back to ~/.local/share/bitca/sessions)
+func DefaultDir() string {
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		return filepath.Join(dataHome, "bitca", "sessions")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "share", "bitca", "sessions")
+}
+
+// NewStore creates a store in dir, creating the directory if needed
+func NewStore(dir string) (*Store, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("no session directory")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Create starts a new session file; meta.ID and meta.Created are filled in
+func (s *Store) Create(meta Meta) (*Session, error) {
+	meta.ID = newID()
+	meta.Created = time.Now()
+
+	path := filepath.Join(s.dir, meta.ID+".jsonl")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	sess := &Session{ID: meta.ID, path: path, file: file}
+	if err := sess.write(Record{Type: RecordMeta, Time: meta.Created, Meta: &meta}); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return sess, nil
+}
+
+// Open loads a session by ID (or unique ID prefix) and reopens it for
+// appending. It returns the session, its metadata, the message history and
+// the transcript entries, which sessions saved by older versions lack.
+func (s *Store) Open(id string) (*Session, Meta, []backend.Message, []json.RawMessage, error) {
+	path, err := s.resolve(id)
+	if err != nil {
+		return nil, Meta{}, nil, nil, err
+	}
+
+	contents, err := readFile(path)
+	if err != nil {
+		return nil, Meta{}, nil, nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, Meta{}, nil, nil, fmt.Errorf("failed to open session: %w", err)
+	}
+
+	sess := &Session{ID: contents.meta.ID, path: path, file: file}
+	return sess, contents.meta, contents.messages, contents.transcript, nil
+}
+
+// List returns all sessions, most recently updated first
+func (s *Store) List() ([]Info, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []Info
+	for _, path := range paths {
+		contents, err := readFile(path)
+		if err != nil {
+			continue // Skip unreadable or corrupt sessions
+		}
+		info := Info{Meta: contents.meta, Updated: contents.updated, MessageCount: len(contents.messages)}
+		for _, msg := range contents.messages {
+			if msg.Role == "user" {
+				info.Title = shorten(msg.Content, 60)
+				break
+			}
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Updated.After(infos[j].Updated)
+	})
+	return infos, nil
+}
+
+// Latest returns the most recently updated session started in cwd
+func (s *Store) Latest(cwd string) (Info, error) {
+	infos, err := s.List()
+	if err != nil {
+		return Info{}, err
+	}
+	for _, info := range infos {
+		if info.Cwd == cwd {
+			return info, nil
+		}
+	}
+	return Info{}, fmt.Errorf("no previous session in %s", cwd)
+}
+
+// resolve finds the session file for an ID or unique ID prefix
+func (s *Store) resolve(id string) (string, error) {
+	id = strings.TrimSuffix(id, ".jsonl")
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return "", fmt.Errorf("invalid session ID '%s'", id)
+	}
+
+	exact := filepath.Join(s.dir, id+".jsonl")
+	if _, err := os.Stat(exact); err == nil {
+		return exact, nil
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(s.dir, id+"*.jsonl"))
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("session '%s' not found", id)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("session ID '%s' is ambiguous (%d matches)", id, len(matches))
+	}
+}
+
+// Append writes messages to the session
+func (s *Session) Append(messages ...backend.Message) error {
+	now := time.Now()
+	for i := range messages {
+		if err := s.write(Record{Type: RecordMessage, Time: now, Message: &messages[i]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replace records that the whole history was rewritten
+func (s *Session) Replace(messages []backend.Message) error {
+	return s.write(Record{Type: RecordReplace, Time: time.Now(), Messages: messages})
+}
+
+// AppendEntry writes a transcript entry, encoded as JSON, to the session
+func (s *Session) AppendEntry(entry any) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode transcript entry: %w", err)
+	}
+	return s.write(Record{Type: RecordEntry, Time: time.Now(), Entry: data})
+}
+
+// ReplaceTranscript records that the whole transcript was rewritten to
+// entries, a slice encoded as a JSON array
+func (s *Session) ReplaceTranscript(entries any) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode transcript: %w", err)
+	}
+	return s.write(Record{Type: RecordTranscript, Time: time.Now(), Entries: data})
+}
+
+// Close closes the session file
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+func (s *Session) write(rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode session record: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	return nil
+}
+
+// contents is what a session file holds once its records are replayed
+type contents struct {
+	meta       Meta
+	messages   []backend.Message
+	transcript []json.RawMessage
+	updated    time.Time // time of the last record
+}
+
+// readFile replays a session file into its metadata, the current message
+// history and transcript, and the time of the last record
+func readFile(path string) (contents, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return contents{}, err
+	}
+	defer file.Close()
+
+	var c contents
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue // A partially written last line must not lose the session
+		}
+		switch rec.Type {
+		case RecordMeta:
+			if rec.Meta != nil {
+				c.meta = *rec.Meta
+			}
+		case RecordMessage:
+			if rec.Message != nil {
+				c.messages = append(c.messages, *rec.Message)
+			}
+		case RecordReplace:
+			c.messages = append([]backend.Message(nil), rec.Messages...)
+		case RecordEntry:
+			if rec.Entry != nil {
+				c.transcript = append(c.transcript, rec.Entry)
+			}
+		case RecordTranscript:
+			var entries []json.RawMessage
+			if err := json.Unmarshal(rec.Entries, &entries); err != nil {
+				continue
+			}
+			c.transcript = entries
+		}
+		c.updated = rec.Time
+	}
+	if err := scanner.Err(); err != nil {
+		return contents{}, fmt.Errorf("failed to read session: %w", err)
+	}
+
+	if c.meta.ID == "" {
+		return contents{}, fmt.Errorf("%s is not a session file", filepath.Base(path))
+	}
+	return c, nil
+}
+
+// newID returns a sortable, unique session ID such as 20260102-150405-a1b2
+func newID() string {
+	b := make([]byte, 2)
+	rand.Read(b)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// shorten collapses whitespace and truncates s to max runes
+func shorten(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
@@ -0,0 +1,142 @@
+package session
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gotha/bitca/backend"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	sess, err := store.Create(Meta{Cwd: "/work", Backend: "ollama", Model: "llama3.1:8b"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	history := []backend.Message{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "why does the build fail?"},
+		{Role: "assistant", ToolCalls: []backend.ToolCall{
+			{ID: "call_1", Name: "bash", Arguments: map[string]interface{}{"cmd": "go build ./..."}},
+		}},
+		{Role: "tool", ToolCallID: "call_1", Content: "undefined: foo"},
+	}
+	if err := sess.Append(history...); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	sess.Close()
+
+	reopened, meta, messages, _, err := store.Open(sess.ID[:15])
+	if err != nil {
+		t.Fatalf("Open by prefix: %v", err)
+	}
+	defer reopened.Close()
+
+	if meta.Model != "llama3.1:8b" || meta.Cwd != "/work" {
+		t.Errorf("unexpected meta: %+v", meta)
+	}
+	if len(messages) != len(history) {
+		t.Fatalf("expected %d messages, got %d", len(history), len(messages))
+	}
+	tc := messages[2].ToolCalls
+	if len(tc) != 1 || tc[0].ID != "call_1" || tc[0].Arguments["cmd"] != "go build ./..." {
+		t.Errorf("tool call not preserved: %+v", tc)
+	}
+	if messages[3].ToolCallID != "call_1" {
+		t.Errorf("tool result ID not preserved: %+v", messages[3])
+	}
+
+	// A replace record rewrites the history seen on the next load
+	if err := reopened.Replace(history[:2]); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	if err := reopened.Append(backend.Message{Role: "user", Content: "again"}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	infos, err := store.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(infos) != 1 {
+		t.Fatalf("expected 1 session, got %d", len(infos))
+	}
+	if infos[0].MessageCount != 3 {
+		t.Errorf("MessageCount = %d, want 3", infos[0].MessageCount)
+	}
+	if infos[0].Title != "why does the build fail?" {
+		t.Errorf("Title = %q", infos[0].Title)
+	}
+
+	latest, err := store.Latest("/work")
+	if err != nil || latest.ID != sess.ID {
+		t.Errorf("Latest = %+v, %v", latest, err)
+	}
+	if _, err := store.Latest("/elsewhere"); err == nil {
+		t.Error("expected no session for another directory")
+	}
+}
+
+func TestStoreTranscript(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	sess, err := store.Create(Meta{Cwd: "/work"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	type entry struct {
+		Kind string `json:"kind"`
+	}
+	for _, kind := range []string{"user", "command", "error"} {
+		if err := sess.AppendEntry(entry{kind}); err != nil {
+			t.Fatalf("AppendEntry: %v", err)
+		}
+	}
+	if err := sess.ReplaceTranscript([]entry{{"user"}}); err != nil {
+		t.Fatalf("ReplaceTranscript: %v", err)
+	}
+	if err := sess.AppendEntry(entry{"system"}); err != nil {
+		t.Fatalf("AppendEntry: %v", err)
+	}
+	sess.Close()
+
+	reopened, _, _, transcript, err := store.Open(sess.ID)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer reopened.Close()
+
+	var kinds []string
+	for _, raw := range transcript {
+		var e entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			t.Fatalf("entry %s: %v", raw, err)
+		}
+		kinds = append(kinds, e.Kind)
+	}
+	if strings.Join(kinds, " ") != "user system" {
+		t.Errorf("transcript = %v, want the rewritten transcript and the entry after it", kinds)
+	}
+}
+
+func TestStoreOpenInvalid(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	if _, _, _, _, err := store.Open("missing"); err == nil {
+		t.Error("expected error for missing session")
+	}
+	if _, _, _, _, err := store.Open("../etc/passwd"); err == nil {
+		t.Error("expected error for path traversal")
+	}
+}
@@ -0,0 +1,275 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxJobOutput is how much output a background job keeps; older output is
+// dropped
+const maxJobOutput = 1 << 20
+
+// maxExitedJobs is how many jobs that have exited a session keeps for their
+// output and status; older ones are forgotten
+const maxExitedJobs = 20
+
+// backgroundScript restores the saved state from fd 3 and runs the command
+// given as $1. A background job never changes the session's state.
+const backgroundScript = `. /dev/fd/3 >/dev/null 2>&1
+exec 3<&-
+shopt -s expand_aliases
+eval "$1"
+`
+
+// Job is a command running in the background
+type Job struct {
+	ID      string
+	Command string
+	Started time.Time
+
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	done   chan struct{}
+	err    error         // set when done is closed
+	notify chan struct{} // signalled when output arrives
+
+	mu      sync.Mutex
+	output  ring
+	read    int  // offset in the whole output up to which it has been read
+	writing bool // input is still being written to stdin
+}
+
+func newJob(command string) *Job {
+	return &Job{
+		Command: command,
+		done:    make(chan struct{}),
+		notify:  make(chan struct{}, 1),
+		output:  ring{size: maxJobOutput},
+	}
+}
+
+// Start starts command in the background in the session's directory and
+// environment. Its output is collected for Read.
+func (s *Session) Start(command string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := newJob(command)
+	cmd := exec.Command("bash", "-c", backgroundScript, "bash", command)
+	cmd.Stdout = job
+	cmd.Stderr = job
+	// Children left running must not keep the job from ending
+	cmd.WaitDelay = waitDelay
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.start(cmd, nil); err != nil {
+		return nil, err
+	}
+
+	s.nextJob++
+	job.ID = "bg" + strconv.Itoa(s.nextJob)
+	job.Started = time.Now()
+	job.cmd = cmd
+	job.stdin = stdin
+	if s.jobs == nil {
+		s.jobs = make(map[string]*Job)
+	}
+	s.jobs[job.ID] = job
+	s.forgetExitedJobs()
+
+	go func() {
+		job.err = cmd.Wait()
+		close(job.done)
+	}()
+	return job, nil
+}
+
+// Job returns the background job with the id
+func (s *Session) Job(id string) (*Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	return job, ok
+}
+
+// Jobs returns the background jobs, oldest first
+func (s *Session) Jobs() []*Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Started.Before(jobs[j].Started) })
+	return jobs
+}
+
+// forgetExitedJobs forgets the jobs that exited longest ago once there are
+// more than maxExitedJobs. The caller holds s.mu.
+func (s *Session) forgetExitedJobs() {
+	var exited []*Job
+	for _, job := range s.jobs {
+		if job.Wait(0) {
+			exited = append(exited, job)
+		}
+	}
+	if len(exited) <= maxExitedJobs {
+		return
+	}
+	sort.Slice(exited, func(i, j int) bool { return exited[i].Started.Before(exited[j].Started) })
+	for _, job := range exited[:len(exited)-maxExitedJobs] {
+		delete(s.jobs, job.ID)
+	}
+}
+
+// KillAll kills every background job and forgets them
+func (s *Session) KillAll() {
+	s.mu.Lock()
+	jobs := s.jobs
+	s.jobs = nil
+	s.mu.Unlock()
+
+	for _, job := range jobs {
+		job.Kill()
+	}
+}
+
+// Write collects the job's output
+func (j *Job) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.output.Write(p)
+	select {
+	case j.notify <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// Read returns the output since the last Read. skipped is how much of it
+// was dropped before it could be read.
+func (j *Job) Read() (output string, skipped int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	data, skipped := j.output.since(j.read)
+	j.read = j.output.total
+	return string(data), skipped
+}
+
+// Wait waits up to timeout for the job to exit and reports whether it has
+func (j *Job) Wait(timeout time.Duration) bool {
+	if timeout <= 0 {
+		select {
+		case <-j.done:
+			return true
+		default:
+			return false
+		}
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-j.done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// WaitOutput waits until there is output that hasn't been read yet, the
+// job exits or ctx is done
+func (j *Job) WaitOutput(ctx context.Context) {
+	for {
+		j.mu.Lock()
+		unread := j.output.total > j.read
+		j.mu.Unlock()
+		if unread {
+			return
+		}
+
+		select {
+		case <-j.notify:
+		case <-j.done:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Status describes whether the job is running or how it exited
+func (j *Job) Status() string {
+	if !j.Wait(0) {
+		return fmt.Sprintf("running for %s", time.Since(j.Started).Round(time.Second))
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case j.err == nil:
+		return "exited with code 0"
+	case errors.As(j.err, &exitErr) && exitErr.Exited():
+		return fmt.Sprintf("exited with code %d", exitErr.ExitCode())
+	default:
+		return "ended: " + j.err.Error()
+	}
+}
+
+// Input writes to the job's standard input. When the job doesn't read it
+// before ctx is done, Input returns an error and the input is sent once the
+// job reads it.
+func (j *Job) Input(ctx context.Context, s string) error {
+	if j.Wait(0) {
+		return fmt.Errorf("job %s has exited", j.ID)
+	}
+
+	j.mu.Lock()
+	if j.writing {
+		j.mu.Unlock()
+		return fmt.Errorf("job %s hasn't read the input sent before yet", j.ID)
+	}
+	j.writing = true
+	j.mu.Unlock()
+
+	written := make(chan error, 1)
+	go func() {
+		_, err := io.WriteString(j.stdin, s)
+		j.mu.Lock()
+		j.writing = false
+		j.mu.Unlock()
+		written <- err
+	}()
+
+	select {
+	case err := <-written:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("job %s isn't reading its input; the rest is sent when it does", j.ID)
+	}
+}
+
+// CloseInput closes the job's standard input, so it reads end of file
+func (j *Job) CloseInput() error {
+	return j.stdin.Close()
+}
+
+// Kill kills the job and everything it started, and waits briefly for it
+// to exit
+func (j *Job) Kill() {
+	if j.Wait(0) {
+		return
+	}
+	killProcessGroup(j.cmd)
+	j.Wait(waitDelay)
+}
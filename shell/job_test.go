@@ -0,0 +1,119 @@
+package shell
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobReadsIncrementally(t *testing.T) {
+	dir := t.TempDir()
+	s := New(dir)
+	if _, err := run(t, s, "export NAME=job && cd /"); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := s.Start("echo $NAME $PWD; read line; echo $line; cd /tmp")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer s.KillAll()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	job.WaitOutput(ctx)
+	if out, _ := job.Read(); out != "job /\n" {
+		t.Errorf("first output = %q, want the session's environment and directory", out)
+	}
+	if out, _ := job.Read(); out != "" {
+		t.Errorf("second read = %q, want nothing new", out)
+	}
+
+	if err := job.Input(ctx, "second\n"); err != nil {
+		t.Fatalf("Input: %v", err)
+	}
+	if !job.Wait(5 * time.Second) {
+		t.Fatal("job didn't exit")
+	}
+	if out, _ := job.Read(); out != "second\n" {
+		t.Errorf("output = %q", out)
+	}
+	if job.Status() != "exited with code 0" {
+		t.Errorf("Status = %q", job.Status())
+	}
+	if s.Cwd() != "/" {
+		t.Errorf("a background job changed the session's directory to %s", s.Cwd())
+	}
+	if err := job.Input(ctx, "more"); err == nil {
+		t.Error("expected an error writing to an exited job")
+	}
+}
+
+func TestJobDropsOldOutput(t *testing.T) {
+	job := newJob("")
+	job.Write([]byte(strings.Repeat("a", maxJobOutput)))
+	job.Read()
+	job.Write([]byte(strings.Repeat("b", maxJobOutput+10)))
+
+	out, skipped := job.Read()
+	if skipped != 10 || len(out) != maxJobOutput || strings.Contains(out, "a") {
+		t.Errorf("read %d bytes, skipped %d; want the newest %d bytes and 10 skipped", len(out), skipped, maxJobOutput)
+	}
+}
+
+func TestJobEndsDespiteChildren(t *testing.T) {
+	s := New(t.TempDir())
+	defer s.KillAll()
+
+	// The child holds on to the job's output after the job exits
+	job, err := s.Start("sleep 30 &")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if !job.Wait(waitDelay + 5*time.Second) {
+		t.Errorf("job is %s, want it to have exited", job.Status())
+	}
+}
+
+func TestJobInputTimesOut(t *testing.T) {
+	s := New(t.TempDir())
+	defer s.KillAll()
+
+	job, err := s.Start("sleep 30")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	// More than a pipe holds, which the job never reads
+	if err := job.Input(ctx, strings.Repeat("x", 1<<20)); err == nil || !strings.Contains(err.Error(), "isn't reading") {
+		t.Errorf("Input = %v, want an error saying the job isn't reading", err)
+	}
+	if err := job.Input(context.Background(), "more"); err == nil {
+		t.Error("expected an error while earlier input is still waiting")
+	}
+}
+
+func TestSessionForgetsOldJobs(t *testing.T) {
+	s := New(t.TempDir())
+	defer s.KillAll()
+
+	var first *Job
+	for i := 0; i <= maxExitedJobs+1; i++ {
+		job, err := s.Start("true")
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		if first == nil {
+			first = job
+		}
+		job.Wait(5 * time.Second)
+	}
+	if n := len(s.Jobs()); n > maxExitedJobs+1 {
+		t.Errorf("session keeps %d jobs, want at most %d", n, maxExitedJobs+1)
+	}
+	if _, ok := s.Job(first.ID); ok {
+		t.Error("the oldest job is still kept")
+	}
+}
@@ -0,0 +1,106 @@
+package shell
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// ring keeps the last size bytes written to it. The buffer grows as output
+// arrives, up to size, so short output doesn't cost a full buffer.
+type ring struct {
+	size  int
+	buf   []byte
+	total int // bytes ever written; buf holds the last len(buf) of them
+}
+
+func (r *ring) Write(p []byte) (int, error) {
+	n := len(p)
+	// Only the end of a write longer than the buffer is kept; skip whole
+	// turns of the ring so offsets still map to the same positions
+	if full := len(r.buf) == r.size; full && len(p) > r.size {
+		skip := (len(p) - r.size) / r.size * r.size
+		r.total += skip
+		p = p[skip:]
+	}
+	for len(p) > 0 {
+		var copied int
+		if len(r.buf) < r.size {
+			copied = min(len(p), r.size-len(r.buf))
+			r.buf = append(r.buf, p[:copied]...)
+		} else {
+			copied = copy(r.buf[r.total%r.size:], p)
+		}
+		r.total += copied
+		p = p[copied:]
+	}
+	return n, nil
+}
+
+// since returns the output written from offset on. skipped is how much of
+// it has already been dropped.
+func (r *ring) since(offset int) (output []byte, skipped int) {
+	oldest := r.total - len(r.buf)
+	if offset < oldest {
+		skipped = oldest - offset
+		offset = oldest
+	}
+	n := r.total - offset
+	if n <= 0 {
+		return nil, skipped
+	}
+	if len(r.buf) < r.size {
+		return append([]byte(nil), r.buf[len(r.buf)-n:]...), skipped
+	}
+	start := offset % r.size
+	if start+n <= r.size {
+		return append([]byte(nil), r.buf[start:start+n]...), skipped
+	}
+	return append(append([]byte(nil), r.buf[start:]...), r.buf[:n-(r.size-start)]...), skipped
+}
+
+// Output collects the output of a command up to a limit. Past it, the
+// first and last half of the limit are kept and the middle is dropped.
+type Output struct {
+	limit int
+	head  []byte
+	tail  ring
+}
+
+// NewOutput returns an Output that keeps at most limit bytes
+func NewOutput(limit int) *Output {
+	return &Output{limit: limit, tail: ring{size: limit - limit/2}}
+}
+
+func (o *Output) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := o.limit/2 - len(o.head); room > 0 {
+		keep := min(room, len(p))
+		o.head = append(o.head, p[:keep]...)
+		p = p[keep:]
+	}
+	o.tail.Write(p)
+	return n, nil
+}
+
+// String returns the output, with a note in place of the dropped middle
+func (o *Output) String() string {
+	tail, dropped := o.tail.since(0)
+	if dropped == 0 {
+		return string(o.head) + string(tail)
+	}
+
+	// Don't leave half a character on either side of the cut
+	head := o.head
+	for i := 0; i < utf8.UTFMax && len(head) > 0; i++ {
+		if r, size := utf8.DecodeLastRune(head); r != utf8.RuneError || size > 1 {
+			break
+		}
+		head = head[:len(head)-1]
+		dropped++
+	}
+	for i := 0; i < utf8.UTFMax && len(tail) > 0 && !utf8.RuneStart(tail[0]); i++ {
+		tail = tail[1:]
+		dropped++
+	}
+	return fmt.Sprintf("%s\n[... %d bytes of output dropped ...]\n%s", head, dropped, tail)
+}
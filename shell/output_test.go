@@ -0,0 +1,46 @@
+package shell
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRingKeepsNewestOutput(t *testing.T) {
+	r := ring{size: 10}
+	var written strings.Builder
+	read := 0
+	for _, chunk := range []string{"abc", "defgh", "ijklmnop", "q", "rstuvwxyz0123456789ABCDEFG", "H"} {
+		r.Write([]byte(chunk))
+		written.WriteString(chunk)
+
+		all := written.String()
+		out, skipped := r.since(read)
+		want := all[max(read, len(all)-10):]
+		if string(out) != want || skipped != max(len(all)-10-read, 0) {
+			t.Errorf("after %q: read %q, skipped %d; want %q", chunk, out, skipped, want)
+		}
+		read = r.total
+	}
+	if out, _ := r.since(0); string(out) != "89ABCDEFGH" {
+		t.Errorf("whole buffer = %q", out)
+	}
+}
+
+func TestOutputKeepsHeadAndTail(t *testing.T) {
+	o := NewOutput(10)
+	o.Write([]byte("abc"))
+	if got := o.String(); got != "abc" {
+		t.Errorf("short output = %q", got)
+	}
+	o.Write([]byte("defghijklmnopqrstuvwxyz"))
+	if got, want := o.String(), "abcde\n[... 16 bytes of output dropped ...]\nvwxyz"; got != want {
+		t.Errorf("long output = %q, want %q", got, want)
+	}
+
+	// A character cut in two is dropped whole
+	o = NewOutput(10)
+	o.Write([]byte("abcdé" + strings.Repeat("x", 20) + "éyzwv"))
+	if got, want := o.String(), "abcd\n[... 24 bytes of output dropped ...]\nyzwv"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
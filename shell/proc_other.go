@@ -0,0 +1,17 @@
+//go:build !unix
+
+package shell
+
+import "os/exec"
+
+// setProcessGroup does nothing; without process groups only the shell
+// itself can be killed
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills cmd's process
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
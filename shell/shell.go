@@ -0,0 +1,155 @@
+// Package shell runs commands in a persistent bash session: the working
+// directory, exported variables, functions and aliases a command leaves
+// behind are there for the next one.
+//
+// Each command runs in a fresh bash that first restores the state the
+// previous command saved on exit, so a command that hangs or is killed
+// can't take the session down with it; it just doesn't update the state.
+package shell
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// waitDelay is how long a killed command's children may hold its output
+// open before it is closed on them
+const waitDelay = 2 * time.Second
+
+// script restores the saved state from fd 3, runs the command given as $1
+// and saves the state to fd 4 on exit, whatever way the command exits.
+// The command itself gets neither descriptor, so processes it leaves
+// running can't hold them open.
+const script = `__bitca_save() {
+	__bitca_status=$?
+	{ pwd; export -p; declare -f; alias -p; } >&4 2>/dev/null
+	exit $__bitca_status
+}
+. /dev/fd/3 >/dev/null 2>&1
+exec 3<&-
+shopt -s expand_aliases
+trap __bitca_save EXIT
+__bitca_command=$1
+shift
+eval "$__bitca_command" 4>&-
+`
+
+// Session is a shell session with its background jobs. It is safe for
+// concurrent use; foreground commands run one at a time.
+type Session struct {
+	mu    sync.Mutex
+	dir   string // where the session starts
+	cwd   string
+	state string // bash commands that restore the environment
+
+	jobs    map[string]*Job
+	nextJob int
+}
+
+// New creates a session that starts in dir
+func New(dir string) *Session {
+	return &Session{dir: dir, cwd: dir}
+}
+
+// Cwd returns the session's current working directory
+func (s *Session) Cwd() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cwd
+}
+
+// Restart forgets the session's state: the next command starts in the
+// starting directory with the environment bitca was started with
+func (s *Session) Restart() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cwd = s.dir
+	s.state = ""
+}
+
+// Run runs command in the session, writing its output (stdout and stderr)
+// to output. The error is the command's exit status, or why it couldn't
+// run. When ctx is done the command and everything it started is killed.
+func (s *Session) Run(ctx context.Context, command string, output io.Writer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stateOutReader, stateOut, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer stateOutReader.Close()
+
+	cmd := exec.CommandContext(ctx, "bash", "-c", script, "bash", command)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	cmd.WaitDelay = waitDelay
+
+	err = s.start(cmd, stateOut)
+	stateOut.Close() // Only the child writes to it
+	if err != nil {
+		return err
+	}
+
+	saved := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(stateOutReader)
+		saved <- data
+	}()
+
+	err = cmd.Wait()
+	s.update(string(<-saved))
+	return err
+}
+
+// start starts cmd in the session's directory in its own process group,
+// with the saved state readable on fd 3 and stateOut, if not nil, on fd 4.
+// The caller holds s.mu.
+func (s *Session) start(cmd *exec.Cmd, stateOut *os.File) error {
+	// The directory may have been removed since
+	if info, err := os.Stat(s.cwd); err != nil || !info.IsDir() {
+		s.cwd = s.dir
+	}
+
+	stateIn, stateInWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer stateIn.Close()
+
+	cmd.Dir = s.cwd
+	cmd.ExtraFiles = []*os.File{stateIn}
+	if stateOut != nil {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, stateOut)
+	}
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		stateInWriter.Close()
+		return err
+	}
+
+	state := s.state
+	go func() {
+		io.WriteString(stateInWriter, state)
+		stateInWriter.Close()
+	}()
+	return nil
+}
+
+// update takes the state a command saved; nothing is saved when the
+// command was killed, and the previous state stays
+func (s *Session) update(saved string) {
+	cwd, state, ok := strings.Cut(saved, "\n")
+	if !ok || cwd == "" {
+		return
+	}
+	s.cwd = cwd
+	s.state = state
+}
@@ -0,0 +1,95 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func run(t *testing.T, s *Session, command string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	err := s.Run(context.Background(), command, &out)
+	return strings.TrimSpace(out.String()), err
+}
+
+func TestSessionKeepsState(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(dir)
+	if _, err := run(t, s, "cd sub && export GREETING=hello && greet() { echo \"$GREETING $1\"; } && alias ll='echo listed'"); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if s.Cwd() != sub {
+		t.Errorf("Cwd = %q, want %q", s.Cwd(), sub)
+	}
+
+	out, err := run(t, s, "pwd; greet world; ll")
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if want := sub + "\nhello world\nlisted"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+
+	// A failing command still saves its changes
+	if _, err := run(t, s, "cd .. && export GREETING=bye && false"); err == nil {
+		t.Error("expected the exit status as an error")
+	}
+	if out, _ := run(t, s, "echo $GREETING; pwd"); out != "bye\n"+dir {
+		t.Errorf("output = %q after a failing command", out)
+	}
+
+	s.Restart()
+	if out, _ := run(t, s, "echo \"[$GREETING]\"; pwd"); out != "[]\n"+dir {
+		t.Errorf("output = %q after restart", out)
+	}
+}
+
+func TestSessionSurvivesKilledCommand(t *testing.T) {
+	dir := t.TempDir()
+	s := New(dir)
+	if _, err := run(t, s, "export KEPT=1"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := s.Run(ctx, "cd / && export KEPT=2 && sleep 10", &bytes.Buffer{}); err == nil {
+		t.Error("expected an error for a killed command")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("killed command took %v", time.Since(start))
+	}
+
+	// The killed command saved nothing
+	if out, _ := run(t, s, "echo $KEPT; pwd"); out != "1\n"+dir {
+		t.Errorf("output = %q, want the state from before the killed command", out)
+	}
+}
+
+func TestSessionRemovedDirectory(t *testing.T) {
+	dir := t.TempDir()
+	gone := filepath.Join(dir, "gone")
+	if err := os.Mkdir(gone, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(dir)
+	run(t, s, "cd gone")
+	if err := os.Remove(gone); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := run(t, s, "pwd"); err != nil || out != dir {
+		t.Errorf("pwd = %q, %v; want the starting directory", out, err)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// toolPreviewLines is how much of a tool result a collapsed block shows
+const toolPreviewLines = 4
+
+// toolDiffPreviewLines is how much of a diff a collapsed block shows
+const toolDiffPreviewLines = 12
+
+// toolArgPreviewLines is how much of a multiline argument (e.g. the content
+// of a write) a collapsed block shows
+const toolArgPreviewLines = 3
+
+var (
+	toolBlockStyle = lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(subtleColor).
+			Padding(0, 1).
+			MarginLeft(2)
+
+	toolNameStyle = lipgloss.NewStyle().
+			Foreground(secondaryColor).
+			Bold(true)
+
+	toolArgKeyStyle = lipgloss.NewStyle().
+			Foreground(subtleColor)
+
+	toolResultStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#CDD6F4"))
+
+	toolHintStyle = lipgloss.NewStyle().
+			Foreground(subtleColor).
+			Italic(true)
+
+	diffAddedStyle   = lipgloss.NewStyle().Foreground(userColor)
+	diffRemovedStyle = lipgloss.NewStyle().Foreground(errorColor)
+	diffHunkStyle    = lipgloss.NewStyle().Foreground(secondaryColor)
+)
+
+// diffTools are the tools whose results are diffs
+var diffTools = map[string]bool{
+	"write":       true,
+	"edit":        true,
+	"apply_patch": true,
+}
+
+// pairToolResults maps the transcript index of each tool call to the index
+// of its result. Results are matched by tool call ID, or in order for
+// backends without IDs.
+func pairToolResults(transcript []transcriptEntry) map[int]int {
+	pairs := make(map[int]int)
+	var open []int // calls still waiting for a result
+
+	for i, entry := range transcript {
+		switch entry.Kind {
+		case entryToolCall:
+			open = append(open, i)
+		case entryToolResult:
+			match := -1
+			for j, call := range open {
+				if entry.ToolCallID != "" && transcript[call].ToolCallID == entry.ToolCallID {
+					match = j
+					break
+				}
+			}
+			if match < 0 && len(open) > 0 {
+				match = 0
+			}
+			if match >= 0 {
+				pairs[open[match]] = i
+				open = append(open[:match], open[match+1:]...)
+			}
+		case entryUser:
+			open = nil
+		}
+	}
+	return pairs
+}
+
+// renderToolBlock renders a tool call and its result (nil while it runs) as
+// one block. Collapsed blocks show only the start of long arguments and
+// results.
+func renderToolBlock(call transcriptEntry, result *transcriptEntry, expanded, focused bool, width int) string {
+	inner := width - 6 // margin, border and padding
+	if inner < 10 {
+		inner = 10
+	}
+
+	var b strings.Builder
+	b.WriteString(toolNameStyle.Render("⚙ " + call.ToolName))
+	b.WriteString("  " + toolStatusText(result))
+
+	if args := formatToolArgs(call.Arguments, expanded, inner); args != "" {
+		b.WriteString("\n" + args)
+	}
+
+	if result != nil {
+		b.WriteString("\n")
+		content := strings.TrimRight(result.Content, "\n")
+		if content == "" {
+			b.WriteString(toolHintStyle.Render("(no output)"))
+		} else if diffTools[call.ToolName] {
+			if !expanded {
+				var hidden int
+				content, hidden = previewLines(content, toolDiffPreviewLines, inner)
+				if hidden > 0 {
+					content += "\n" + toolHintStyle.Render(fmt.Sprintf("… %d more lines", hidden))
+				}
+			}
+			b.WriteString(wordWrap(colorDiff(content), inner))
+		} else if expanded {
+			b.WriteString(toolResultStyle.Render(wordWrap(content, inner)))
+		} else {
+			preview, hidden := previewLines(content, toolPreviewLines, inner)
+			b.WriteString(toolResultStyle.Render(preview))
+			if hidden > 0 {
+				b.WriteString("\n" + toolHintStyle.Render(fmt.Sprintf("… %d more lines", hidden)))
+			}
+		}
+	}
+
+	style := toolBlockStyle.Width(inner + 2)
+	if focused {
+		style = style.BorderForeground(accentColor)
+	}
+	return style.Render(b.String())
+}
+
+// colorDiff colors the added, removed and hunk header lines of a diff
+func colorDiff(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			lines[i] = lipgloss.NewStyle().Bold(true).Render(line)
+		case strings.HasPrefix(line, "+"):
+			lines[i] = diffAddedStyle.Render(line)
+		case strings.HasPrefix(line, "-"):
+			lines[i] = diffRemovedStyle.Render(line)
+		case strings.HasPrefix(line, "@@"):
+			lines[i] = diffHunkStyle.Render(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// toolStatusText describes how a tool call went
+func toolStatusText(result *transcriptEntry) string {
+	if result == nil {
+		return statusStyle.UnsetMarginLeft().Render("running…")
+	}
+
+	var icon string
+	color := subtleColor
+	switch result.Status {
+	case toolSucceeded:
+		icon, color = "✓", userColor
+	case toolFailed:
+		icon, color = "✗", errorColor
+	case toolDenied, toolCancelled:
+		icon, color = "⊘", accentColor
+	default:
+		icon = "•"
+	}
+
+	text := icon
+	if result.Status != "" {
+		text += " " + result.Status
+	}
+	if result.Duration > 0 {
+		text += " · " + formatDuration(result.Duration)
+	}
+	return lipgloss.NewStyle().Foreground(color).Render(text)
+}
+
+// formatToolArgs pretty-prints tool arguments, one per line in key order.
+// Multiline values are indented below their key.
+func formatToolArgs(args map[string]interface{}, expanded bool, width int) string {
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var lines []string
+	for _, k := range keys {
+		var value string
+		if s, ok := args[k].(string); ok {
+			value = s
+		} else {
+			data, err := json.Marshal(args[k])
+			if err != nil {
+				value = fmt.Sprint(args[k])
+			} else {
+				value = string(data)
+			}
+		}
+
+		key := toolArgKeyStyle.Render(k + ":")
+		if !strings.Contains(value, "\n") {
+			if !expanded {
+				value = clipLine(value, width-len(k)-2)
+			}
+			lines = append(lines, wordWrap(key+" "+value, width))
+			continue
+		}
+
+		body := strings.TrimRight(value, "\n")
+		hidden := 0
+		if expanded {
+			body = wordWrap(body, width-2)
+		} else {
+			body, hidden = previewLines(body, toolArgPreviewLines, width-2)
+		}
+		lines = append(lines, key, lipgloss.NewStyle().MarginLeft(2).Render(body))
+		if hidden > 0 {
+			lines = append(lines, toolHintStyle.MarginLeft(2).Render(fmt.Sprintf("… %d more lines", hidden)))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// previewLines returns the first n lines of text, each clipped to width,
+// and how many lines were left out
+func previewLines(text string, n, width int) (string, int) {
+	lines := strings.Split(text, "\n")
+	hidden := 0
+	if len(lines) > n {
+		hidden = len(lines) - n
+		lines = lines[:n]
+	}
+	for i, line := range lines {
+		lines[i] = clipLine(line, width)
+	}
+	return strings.Join(lines, "\n"), hidden
+}
+
+// clipLine shortens a line to width characters
+func clipLine(line string, width int) string {
+	line = strings.ReplaceAll(line, "\t", "    ")
+	runes := []rune(line)
+	if width < 1 || len(runes) <= width {
+		return line
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+// toolBlockIndices returns the transcript indices of all tool calls
+func (m model) toolBlockIndices() []int {
+	var indices []int
+	for i, entry := range m.transcript {
+		if entry.Kind == entryToolCall {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// startBrowsingTools focuses the most recent tool block
+func (m *model) startBrowsingTools() {
+	blocks := m.toolBlockIndices()
+	if len(blocks) == 0 {
+		return
+	}
+	m.browsingTools = true
+	m.focusedTool = blocks[len(blocks)-1]
+	m.updateViewportContent()
+}
+
+// moveToolFocus moves the focus delta tool blocks up or down
+func (m *model) moveToolFocus(delta int) {
+	blocks := m.toolBlockIndices()
+	for i, index := range blocks {
+		if index == m.focusedTool {
+			next := i + delta
+			if next >= 0 && next < len(blocks) {
+				m.focusedTool = blocks[next]
+			}
+			return
+		}
+	}
+}
+
+// updateToolBrowsing handles a key while a tool block has the focus
+func (m *model) updateToolBrowsing(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "ctrl+c":
+		if m.cancelTurn != nil {
+			m.cancelTurn()
+		}
+		return tea.Quit
+	case "esc", "ctrl+t", "q":
+		m.browsingTools = false
+	case "up", "k", "shift+tab":
+		m.moveToolFocus(-1)
+	case "down", "j", "tab":
+		m.moveToolFocus(1)
+	case "enter", " ":
+		if m.expandedTools == nil {
+			m.expandedTools = make(map[int]bool)
+		}
+		m.expandedTools[m.focusedTool] = !m.expandedTools[m.focusedTool]
+	case "pgup", "pgdown", "shift+up", "shift+down":
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return cmd
+	default:
+		return nil
+	}
+	m.updateViewportContent()
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var ansiSequence = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func stripANSI(s string) string {
+	return ansiSequence.ReplaceAllString(s, "")
+}
+
+func TestPairToolResults(t *testing.T) {
+	transcript := []transcriptEntry{
+		{Kind: entryUser, Content: "hi"},
+		{Kind: entryToolCall, ToolName: "read", ToolCallID: "a"},
+		{Kind: entryToolCall, ToolName: "grep", ToolCallID: "b"},
+		{Kind: entryToolResult, ToolName: "grep", ToolCallID: "b"},
+		{Kind: entryToolResult, ToolName: "read", ToolCallID: "a"},
+		// Without IDs results are matched in order
+		{Kind: entryToolCall, ToolName: "bash"},
+		{Kind: entryToolCall, ToolName: "glob"},
+		{Kind: entryToolResult},
+		{Kind: entryToolResult},
+	}
+
+	pairs := pairToolResults(transcript)
+	want := map[int]int{1: 4, 2: 3, 5: 7, 6: 8}
+	if len(pairs) != len(want) {
+		t.Fatalf("pairs = %v, want %v", pairs, want)
+	}
+	for call, result := range want {
+		if pairs[call] != result {
+			t.Errorf("call %d paired with %d, want %d", call, pairs[call], result)
+		}
+	}
+}
+
+func TestRenderToolBlock(t *testing.T) {
+	call := transcriptEntry{
+		Kind:      entryToolCall,
+		ToolName:  "grep",
+		Arguments: map[string]interface{}{"pat": "TODO", "path": "."},
+	}
+	result := &transcriptEntry{
+		Kind:     entryToolResult,
+		Content:  "a.go:1: TODO one\nb.go:2: TODO two\nc.go:3: TODO three\nd.go:4: TODO four\ne.go:5: TODO five\nf.go:6: TODO six",
+		Status:   toolSucceeded,
+		Duration: 42 * time.Millisecond,
+	}
+
+	collapsed := stripANSI(renderToolBlock(call, result, false, false, 80))
+	for _, want := range []string{"grep", "✓ ok · 42ms", "pat: TODO", "path: .", "d.go:4", "… 2 more lines"} {
+		if !strings.Contains(collapsed, want) {
+			t.Errorf("collapsed block is missing %q:\n%s", want, collapsed)
+		}
+	}
+	if strings.Contains(collapsed, "f.go:6") {
+		t.Errorf("collapsed block shows the whole result:\n%s", collapsed)
+	}
+
+	expanded := stripANSI(renderToolBlock(call, result, true, false, 80))
+	if !strings.Contains(expanded, "f.go:6") || strings.Contains(expanded, "more lines") {
+		t.Errorf("expanded block should show the whole result:\n%s", expanded)
+	}
+
+	running := stripANSI(renderToolBlock(call, nil, false, false, 80))
+	if !strings.Contains(running, "running") {
+		t.Errorf("block without a result should be running:\n%s", running)
+	}
+}
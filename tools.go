@@ -1,275 +1,60 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
-	"regexp"
-	"sort"
-	"strings"
-	"time"
 
+	"github.com/gotha/bitca/backend"
+	"github.com/gotha/bitca/workspace"
 	"github.com/ollama/ollama/api"
 )
 
-// Tool execution functions
-
-func toolRead(args map[string]interface{}) (string, error) {
-	path, ok := args["path"].(string)
-	if !ok {
-		return "", fmt.Errorf("path must be a string")
-	}
-
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return "", err
-	}
-
-	lines := strings.Split(string(data), "\n")
-	offset := 0
-	limit := len(lines)
-
-	if o, ok := args["offset"].(float64); ok {
-		offset = int(o)
-	}
-	if l, ok := args["limit"].(float64); ok {
-		limit = int(l)
-	}
+// toolWorkspace confines the file tools; nil means no restriction
+var toolWorkspace *workspace.Workspace
 
-	if offset >= len(lines) {
-		return "", nil
+// resolvePath checks a path given to a file tool against the workspace and
+// returns it absolute with symlinks resolved
+func resolvePath(path string) (string, error) {
+	if toolWorkspace == nil {
+		return path, nil
 	}
-
-	end := offset + limit
-	if end > len(lines) {
-		end = len(lines)
-	}
-
-	var result strings.Builder
-	for idx, line := range lines[offset:end] {
-		result.WriteString(fmt.Sprintf("%4d| %s\n", offset+idx+1, line))
-	}
-
-	return result.String(), nil
+	return toolWorkspace.Resolve(path)
 }
 
-func toolWrite(args map[string]interface{}) (string, error) {
-	path, ok := args["path"].(string)
-	if !ok {
-		return "", fmt.Errorf("path must be a string")
-	}
-
-	content, ok := args["content"].(string)
-	if !ok {
-		return "", fmt.Errorf("content must be a string")
-	}
-
-	if !strings.HasPrefix(path, "/") {
-		if strings.HasPrefix(path, "./") {
-			path = strings.TrimLeft(path, "./")
-		}
-
-		cwd, err := os.Getwd()
-		if err != nil {
-			return "", fmt.Errorf("cannot get current working directory")
-		}
-
-		path = fmt.Sprintf("%s/%s", cwd, path)
-	}
-
-	// Create parent directories if they don't exist
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return "", fmt.Errorf("failed to create directories: %w", err)
-	}
-
-	err := os.WriteFile(path, []byte(content), 0o644)
-	if err != nil {
-		return "", err
-	}
-	fmt.Printf("writing file to %s\n", path)
-
-	return "ok", nil
-}
-
-func toolEdit(args map[string]interface{}) (string, error) {
-	path, ok := args["path"].(string)
-	if !ok {
-		return "", fmt.Errorf("path must be a string")
-	}
-
-	old, ok := args["old"].(string)
-	if !ok {
-		return "", fmt.Errorf("old must be a string")
-	}
-
-	new, ok := args["new"].(string)
-	if !ok {
-		return "", fmt.Errorf("new must be a string")
-	}
-
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return "", err
-	}
-
-	text := string(data)
-	if !strings.Contains(text, old) {
-		return "error: old_string not found", nil
-	}
-
-	count := strings.Count(text, old)
-	all, _ := args["all"].(bool)
-
-	if !all && count > 1 {
-		return fmt.Sprintf("error: old_string appears %d times, must be unique (use all=true)", count), nil
-	}
-
-	var replacement string
-	if all {
-		replacement = strings.ReplaceAll(text, old, new)
-	} else {
-		replacement = strings.Replace(text, old, new, 1)
-	}
+// Tool execution functions
 
-	err = os.WriteFile(path, []byte(replacement), 0o644)
+func toolWrite(args map[string]interface{}) (string, error) {
+	change, err := planWrite(args)
 	if err != nil {
 		return "", err
 	}
-
-	return "ok", nil
-}
-
-func toolGlob(args map[string]interface{}) (string, error) {
-	pat, ok := args["pat"].(string)
-	if !ok {
-		return "", fmt.Errorf("pat must be a string")
-	}
-
-	basePath := "."
-	if p, ok := args["path"].(string); ok {
-		basePath = p
-	}
-
-	pattern := filepath.Join(basePath, pat)
-	matches, err := filepath.Glob(pattern)
-	if err != nil {
+	if err := change.apply(); err != nil {
 		return "", err
 	}
+	debugLog.Printf("Wrote file %s", change.path)
 
-	// Sort by modification time, newest first
-	sort.Slice(matches, func(i, j int) bool {
-		infoI, errI := os.Stat(matches[i])
-		infoJ, errJ := os.Stat(matches[j])
-		if errI != nil || errJ != nil {
-			return false
-		}
-		return infoI.ModTime().After(infoJ.ModTime())
-	})
-
-	if len(matches) == 0 {
-		return "none", nil
-	}
-
-	return strings.Join(matches, "\n"), nil
+	return change.summary(), nil
 }
 
-func toolGrep(args map[string]interface{}) (string, error) {
-	pat, ok := args["pat"].(string)
-	if !ok {
-		return "", fmt.Errorf("pat must be a string")
-	}
-
-	basePath := "."
-	if p, ok := args["path"].(string); ok {
-		basePath = p
+func toolEdit(args map[string]interface{}) (string, error) {
+	change, err := planEdit(args)
+	var problem editProblem
+	if errors.As(err, &problem) {
+		return "error: " + string(problem), nil
 	}
-
-	pattern, err := regexp.Compile(pat)
 	if err != nil {
 		return "", err
 	}
-
-	var hits []string
-	err = filepath.Walk(basePath, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
-		}
-
-		file, err := os.Open(path)
-		if err != nil {
-			return nil
-		}
-		defer file.Close()
-
-		scanner := bufio.NewScanner(file)
-		lineNum := 1
-		for scanner.Scan() {
-			line := scanner.Text()
-			if pattern.MatchString(line) {
-				hits = append(hits, fmt.Sprintf("%s:%d:%s", path, lineNum, line))
-				if len(hits) >= 50 {
-					return filepath.SkipAll
-				}
-			}
-			lineNum++
-		}
-		return nil
-	})
-
-	if err != nil && err != filepath.SkipAll {
+	if err := change.apply(); err != nil {
 		return "", err
 	}
 
-	if len(hits) == 0 {
-		return "none", nil
-	}
-
-	return strings.Join(hits, "\n"), nil
-}
-
-func toolBash(args map[string]interface{}) (string, error) {
-	cmd, ok := args["cmd"].(string)
-	if !ok {
-		return "", fmt.Errorf("cmd must be a string")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	command := exec.CommandContext(ctx, "bash", "-c", cmd)
-	var output bytes.Buffer
-	command.Stdout = &output
-	command.Stderr = &output
-
-	err := command.Run()
-	result := output.String()
-
-	if ctx.Err() == context.DeadlineExceeded {
-		result += "\n(timed out after 30s)"
-	}
-
-	if result == "" {
-		if err != nil {
-			return fmt.Sprintf("(empty output, error: %v)", err), nil
-		}
-		return "(empty)", nil
-	}
-
-	// Include error info if command failed but produced output
-	if err != nil {
-		result = fmt.Sprintf("%s\n(exit code: %v)", strings.TrimSpace(result), err)
-	}
-
-	return strings.TrimSpace(result), nil
+	return change.summary(), nil
 }
 
 // executeTool dispatches tool calls to the appropriate function
-func executeTool(name string, args map[string]interface{}) (string, error) {
+func executeTool(ctx context.Context, name string, args map[string]interface{}) (string, error) {
 	switch name {
 	case "read":
 		return toolRead(args)
@@ -277,17 +62,45 @@ func executeTool(name string, args map[string]interface{}) (string, error) {
 		return toolWrite(args)
 	case "edit":
 		return toolEdit(args)
+	case "apply_patch":
+		return toolApplyPatch(args)
 	case "glob":
-		return toolGlob(args)
+		return toolGlob(ctx, args)
 	case "grep":
-		return toolGrep(args)
+		return toolGrep(ctx, args)
 	case "bash":
-		return toolBash(args)
+		return toolBash(ctx, args)
+	case "bash_output":
+		return toolBashOutput(ctx, args)
+	case "bash_input":
+		return toolBashInput(ctx, args)
+	case "bash_kill":
+		return toolBashKill(args)
 	default:
 		return "", fmt.Errorf("unknown tool: %s", name)
 	}
 }
 
+// executeToolContent runs a built-in tool like executeTool, and also returns
+// the images the read tool attaches
+func executeToolContent(ctx context.Context, name string, args map[string]interface{}) (string, []backend.Image, error) {
+	if name == "read" {
+		return readFile(args)
+	}
+	result, err := executeTool(ctx, name, args)
+	return result, nil, err
+}
+
+// builtInToolNames returns the names of the tools defineTools defines, to
+// tell them apart from MCP tools
+func builtInToolNames() map[string]bool {
+	names := make(map[string]bool)
+	for _, tool := range defineTools() {
+		names[tool.Function.Name] = true
+	}
+	return names
+}
+
 // defineTools creates the tool definitions for Ollamawha
 func defineTools() api.Tools {
 	// read tool
@@ -298,11 +111,11 @@ func defineTools() api.Tools {
 	})
 	readProps.Set("offset", api.ToolProperty{
 		Type:        []string{"number"},
-		Description: "Line offset to start reading from (optional)",
+		Description: "Number of lines to skip before reading (optional)",
 	})
 	readProps.Set("limit", api.ToolProperty{
 		Type:        []string{"number"},
-		Description: "Maximum number of lines to read (optional)",
+		Description: "Maximum number of lines to read (optional, default 2000)",
 	})
 
 	// write tool
@@ -335,16 +148,27 @@ func defineTools() api.Tools {
 		Description: "Replace all occurrences (optional, default false)",
 	})
 
+	// apply_patch tool
+	patchProps := api.NewToolPropertiesMap()
+	patchProps.Set("patch", api.ToolProperty{
+		Type:        []string{"string"},
+		Description: "Unified diff (---/+++ headers, @@ hunks; /dev/null to create or delete) or SEARCH/REPLACE blocks, each after a line with the file path",
+	})
+
 	// glob tool
 	globProps := api.NewToolPropertiesMap()
 	globProps.Set("pat", api.ToolProperty{
 		Type:        []string{"string"},
-		Description: "Glob pattern to match files",
+		Description: "Glob pattern, e.g. '**/*.go' or 'src/*.{ts,tsx}' (** matches any number of directories)",
 	})
 	globProps.Set("path", api.ToolProperty{
 		Type:        []string{"string"},
 		Description: "Base path to search from (optional, default '.')",
 	})
+	globProps.Set("limit", api.ToolProperty{
+		Type:        []string{"number"},
+		Description: "Maximum number of paths to return (optional, default 200)",
+	})
 
 	// grep tool
 	grepProps := api.NewToolPropertiesMap()
@@ -356,6 +180,39 @@ func defineTools() api.Tools {
 		Type:        []string{"string"},
 		Description: "Base path to search from (optional, default '.')",
 	})
+	grepProps.Set("include", api.ToolProperty{
+		Type:        []string{"string"},
+		Description: "Only search files matching these comma-separated globs, e.g. '*.go,*.mod' (optional)",
+	})
+	grepProps.Set("exclude", api.ToolProperty{
+		Type:        []string{"string"},
+		Description: "Skip files matching these comma-separated globs (optional)",
+	})
+	grepProps.Set("ignore_case", api.ToolProperty{
+		Type:        []string{"boolean"},
+		Description: "Match case-insensitively (optional, default false)",
+	})
+	grepProps.Set("before", api.ToolProperty{
+		Type:        []string{"number"},
+		Description: "Lines of context before each match, like grep -B (optional)",
+	})
+	grepProps.Set("after", api.ToolProperty{
+		Type:        []string{"number"},
+		Description: "Lines of context after each match, like grep -A (optional)",
+	})
+	grepProps.Set("context", api.ToolProperty{
+		Type:        []string{"number"},
+		Description: "Lines of context before and after each match, like grep -C (optional)",
+	})
+	grepProps.Set("output", api.ToolProperty{
+		Type:        []string{"string"},
+		Description: "content: matching lines (default), files: only file names, count: matches per file",
+		Enum:        []any{"content", "files", "count"},
+	})
+	grepProps.Set("limit", api.ToolProperty{
+		Type:        []string{"number"},
+		Description: "Maximum number of matching lines, or files for files and count (optional, default 100)",
+	})
 
 	// bash tool
 	bashProps := api.NewToolPropertiesMap()
@@ -363,6 +220,49 @@ func defineTools() api.Tools {
 		Type:        []string{"string"},
 		Description: "Shell command to execute",
 	})
+	bashProps.Set("restart", api.ToolProperty{
+		Type:        []string{"boolean"},
+		Description: "Restart the shell first, back in the workspace root with the original environment (optional)",
+	})
+	bashProps.Set("timeout", api.ToolProperty{
+		Type:        []string{"number"},
+		Description: "Seconds before the command is killed (optional, default 120, at most 600)",
+	})
+	bashProps.Set("background", api.ToolProperty{
+		Type:        []string{"boolean"},
+		Description: "Run in the background and return a job id at once, for servers and other long-running commands (optional)",
+	})
+
+	// background job tools
+	jobProps := api.NewToolPropertiesMap()
+	jobProps.Set("id", api.ToolProperty{
+		Type:        []string{"string"},
+		Description: "Job id returned by bash with background=true",
+	})
+
+	outputProps := api.NewToolPropertiesMap()
+	outputProps.Set("id", api.ToolProperty{
+		Type:        []string{"string"},
+		Description: "Job id (optional; without it the jobs are listed)",
+	})
+	outputProps.Set("wait", api.ToolProperty{
+		Type:        []string{"number"},
+		Description: "Seconds to wait for new output or for the job to exit (optional, default 0, at most 60)",
+	})
+
+	inputProps := api.NewToolPropertiesMap()
+	inputProps.Set("id", api.ToolProperty{
+		Type:        []string{"string"},
+		Description: "Job id",
+	})
+	inputProps.Set("input", api.ToolProperty{
+		Type:        []string{"string"},
+		Description: "Text to write to the job's standard input; include a trailing newline to send a line",
+	})
+	inputProps.Set("close", api.ToolProperty{
+		Type:        []string{"boolean"},
+		Description: "Close standard input afterwards, sending end of file (optional)",
+	})
 
 	return api.Tools{
 		{
@@ -401,11 +301,23 @@ func defineTools() api.Tools {
 				},
 			},
 		},
+		{
+			Type: "function",
+			Function: api.ToolFunction{
+				Name:        "apply_patch",
+				Description: "Apply a multi-hunk, multi-file patch; context is matched loosely and each hunk's result is reported",
+				Parameters: api.ToolFunctionParameters{
+					Type:       "object",
+					Properties: patchProps,
+					Required:   []string{"patch"},
+				},
+			},
+		},
 		{
 			Type: "function",
 			Function: api.ToolFunction{
 				Name:        "glob",
-				Description: "Find files by pattern, sorted by modification time (newest first)",
+				Description: "Find files by pattern, skipping .gitignored files, sorted by modification time (newest first)",
 				Parameters: api.ToolFunctionParameters{
 					Type:       "object",
 					Properties: globProps,
@@ -417,7 +329,7 @@ func defineTools() api.Tools {
 			Type: "function",
 			Function: api.ToolFunction{
 				Name:        "grep",
-				Description: "Search files for regex pattern (returns up to 50 matches)",
+				Description: "Search files for regex pattern, skipping .gitignored and binary files",
 				Parameters: api.ToolFunctionParameters{
 					Type:       "object",
 					Properties: grepProps,
@@ -429,7 +341,7 @@ func defineTools() api.Tools {
 			Type: "function",
 			Function: api.ToolFunction{
 				Name:        "bash",
-				Description: "Run shell command (30 second timeout)",
+				Description: "Run shell command in a persistent session: cd, exported variables and functions carry over to later calls (2 minute timeout unless set)",
 				Parameters: api.ToolFunctionParameters{
 					Type:       "object",
 					Properties: bashProps,
@@ -437,5 +349,40 @@ func defineTools() api.Tools {
 				},
 			},
 		},
+		{
+			Type: "function",
+			Function: api.ToolFunction{
+				Name:        "bash_output",
+				Description: "Read the new output of a background job and whether it is still running",
+				Parameters: api.ToolFunctionParameters{
+					Type:       "object",
+					Properties: outputProps,
+				},
+			},
+		},
+		{
+			Type: "function",
+			Function: api.ToolFunction{
+				Name:        "bash_input",
+				Description: "Send input to a background job",
+				Parameters: api.ToolFunctionParameters{
+					Type:       "object",
+					Properties: inputProps,
+					Required:   []string{"id", "input"},
+				},
+			},
+		},
+		{
+			Type: "function",
+			Function: api.ToolFunction{
+				Name:        "bash_kill",
+				Description: "Stop a background job and everything it started",
+				Parameters: api.ToolFunctionParameters{
+					Type:       "object",
+					Properties: jobProps,
+					Required:   []string{"id"},
+				},
+			},
+		},
 	}
 }
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gotha/bitca/backend"
+)
+
+// entryKind is the kind of a transcript entry
+type entryKind string
+
+const (
+	entryUser       entryKind = "user"
+	entryAssistant  entryKind = "assistant"
+	entryToolCall   entryKind = "tool_call"
+	entryToolResult entryKind = "tool_result"
+	entrySystem     entryKind = "system"
+	entryCommand    entryKind = "command"
+	entryError      entryKind = "error"
+)
+
+// transcriptEntry is one item of the conversation as shown to the user.
+// Unlike the message history it also holds commands, notices and errors,
+// and it records when things happened and how long tools took.
+type transcriptEntry struct {
+	Kind       entryKind              `json:"kind"`
+	Time       time.Time              `json:"time,omitzero"`
+	Content    string                 `json:"content,omitempty"`
+	ToolCallID string                 `json:"tool_call_id,omitempty"`
+	ToolName   string                 `json:"tool_name,omitempty"`
+	Arguments  map[string]interface{} `json:"arguments,omitempty"`
+	Status     string                 `json:"status,omitempty"`   // tool results: toolSucceeded, toolFailed, ...
+	Duration   time.Duration          `json:"duration,omitempty"` // tool results: how long the tool ran
+}
+
+// addEntry appends a text entry of the given kind to the transcript
+func (m *model) addEntry(kind entryKind, content string) {
+	m.appendEntry(transcriptEntry{Kind: kind, Time: time.Now(), Content: content})
+}
+
+// addToolCall appends a tool call the model requested to the transcript
+func (m *model) addToolCall(call backend.ToolCall) {
+	m.appendEntry(toolCallEntry(call, time.Now()))
+}
+
+// addToolResult appends the outcome of a tool call to the transcript
+func (m *model) addToolResult(call backend.ToolCall, outcome toolOutcome) {
+	entry := toolResultEntry(call, outcome.message, time.Now())
+	entry.Status = outcome.status
+	entry.Duration = outcome.duration
+	m.appendEntry(entry)
+}
+
+// appendEntry adds an entry to the transcript and saves it to the session.
+// Entries from before the session file is created are saved with it.
+func (m *model) appendEntry(entry transcriptEntry) {
+	m.transcript = append(m.transcript, entry)
+	if m.session != nil {
+		if err := m.session.AppendEntry(entry); err != nil {
+			debugLog.Printf("Failed to save transcript entry to session %s: %v", m.session.ID, err)
+		}
+	}
+}
+
+func toolCallEntry(call backend.ToolCall, at time.Time) transcriptEntry {
+	return transcriptEntry{
+		Kind:       entryToolCall,
+		Time:       at,
+		ToolCallID: call.ID,
+		ToolName:   call.Name,
+		Arguments:  call.Arguments,
+	}
+}
+
+func toolResultEntry(call backend.ToolCall, result backend.Message, at time.Time) transcriptEntry {
+	return transcriptEntry{
+		Kind:       entryToolResult,
+		Time:       at,
+		Content:    result.Content,
+		ToolCallID: result.ToolCallID,
+		ToolName:   call.Name,
+	}
+}
+
+// decodeTranscript decodes the transcript entries saved in a session,
+// skipping any it can't read
+func decodeTranscript(saved []json.RawMessage) []transcriptEntry {
+	transcript := make([]transcriptEntry, 0, len(saved))
+	for _, raw := range saved {
+		var entry transcriptEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			debugLog.Printf("Skipping unreadable transcript entry: %v", err)
+			continue
+		}
+		transcript = append(transcript, entry)
+	}
+	return transcript
+}
+
+// rewindTranscript returns the transcript before the last turns user
+// entries, or false when it has fewer
+func rewindTranscript(transcript []transcriptEntry, turns int) ([]transcriptEntry, bool) {
+	if turns == 0 {
+		return transcript, true
+	}
+	for i := len(transcript) - 1; i >= 0; i-- {
+		if transcript[i].Kind == entryUser {
+			if turns--; turns == 0 {
+				return transcript[:i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// transcriptFromMessages rebuilds the transcript from a message history,
+// for sessions saved without their transcript.
+// Histories don't record times or tool durations, so those are left empty.
+func transcriptFromMessages(messages []backend.Message) []transcriptEntry {
+	var transcript []transcriptEntry
+	var calls []backend.ToolCall // tool calls of the last assistant message
+	toolResult := 0
+
+	for _, msg := range messages {
+		switch msg.Role {
+		case "user":
+			if isCompactionSummary(msg) {
+				transcript = append(transcript, transcriptEntry{Kind: entrySystem, Content: "Earlier messages were compacted into a summary"})
+			} else {
+				transcript = append(transcript, transcriptEntry{Kind: entryUser, Content: msg.Content})
+			}
+		case "assistant":
+			if msg.Content != "" {
+				transcript = append(transcript, transcriptEntry{Kind: entryAssistant, Content: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				transcript = append(transcript, toolCallEntry(tc, time.Time{}))
+			}
+			calls = msg.ToolCalls
+			toolResult = 0
+		case "tool":
+			// Match the result to its call by ID, or by position for
+			// backends without tool call IDs
+			call := backend.ToolCall{}
+			for _, tc := range calls {
+				if tc.ID != "" && tc.ID == msg.ToolCallID {
+					call = tc
+				}
+			}
+			if call.Name == "" && toolResult < len(calls) {
+				call = calls[toolResult]
+			}
+			toolResult++
+			transcript = append(transcript, toolResultEntry(call, msg, time.Time{}))
+		}
+	}
+
+	return transcript
+}
+
+// label returns the heading shown above an entry
+func (e transcriptEntry) label() string {
+	switch e.Kind {
+	case entryUser:
+		return "You:"
+	case entryAssistant:
+		return "Assistant:"
+	case entryCommand:
+		return "Command:"
+	case entrySystem:
+		return "System:"
+	case entryError:
+		return "Error:"
+	default:
+		return ""
+	}
+}
+
+// formatDuration formats a tool's run time for display
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	case d < time.Minute:
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	default:
+		return d.Round(time.Second).String()
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gotha/bitca/backend"
+	"github.com/gotha/bitca/session"
+	"github.com/gotha/bitca/shell"
+)
+
+func TestTranscriptFromMessages(t *testing.T) {
+	messages := []backend.Message{
+		{Role: "system", Content: "You are a helpful AI assistant."},
+		{Role: "user", Content: "Why does the build fail?"},
+		{Role: "assistant", ToolCalls: []backend.ToolCall{
+			{ID: "call_1", Name: "bash", Arguments: map[string]interface{}{"cmd": "go build"}},
+			{ID: "call_2", Name: "read", Arguments: map[string]interface{}{"path": "main.go"}},
+		}},
+		{Role: "tool", ToolCallID: "call_2", Content: "package main"},
+		{Role: "tool", ToolCallID: "call_1", Content: "undefined: foo"},
+		{Role: "assistant", Content: "Error: foo is not defined anywhere."},
+	}
+
+	transcript := transcriptFromMessages(messages)
+
+	want := []struct {
+		kind     entryKind
+		toolName string
+	}{
+		{entryUser, ""},
+		{entryToolCall, "bash"},
+		{entryToolCall, "read"},
+		{entryToolResult, "read"},
+		{entryToolResult, "bash"},
+		{entryAssistant, ""},
+	}
+	if len(transcript) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(transcript), len(want), transcript)
+	}
+	for i, w := range want {
+		if transcript[i].Kind != w.kind || transcript[i].ToolName != w.toolName {
+			t.Errorf("entry %d = %s %q, want %s %q", i, transcript[i].Kind, transcript[i].ToolName, w.kind, w.toolName)
+		}
+	}
+
+	// A reply that happens to start with a label is still the assistant's
+	if last := transcript[len(transcript)-1]; last.Content != "Error: foo is not defined anywhere." {
+		t.Errorf("assistant content = %q", last.Content)
+	}
+}
+
+func TestTranscriptSavedWithSession(t *testing.T) {
+	store, err := session.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := toolShell
+	toolShell = shell.New(t.TempDir())
+	t.Cleanup(func() { toolShell = saved })
+
+	system := backend.Message{Role: "system", Content: "system prompt"}
+	m := model{backend: &scriptedBackend{}, sessionStore: store, messages: []backend.Message{system}}
+	// Before the session file exists
+	m.addEntry(entryCommand, "/usage")
+
+	call := backend.ToolCall{ID: "call_1", Name: "bash", Arguments: map[string]interface{}{"cmd": "ls"}}
+	outcome := toolOutcome{
+		message:  backend.Message{Role: "tool", ToolCallID: "call_1", Content: "ls: permission denied"},
+		status:   toolFailed,
+		duration: 1500 * time.Millisecond,
+	}
+	m.appendMessages(backend.Message{Role: "user", Content: "list the files"})
+	m.addEntry(entryUser, "list the files")
+	m.appendMessages(backend.Message{Role: "assistant", ToolCalls: []backend.ToolCall{call}})
+	m.addToolCall(call)
+	m.appendMessages(outcome.message)
+	m.addToolResult(call, outcome)
+	m.addEntry(entryError, "request failed")
+	m.session.Close()
+
+	resumed := model{backend: &scriptedBackend{}, sessionStore: store, messages: []backend.Message{system}}
+	if _, err := resumed.resumeSession(m.session.ID); err != nil {
+		t.Fatalf("resumeSession: %v", err)
+	}
+	t.Cleanup(func() { resumed.session.Close() })
+
+	want := []entryKind{entryCommand, entryUser, entryToolCall, entryToolResult, entryError, entrySystem}
+	if len(resumed.transcript) != len(want) {
+		t.Fatalf("resumed %d entries, want %d: %+v", len(resumed.transcript), len(want), resumed.transcript)
+	}
+	for i, entry := range resumed.transcript {
+		if entry.Kind != want[i] {
+			t.Errorf("entry %d is %s, want %s", i, entry.Kind, want[i])
+		}
+		if entry.Time.IsZero() {
+			t.Errorf("entry %d lost its time", i)
+		}
+	}
+	if result := resumed.transcript[3]; result.Status != toolFailed || result.Duration != outcome.duration {
+		t.Errorf("tool result = %+v, want its status and duration", result)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// rewind restores the files and the message history to how they were at
+// the start of checkpoint index (0-based) and describes what was restored
+func (m *model) rewind(index int) (string, error) {
+	if m.checkpoints == nil {
+		return "", fmt.Errorf("checkpoints are not available")
+	}
+
+	cp, restored, err := m.checkpoints.Rewind(index)
+	if cp.Time.IsZero() {
+		return "", err
+	}
+
+	var b strings.Builder
+	if len(restored) == 0 {
+		b.WriteString("No files to restore")
+	} else {
+		names := make([]string, len(restored))
+		for i, path := range restored {
+			names[i] = displayPath(path)
+		}
+		b.WriteString(fmt.Sprintf("Restored %d file(s): %s", len(restored), strings.Join(names, ", ")))
+	}
+
+	if cp.Messages >= 0 && cp.Messages <= len(m.messages) {
+		// Each turn started with a user message and a user entry
+		turns := 0
+		for _, msg := range m.messages[cp.Messages:] {
+			if msg.Role == "user" {
+				turns++
+			}
+		}
+		m.messages = m.messages[:cp.Messages]
+		if transcript, ok := rewindTranscript(m.transcript, turns); ok {
+			m.transcript = transcript
+		} else {
+			m.transcript = transcriptFromMessages(m.messages)
+		}
+		if m.session != nil {
+			if err := m.session.Replace(m.messages); err != nil {
+				debugLog.Printf("Failed to save rewound session %s: %v", m.session.ID, err)
+			}
+			if err := m.session.ReplaceTranscript(m.transcript); err != nil {
+				debugLog.Printf("Failed to save rewound transcript of session %s: %v", m.session.ID, err)
+			}
+		}
+		m.browsingTools = false
+		m.expandedTools = nil
+		m.usage.LastPromptTokens = estimateTokens(m.messages)
+		m.usage.LastCompletionTokens = 0
+		b.WriteString(fmt.Sprintf("\nConversation rewound to before %q", clipLine(firstLine(cp.Prompt), 60)))
+	} else {
+		b.WriteString("\nThe conversation was compacted since then, so it was left as it is")
+	}
+	b.WriteString("\nChanges made by bash commands are not undone")
+
+	debugLog.Printf("Rewound to checkpoint %d, restored %d files", index+1, len(restored))
+	if err != nil {
+		return "", fmt.Errorf("%s\n%w", b.String(), err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotha/bitca/backend"
+	"github.com/gotha/bitca/checkpoint"
+)
+
+func TestRewindRestoresFilesAndMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("original\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := model{
+		messages:    []backend.Message{{Role: "system", Content: "system prompt"}},
+		checkpoints: checkpoint.New(),
+	}
+	toolCheckpoints = m.checkpoints
+	defer func() { toolCheckpoints = nil }()
+
+	m.addEntry(entryCommand, "/usage")
+	m.checkpoints.Begin(len(m.messages), "rewrite the notes")
+	m.messages = append(m.messages,
+		backend.Message{Role: "user", Content: "rewrite the notes"},
+		backend.Message{Role: "assistant", Content: "Done."},
+	)
+	m.addEntry(entryUser, "rewrite the notes")
+	m.addEntry(entryAssistant, "Done.")
+	if _, err := toolWrite(map[string]interface{}{"path": path, "content": "rewritten\n"}); err != nil {
+		t.Fatalf("toolWrite: %v", err)
+	}
+
+	if _, err := m.rewind(0); err != nil {
+		t.Fatalf("rewind: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "original\n" {
+		t.Errorf("file = %q, want the original content", data)
+	}
+	if len(m.messages) != 1 {
+		t.Errorf("messages = %d, want only the system prompt", len(m.messages))
+	}
+	if len(m.transcript) != 1 || m.transcript[0].Kind != entryCommand {
+		t.Errorf("transcript = %+v, want the entries from before the turn", m.transcript)
+	}
+	if m.checkpoints.Len() != 0 {
+		t.Errorf("checkpoints = %d, want 0", m.checkpoints.Len())
+	}
+}
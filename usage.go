@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gotha/bitca/backend"
+)
+
+// ollamaDefaultContextWindow is Ollama's default num_ctx
+const ollamaDefaultContextWindow = 4096
+
+// knownContextWindows maps model name prefixes to context window sizes for
+// hosted backends. Longer prefixes must come first.
+var knownContextWindows = []struct {
+	prefix string
+	tokens int
+}{
+	{"gpt-4.1", 1047576},
+	{"gpt-4o", 128000},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4", 8192},
+	{"gpt-3.5-turbo", 16385},
+	{"gpt-5", 400000},
+	{"o1", 200000},
+	{"o3", 200000},
+	{"o4", 200000},
+	{"claude", 200000},
+	{"gemini-1.5-pro", 2097152},
+	{"gemini", 1048576},
+}
+
+// tokenUsage accumulates token counts over a session
+type tokenUsage struct {
+	Requests         int
+	PromptTokens     int // total prompt tokens sent this session
+	CompletionTokens int // total completion tokens received this session
+
+	// The most recent request approximates how full the context is
+	LastPromptTokens     int
+	LastCompletionTokens int
+}
+
+// add records the usage of one request
+func (u *tokenUsage) add(usage backend.Usage) {
+	u.Requests++
+	u.PromptTokens += usage.PromptTokens
+	u.CompletionTokens += usage.CompletionTokens
+	u.LastPromptTokens = usage.PromptTokens
+	u.LastCompletionTokens = usage.CompletionTokens
+}
+
+// contextTokens returns the number of tokens the next request will start with
+func (u tokenUsage) contextTokens() int {
+	return u.LastPromptTokens + u.LastCompletionTokens
+}
+
+// contextPercent returns how full the context window is, or -1 if unknown
+func (u tokenUsage) contextPercent(window int) int {
+	if window <= 0 || u.Requests == 0 {
+		return -1
+	}
+	return u.contextTokens() * 100 / window
+}
+
+// statusLine returns a compact usage summary for the status bar
+func (u tokenUsage) statusLine(window int) string {
+	if u.Requests == 0 {
+		return ""
+	}
+	line := fmt.Sprintf("%s in / %s out", formatTokens(u.PromptTokens), formatTokens(u.CompletionTokens))
+	if pct := u.contextPercent(window); pct >= 0 {
+		line = fmt.Sprintf("ctx %d%% of %s • %s", pct, formatTokens(window), line)
+	}
+	return line
+}
+
+// contextWindow returns the context window size for a model: the
+// -context-window flag if set, otherwise a best guess for the backend.
+// It returns 0 when the size is unknown.
+func contextWindow(backendName, modelName string) int {
+	if config.ContextWindow > 0 {
+		return config.ContextWindow
+	}
+
+	if backendName == "ollama" {
+		// Ollama truncates at num_ctx, not at the model's trained context
+		if v, err := strconv.Atoi(os.Getenv("OLLAMA_CONTEXT_LENGTH")); err == nil && v > 0 {
+			return v
+		}
+		return ollamaDefaultContextWindow
+	}
+
+	name := strings.ToLower(modelName)
+	for _, known := range knownContextWindows {
+		if strings.HasPrefix(name, known.prefix) {
+			return known.tokens
+		}
+	}
+	return 0
+}
+
+// formatTokens formats a token count compactly (e.g. 950, 12.3k, 1.0M)
+func formatTokens(n int) string {
+	switch {
+	case n >= 1000000:
+		return fmt.Sprintf("%.1fM", float64(n)/1000000)
+	case n >= 1000:
+		return fmt.Sprintf("%.1fk", float64(n)/1000)
+	default:
+		return strconv.Itoa(n)
+	}
+}
@@ -0,0 +1,206 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Workspace restricts file tools to a root directory and an explicit list
+// of extra allowed directories
+type Workspace struct {
+	root  string   // absolute, symlinks resolved
+	extra []string // absolute, symlinks resolved
+}
+
+// OutsideError is returned for paths that escape the workspace
+type OutsideError struct {
+	Path      string // the path as given
+	Resolved  string // where it actually points
+	Root      string
+	ExtraDirs []string
+}
+
+func (e *OutsideError) Error() string {
+	target := e.Path
+	if e.Resolved != "" && e.Resolved != e.Path {
+		target = fmt.Sprintf("%s (resolves to %s)", e.Path, e.Resolved)
+	}
+	msg := fmt.Sprintf("access denied: %s is outside the workspace %s", target, e.Root)
+	if len(e.ExtraDirs) > 0 {
+		msg += fmt.Sprintf(" and the allowed directories %s", strings.Join(e.ExtraDirs, ", "))
+	}
+	return msg + "; only paths inside the workspace can be used"
+}
+
+// New creates a workspace rooted at root (the current directory if empty)
+// that also allows the extra directories. All directories must exist.
+func New(root string, extra []string) (*Workspace, error) {
+	if root == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("cannot get current working directory: %w", err)
+		}
+		root = cwd
+	}
+
+	resolvedRoot, err := resolveDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workspace root: %w", err)
+	}
+
+	w := &Workspace{root: resolvedRoot}
+	for _, dir := range extra {
+		resolved, err := resolveDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed directory: %w", err)
+		}
+		w.extra = append(w.extra, resolved)
+	}
+	return w, nil
+}
+
+// resolveDir makes dir absolute, resolves symlinks and checks it is a directory
+func resolveDir(dir string) (string, error) {
+	abs, err := filepath.Abs(expandHome(dir))
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+	return resolved, nil
+}
+
+// Root returns the workspace root
+func (w *Workspace) Root() string {
+	return w.root
+}
+
+// ExtraDirs returns the extra allowed directories
+func (w *Workspace) ExtraDirs() []string {
+	return w.extra
+}
+
+// Resolve turns a tool path into an absolute path with symlinks resolved.
+// Relative paths are relative to the workspace root; the path doesn't need
+// to exist yet. It returns an *OutsideError if the result escapes the
+// workspace.
+func (w *Workspace) Resolve(path string) (string, error) {
+	if strings.TrimSpace(path) == "" {
+		return "", fmt.Errorf("path is empty")
+	}
+
+	abs := expandHome(path)
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(w.root, abs)
+	}
+	abs = filepath.Clean(abs)
+
+	resolved, err := resolveExisting(abs)
+	if err != nil {
+		return "", err
+	}
+
+	if !w.Contains(resolved) {
+		return "", &OutsideError{Path: path, Resolved: resolved, Root: w.root, ExtraDirs: w.extra}
+	}
+	return resolved, nil
+}
+
+// Contains reports whether an absolute, resolved path is inside the
+// workspace root or one of the extra directories
+func (w *Workspace) Contains(path string) bool {
+	for _, dir := range append([]string{w.root}, w.extra...) {
+		if within(dir, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// within reports whether path is dir or below it
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// maxSymlinks caps how many dangling symlinks resolveExisting follows, so a
+// loop of them ends
+const maxSymlinks = 40
+
+// resolveExisting resolves symlinks in the longest existing prefix of an
+// absolute, clean path and appends the part that doesn't exist yet. A
+// dangling symlink is followed to where it points, since creating the path
+// would create its target.
+func resolveExisting(path string) (string, error) {
+	for links := 0; ; links++ {
+		resolved, link, err := resolvePrefix(path)
+		if err != nil || link == "" {
+			return resolved, err
+		}
+		if links == maxSymlinks {
+			return "", fmt.Errorf("%s: too many levels of symbolic links", path)
+		}
+		path = link
+	}
+}
+
+// resolvePrefix does one step of resolveExisting. When the longest existing
+// prefix is a dangling symlink, it returns the path with the link replaced
+// by its target, to be resolved again.
+func resolvePrefix(path string) (resolved, link string, err error) {
+	missing := ""
+	current := path
+	for {
+		resolved, err := filepath.EvalSymlinks(current)
+		if err == nil {
+			return filepath.Join(resolved, missing), "", nil
+		}
+		if !os.IsNotExist(err) {
+			return "", "", err
+		}
+
+		if info, err := os.Lstat(current); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(current)
+			if err != nil {
+				return "", "", err
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(current), target)
+			}
+			return "", filepath.Join(target, missing), nil
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return path, "", nil
+		}
+		missing = filepath.Join(filepath.Base(current), missing)
+		current = parent
+	}
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
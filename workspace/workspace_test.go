@@ -0,0 +1,127 @@
+package workspace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "project")
+	shared := filepath.Join(base, "shared")
+	secret := filepath.Join(base, "secret")
+	for _, dir := range []string{root, shared, secret} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(secret, "key"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// A symlink inside the workspace pointing out of it
+	if err := os.Symlink(secret, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := New(root, []string{shared})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	root = w.Root() // TempDir may itself be behind a symlink
+
+	allowed := map[string]string{
+		"main.go":                   filepath.Join(root, "main.go"),
+		"./sub/../main.go":          filepath.Join(root, "main.go"),
+		"new/dir/file.txt":          filepath.Join(root, "new", "dir", "file.txt"),
+		filepath.Join(root, "a.go"): filepath.Join(root, "a.go"),
+	}
+	for path, want := range allowed {
+		got, err := w.Resolve(path)
+		if err != nil {
+			t.Errorf("Resolve(%q): %v", path, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Resolve(%q) = %q, want %q", path, got, want)
+		}
+	}
+	if _, err := w.Resolve(filepath.Join(shared, "notes.md")); err != nil {
+		t.Errorf("extra directory rejected: %v", err)
+	}
+
+	denied := []string{
+		"/etc/passwd",
+		"../secret/key",
+		"escape/key",
+		"escape/new-file",
+		root + "-other/file",
+	}
+	for _, path := range denied {
+		_, err := w.Resolve(path)
+		var outside *OutsideError
+		if !errors.As(err, &outside) {
+			t.Errorf("Resolve(%q) = %v, want OutsideError", path, err)
+		}
+	}
+
+	if _, err := w.Resolve(""); err == nil {
+		t.Error("expected error for empty path")
+	}
+}
+
+func TestResolveDanglingSymlink(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "project")
+	if err := os.Mkdir(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Links whose targets don't exist yet; writing through them creates the target
+	links := map[string]string{
+		"out":      filepath.Join(base, "outside.txt"),
+		"outdir":   filepath.Join(base, "missing", "dir"),
+		"relative": "../outside.txt",
+		"in":       "new.txt",
+		"chain":    "in",
+		"loop":     "loop",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w, err := New(root, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	root = w.Root()
+
+	for _, path := range []string{"out", "outdir/file.txt", "relative"} {
+		_, err := w.Resolve(path)
+		var outside *OutsideError
+		if !errors.As(err, &outside) {
+			t.Errorf("Resolve(%q) = %v, want OutsideError", path, err)
+		}
+	}
+	for _, path := range []string{"in", "chain"} {
+		if got, err := w.Resolve(path); err != nil || got != filepath.Join(root, "new.txt") {
+			t.Errorf("Resolve(%q) = %q, %v; want the link's target in the workspace", path, got, err)
+		}
+	}
+	if _, err := w.Resolve("loop"); err == nil {
+		t.Error("expected an error for a symlink loop")
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	if _, err := New(filepath.Join(t.TempDir(), "missing"), nil); err == nil {
+		t.Error("expected error for missing root")
+	}
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0o644)
+	if _, err := New(t.TempDir(), []string{file}); err == nil {
+		t.Error("expected error for a file as allowed directory")
+	}
+}